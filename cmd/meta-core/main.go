@@ -23,9 +23,17 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 	log.Printf("[meta-core] Service: %s, HTTP Port: %d", cfg.ServiceName, cfg.HTTPPort)
+	if err := cfg.EnsureRedisPassword(); err != nil {
+		log.Fatalf("[meta-core] %v", err)
+	}
 
 	// Create storage client
 	storageClient := storage.NewClient("")
+	storageClient.SetCredentials(cfg.RedisUsername, cfg.RedisPassword)
+	storageClient.SetIndexedFields(cfg.IndexedFields)
+	storageClient.SetCIDFields(storage.ParseCIDFields(cfg.CIDFields))
+	storageClient.SetHistoryLimits(cfg.HistoryLength, cfg.HistoryGlobalLength)
+	storageClient.SetChangeFeedLength(cfg.ChangeFeedLength)
 
 	// Create leader election
 	election := leader.NewElection(cfg)
@@ -106,6 +114,14 @@ func (a *storageConnectorAdapter) Connect(url string) error {
 	return a.client.Connect(url)
 }
 
+func (a *storageConnectorAdapter) ConnectReplica(url string) error {
+	return a.client.ConnectReplica(url)
+}
+
 func (a *storageConnectorAdapter) Close() error {
 	return a.client.Close()
 }
+
+func (a *storageConnectorAdapter) SetEpoch(epoch int64) {
+	a.client.SetEpoch(epoch)
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// changesPollInterval is how often the change feed is read for new events
+const changesPollInterval = 500 * time.Millisecond
+
+// changesBatchSize is the number of events read from the feed at once
+const changesBatchSize = 1000
+
+// changesKeepAliveInterval is how often an SSE comment is sent to keep idle
+// connections open through proxies
+const changesKeepAliveInterval = 15 * time.Second
+
+// ChangeEvent is a change feed event sent to SSE clients
+type ChangeEvent struct {
+	ID       string    `json:"id"`
+	HashID   string    `json:"hashId,omitempty"` // Empty for "clear"
+	Revision int64     `json:"revision,omitempty"`
+	Op       string    `json:"op"`
+	Keys     []string  `json:"keys,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// handleMetadataChanges handles GET /api/metadata/changes (Server-Sent Events)
+// Streams the change feed from the cursor in the since parameter or the
+// Last-Event-ID header, or from now on if neither is given. Each event's SSE
+// id is the cursor to resume from. The feed is read from Redis (the local
+// replica on followers), so any node serves it with the same cursors.
+func (s *Server) handleMetadataChanges(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	cursor := r.URL.Query().Get("since")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+	if cursor == "" {
+		latest, err := s.storage.LatestChangeID()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cursor = latest
+	} else if !historyCursorPattern.MatchString(cursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	data, _ := json.Marshal(map[string]string{"status": "connected", "since": cursor})
+	fmt.Fprintf(w, "event: connected\ndata: %s\n\n", data)
+	flusher.Flush()
+
+	poll := time.NewTicker(changesPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(changesKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+			cursor = s.sendChanges(w, cursor)
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sendChanges writes the change events after cursor and returns the cursor
+// to continue from. If the feed no longer reaches back to the cursor, or was
+// rolled back by a backup restore, it sends a reset event, after which the
+// client must resynchronize (e.g. from /meta), and continues from the newest
+// event. Read errors (e.g. during a leader change) are retried on the next
+// poll.
+func (s *Server) sendChanges(w http.ResponseWriter, cursor string) string {
+	for {
+		events, err := s.storage.Changes(cursor, changesBatchSize)
+		if errors.Is(err, storage.ErrChangesTrimmed) {
+			latest, err := s.storage.LatestChangeID()
+			if err != nil {
+				return cursor
+			}
+			data, _ := json.Marshal(map[string]string{"since": latest, "reason": "trimmed"})
+			fmt.Fprintf(w, "id: %s\nevent: reset\ndata: %s\n\n", latest, data)
+			cursor = latest
+			continue
+		}
+		if err != nil {
+			return cursor
+		}
+
+		for _, event := range events {
+			cursor = event.ID
+			if event.Op == "restore" {
+				data, _ := json.Marshal(map[string]string{"since": event.ID, "reason": "restore"})
+				fmt.Fprintf(w, "id: %s\nevent: reset\ndata: %s\n\n", event.ID, data)
+				continue
+			}
+
+			data, err := json.Marshal(ChangeEvent{
+				ID:       event.ID,
+				HashID:   event.HashID,
+				Revision: event.Revision,
+				Op:       event.Op,
+				Keys:     event.Keys,
+				Time:     event.Time,
+			})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: change\ndata: %s\n\n", event.ID, data)
+		}
+		if len(events) < changesBatchSize {
+			return cursor
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// formatETag returns the entity tag of a file revision
+func formatETag(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
+
+// ifMatches returns true if an If-Match header value matches the revision of
+// a file (exists is false for files without metadata)
+// Weak tags never match, as If-Match requires strong comparison.
+func ifMatches(header string, revision int64, exists bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			if exists {
+				return true
+			}
+			continue
+		}
+		if tag == formatETag(revision) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeIfMatch applies a write to a file if the request's If-Match header
+// matches its revision, atomically with the check. It sets the ETag of the
+// new revision and returns the metadata the write replaced. On failure it
+// writes the error response (412 if the file changed) and returns false.
+func (s *Server) writeIfMatch(w http.ResponseWriter, r *http.Request, op storage.BatchOp) (map[string]string, bool) {
+	before, revision, err := s.storage.GetMetadataRevision(op.HashID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if !ifMatches(r.Header.Get("If-Match"), revision, before != nil) {
+		w.Header().Set("ETag", formatETag(revision))
+		writeError(w, http.StatusPreconditionFailed, "metadata has been modified (revision "+strconv.FormatInt(revision, 10)+")")
+		return nil, false
+	}
+
+	// The revision matched; the batch fails if it changes before the write
+	op.IfRevision = &revision
+	revisions, err := s.writer(r).ApplyBatch([]storage.BatchOp{op})
+	switch {
+	case errors.Is(err, storage.ErrRevisionMismatch):
+		writeError(w, http.StatusPreconditionFailed, "metadata has been modified")
+		return nil, false
+	case errors.Is(err, storage.ErrConflict), errors.Is(err, storage.ErrStaleEpoch):
+		writeError(w, http.StatusConflict, err.Error())
+		return nil, false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	w.Header().Set("ETag", formatETag(revisions[op.HashID]))
+	return before, true
+}
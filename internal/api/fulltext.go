@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/metazla/meta-core/internal/fulltext"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// FullTextResult is a single full-text search result
+type FullTextResult struct {
+	HashID     string            `json:"hashId"`
+	Score      float64           `json:"score"`
+	Metadata   map[string]string `json:"metadata"`
+	Highlights map[string]string `json:"highlights,omitempty"` // Field -> HTML with <mark> around matches
+}
+
+// FullTextResponse is the response for GET /api/metadata/fulltext
+type FullTextResponse struct {
+	Results []FullTextResult `json:"results"`
+	Count   int              `json:"count"`
+	Total   int              `json:"total"`
+}
+
+// handleFullTextSearch handles GET /api/metadata/fulltext?q=X&offset=N&limit=N
+func (s *Server) handleFullTextSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "q parameter is required")
+		return
+	}
+
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	offset := 0
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+	limit := 20
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	hits, err := s.storage.FullTextSearch(query)
+	if errors.Is(err, storage.ErrNotIndexed) {
+		writeError(w, http.StatusServiceUnavailable, "full-text index is being rebuilt")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	page := paginate(hits, offset, limit)
+	hashIDs := make([]string, len(page))
+	for i, hit := range page {
+		hashIDs[i] = hit.HashID
+	}
+	metadataByID, err := s.storage.GetMetadataFlatMulti(hashIDs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]FullTextResult, 0)
+	for _, hit := range page {
+		metadata, ok := metadataByID[hit.HashID]
+		if !ok {
+			continue
+		}
+		results = append(results, FullTextResult{
+			HashID:     hit.HashID,
+			Score:      hit.Score,
+			Metadata:   metadata,
+			Highlights: highlightFields(metadata, hit.Terms),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, FullTextResponse{
+		Results: results,
+		Count:   len(results),
+		Total:   len(hits),
+	})
+}
+
+// highlightFields marks the matched terms in the full-text fields of a file
+func highlightFields(metadata map[string]string, terms []string) map[string]string {
+	matched := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		matched[term] = true
+	}
+
+	highlights := make(map[string]string)
+	for _, field := range fulltext.Fields {
+		if highlighted, ok := fulltext.Highlight(metadata[field.Name], matched); ok {
+			highlights[field.Name] = highlighted
+		}
+	}
+	return highlights
+}
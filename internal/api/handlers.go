@@ -1,18 +1,24 @@
 package api
 
 import (
-	"crypto/sha256"
-	"encoding/base32"
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/jobs"
 	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/midhash"
+	"github.com/metazla/meta-core/internal/storage"
+	"github.com/metazla/meta-core/internal/unixfs"
 )
 
 // contentTypeByExt maps file extensions to MIME types
@@ -42,14 +48,15 @@ type HealthResponse struct {
 
 // StatusResponse is the response for /status
 type StatusResponse struct {
-	Status      string                 `json:"status"`
-	Role        string                 `json:"role"`
-	Redis       bool                   `json:"redis"`
-	ServiceName string                 `json:"serviceName"`
-	Version     string                 `json:"version"`
-	Uptime      int64                  `json:"uptimeSeconds"`
-	FileCount   int                    `json:"fileCount"`
-	Leader      *leader.LeaderLockInfo `json:"leader,omitempty"`
+	Status       string                 `json:"status"`
+	Role         string                 `json:"role"`
+	Redis        bool                   `json:"redis"`
+	ServiceName  string                 `json:"serviceName"`
+	Version      string                 `json:"version"`
+	Uptime       int64                  `json:"uptimeSeconds"`
+	FileCount    int                    `json:"fileCount"`
+	Leader       *leader.LeaderLockInfo `json:"leader,omitempty"`
+	RedisProcess leader.RedisStatus     `json:"redisProcess"` // Locally managed redis-server
 }
 
 // MetadataResponse is the response for /meta/{hash}
@@ -65,6 +72,22 @@ type DataPathResponse struct {
 	Exists bool   `json:"exists"`
 }
 
+// DataVerifyResponse is the response for /data/{hash}/verify
+type DataVerifyResponse struct {
+	HashID   string `json:"hashId"`
+	Path     string `json:"path"` // Relative to FILES_PATH
+	Exists   bool   `json:"exists"`
+	Computed string `json:"computed,omitempty"` // Hash ID of the file on disk
+	Matches  bool   `json:"matches"`
+}
+
+// DataByPathResponse is the response for /data/by-path
+type DataByPathResponse struct {
+	Path    string   `json:"path"`    // Normalized, relative to FILES_PATH
+	HashID  string   `json:"hashId"`  // First of HashIDs
+	HashIDs []string `json:"hashIds"` // Every file recorded at the path
+}
+
 // ErrorResponse is the response for errors
 type ErrorResponse struct {
 	Error   string `json:"error"`
@@ -99,17 +122,18 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := StatusResponse{
-		Status:      "ok",
-		Role:        string(s.election.Role()),
-		Redis:       s.storage.Health(),
-		ServiceName: s.config.ServiceName,
-		Version:     s.config.ServiceVersion,
-		Uptime:      int64(time.Since(startTime).Seconds()),
-		FileCount:   fileCount,
-		Leader:      s.election.LeaderInfo(),
-	}
-
-	if !response.Redis {
+		Status:       "ok",
+		Role:         string(s.election.Role()),
+		Redis:        s.storage.Health(),
+		ServiceName:  s.config.ServiceName,
+		Version:      s.config.ServiceVersion,
+		Uptime:       int64(time.Since(startTime).Seconds()),
+		FileCount:    fileCount,
+		Leader:       s.election.LeaderInfo(),
+		RedisProcess: s.election.RedisStatus(),
+	}
+
+	if !response.Redis || (s.election.IsLeader() && !response.RedisProcess.Running) {
 		response.Status = "degraded"
 	}
 
@@ -127,6 +151,39 @@ func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, info)
 }
 
+// handleStepDown handles POST /leader/step-down
+// Hands leadership to another node and returns the new leader info
+// Optional ?timeout=20s bounds how long to wait for a successor
+func (s *Server) handleStepDown(w http.ResponseWriter, r *http.Request) {
+	timeout := 20 * time.Second
+	if timeoutStr := r.URL.Query().Get("timeout"); timeoutStr != "" {
+		parsed, err := time.ParseDuration(timeoutStr)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	info, err := s.election.StepDown(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, leader.ErrNotLeader):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, leader.ErrNoSuccessor):
+			writeError(w, http.StatusGatewayTimeout, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
 // handleRole handles GET /role
 func (s *Server) handleRole(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{
@@ -149,7 +206,7 @@ func (s *Server) handleGetMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metadata, err := s.storage.GetMetadataFlat(hashID)
+	metadata, revision, err := s.storage.GetMetadataRevision(hashID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -160,6 +217,7 @@ func (s *Server) handleGetMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(revision))
 	response := MetadataResponse{
 		HashID:   hashID,
 		Metadata: metadata,
@@ -189,7 +247,11 @@ func (s *Server) handlePutMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.storage.SetMetadataFlat(hashID, metadata); err != nil {
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Set: metadata}); !ok {
+			return
+		}
+	} else if err := s.writer(r).SetMetadataFlat(hashID, metadata); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -215,10 +277,19 @@ func (s *Server) handleDeleteMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deleted, err := s.storage.DeleteMetadata(hashID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	var deleted int64
+	if r.Header.Get("If-Match") != "" {
+		before, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Delete: true})
+		if !ok {
+			return
+		}
+		deleted = int64(len(before))
+	} else {
+		var err error
+		if deleted, err = s.writer(r).DeleteMetadata(hashID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -229,22 +300,46 @@ func (s *Server) handleDeleteMeta(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleListMeta handles GET /meta
+// Returns every hash ID, or a page of them in order if cursor or limit is
+// given; see handleListMetadata for cursors.
 func (s *Server) handleListMeta(w http.ResponseWriter, r *http.Request) {
 	if !s.storage.IsConnected() {
 		writeError(w, http.StatusServiceUnavailable, "storage not connected")
 		return
 	}
 
-	hashIDs, err := s.storage.GetAllHashIDs()
+	// Without paging parameters every hash ID is returned, as before pages
+	query := r.URL.Query()
+	if !query.Has("cursor") && !query.Has("limit") {
+		hashIDs, err := s.storage.GetAllHashIDs()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		sort.Strings(hashIDs)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"hashIds": hashIDs,
+			"count":   len(hashIDs),
+		})
+		return
+	}
+
+	cursor, limit := parseCursorPage(r, 1000)
+
+	hashIDs, nextCursor, err := s.storage.ListHashIDs(cursor, limit)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	response := map[string]interface{}{
 		"hashIds": hashIDs,
 		"count":   len(hashIDs),
-	})
+	}
+	if nextCursor != "" {
+		response["nextCursor"] = nextCursor
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 // handleGetDataPath handles GET /data/{hash}/path
@@ -288,6 +383,38 @@ func (s *Server) handleGetDataPath(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, response)
 }
 
+// handleGetDataByPath handles GET /data/by-path?path=
+// Returns the hash IDs of the files whose filePath is the given path.
+func (s *Server) handleGetDataByPath(w http.ResponseWriter, r *http.Request) {
+	relPath := storage.NormalizePath(r.URL.Query().Get("path"))
+	if relPath == "" {
+		writeError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	hashIDs, err := s.storage.LookupHashesByPath(relPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(hashIDs) == 0 {
+		writeError(w, http.StatusNotFound, "no file at path")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DataByPathResponse{
+		Path:    relPath,
+		HashID:  hashIDs[0],
+		HashIDs: hashIDs,
+	})
+}
+
 // handleHeadData handles HEAD /data/{hash}
 func (s *Server) handleHeadData(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -320,8 +447,49 @@ func (s *Server) handleHeadData(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleVerifyData handles GET /data/{hash}/verify
+// Checks that the file at the metadata's filePath still has the hash ID
+func (s *Server) handleVerifyData(w http.ResponseWriter, r *http.Request) {
+	hashID := mux.Vars(r)["hash"]
+
+	if err := midhash.Validate(hashID); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	filePath, err := s.storage.GetProperty(hashID, "filePath")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if filePath == "" {
+		writeError(w, http.StatusNotFound, "file path not found")
+		return
+	}
+
+	response := DataVerifyResponse{HashID: hashID, Path: filePath}
+	fullPath, _, err := jobs.ResolvePath(s.config.FilesPath, filePath)
+	if err == nil {
+		response.Exists = true
+		response.Computed, err = midhash.File(fullPath)
+		if err != nil {
+			writeFileError(w, err)
+			return
+		}
+		response.Matches = strings.EqualFold(response.Computed, hashID)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
 // handleGetFileByCID handles GET /file/{cid}
-// Serves a file by looking up its CID in poster/backdrop metadata
+// Serves a file by looking up its CID in the CID index (METADATA_CID_FIELDS)
 func (s *Server) handleGetFileByCID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	cid := vars["cid"]
@@ -455,10 +623,18 @@ func (s *Server) handlePatchMeta(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updated, err := s.storage.MergeMetadataFlat(hashID, metadata)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	var updated int
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Set: metadata}); !ok {
+			return
+		}
+		updated = len(metadata)
+	} else {
+		var err error
+		if updated, err = s.writer(r).MergeMetadataFlat(hashID, metadata); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -555,7 +731,11 @@ func (s *Server) handlePutProperty(w http.ResponseWriter, r *http.Request) {
 		value = string(body)
 	}
 
-	if err := s.storage.SetProperty(hashID, key, value); err != nil {
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Set: map[string]string{key: value}}); !ok {
+			return
+		}
+	} else if err := s.writer(r).SetProperty(hashID, key, value); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -589,7 +769,11 @@ func (s *Server) handleDeleteProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.storage.DeleteProperty(hashID, key); err != nil {
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Unset: []string{key}}); !ok {
+			return
+		}
+	} else if err := s.writer(r).DeleteProperty(hashID, key); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -605,23 +789,96 @@ func (s *Server) handleDeleteProperty(w http.ResponseWriter, r *http.Request) {
 // Adds a value to a set-type field
 // Accepts JSON body with {"value": "..."} or plain text
 func (s *Server) handleAddToSet(w http.ResponseWriter, r *http.Request) {
+	hashID, key, value, ok := s.readSetValue(w, r)
+	if !ok {
+		return
+	}
+
+	var added bool
+	if r.Header.Get("If-Match") != "" {
+		before, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, AddToSet: map[string][]string{key: {value}}})
+		if !ok {
+			return
+		}
+		added = !setContains(before[key], value)
+	} else {
+		var err error
+		if added, err = s.writer(r).AddToSet(hashID, key, value); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"hashId":   hashID,
+		"property": key,
+		"added":    added,
+	})
+}
+
+// handleRemoveFromSet handles POST /meta/{hash}/_remove/{key}
+// Removes a value from a set-type field, deleting the field when it empties
+// Accepts JSON body with {"value": "..."} or plain text
+func (s *Server) handleRemoveFromSet(w http.ResponseWriter, r *http.Request) {
+	hashID, key, value, ok := s.readSetValue(w, r)
+	if !ok {
+		return
+	}
+
+	var removed bool
+	if r.Header.Get("If-Match") != "" {
+		before, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, RemoveFromSet: map[string][]string{key: {value}}})
+		if !ok {
+			return
+		}
+		removed = setContains(before[key], value)
+	} else {
+		var err error
+		if removed, err = s.writer(r).RemoveFromSet(hashID, key, value); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"hashId":   hashID,
+		"property": key,
+		"removed":  removed,
+	})
+}
+
+// setContains returns true if an encoded set property holds value
+func setContains(encoded, value string) bool {
+	for _, element := range storage.SplitSet(encoded) {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readSetValue reads the hash, key and value of a set operation request
+// On failure it writes the error response and returns false.
+func (s *Server) readSetValue(w http.ResponseWriter, r *http.Request) (string, string, string, bool) {
 	vars := mux.Vars(r)
 	hashID := vars["hash"]
 	key := vars["key"]
 
 	if hashID == "" {
 		writeError(w, http.StatusBadRequest, "hash is required")
-		return
+		return "", "", "", false
 	}
 
 	if key == "" {
 		writeError(w, http.StatusBadRequest, "key is required")
-		return
+		return "", "", "", false
 	}
 
 	if !s.storage.IsConnected() {
 		writeError(w, http.StatusServiceUnavailable, "storage not connected")
-		return
+		return "", "", "", false
 	}
 
 	// Read body
@@ -629,7 +886,7 @@ func (s *Server) handleAddToSet(w http.ResponseWriter, r *http.Request) {
 	n, err := r.Body.Read(buf)
 	if err != nil && err.Error() != "EOF" {
 		writeError(w, http.StatusBadRequest, "failed to read body")
-		return
+		return "", "", "", false
 	}
 	body := buf[:n]
 
@@ -646,26 +903,15 @@ func (s *Server) handleAddToSet(w http.ResponseWriter, r *http.Request) {
 
 	if value == "" {
 		writeError(w, http.StatusBadRequest, "value is required")
-		return
+		return "", "", "", false
 	}
-
-	added, err := s.storage.AddToSet(hashID, key, value)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"success":  true,
-		"hashId":   hashID,
-		"property": key,
-		"added":    added,
-	})
+	return hashID, key, value, true
 }
 
 // CIDRequest is the request body for POST /file/cid
 type CIDRequest struct {
-	Path string `json:"path"`
+	Path   string `json:"path"`
+	Layout string `json:"layout"` // "raw" (default) or "unixfs"
 }
 
 // CIDResponse is the response for POST /file/cid
@@ -676,7 +922,9 @@ type CIDResponse struct {
 }
 
 // handleComputeFileCID handles POST /file/cid
-// Computes the IPFS-compatible CIDv1 (sha256) for a file
+// Computes the IPFS-compatible CIDv1 (sha256) for a file: a single raw block,
+// or with layout "unixfs" the root of the DAG `ipfs add` builds. Large files
+// take longer to hash than the write timeout allows: use POST /api/jobs/cid.
 func (s *Server) handleComputeFileCID(w http.ResponseWriter, r *http.Request) {
 	var req CIDRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -689,61 +937,130 @@ func (s *Server) handleComputeFileCID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct full path - path should be relative to FILES_PATH
-	fullPath := filepath.Join(s.config.FilesPath, req.Path)
+	result, err := s.jobsManager.ComputeCID(r.Context(), jobs.CIDJobRequest{Path: req.Path, Layout: req.Layout})
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, CIDResponse{
+		CID:  result.CID,
+		Path: req.Path,
+		Size: result.Size,
+	})
+}
+
+// HashRequest is the request body for POST /file/hash
+type HashRequest struct {
+	Path   string `json:"path"`
+	HashID string `json:"hashId,omitempty"` // Expected hash ID to verify
+}
+
+// HashResponse is the response for POST /file/hash
+type HashResponse struct {
+	HashID  string `json:"hashId"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Matches *bool  `json:"matches,omitempty"` // Set when an expected hash ID was sent
+}
+
+// handleComputeFileHash handles POST /file/hash
+// Computes the midhash256 hash ID of a file, and compares it to an expected one
+func (s *Server) handleComputeFileHash(w http.ResponseWriter, r *http.Request) {
+	var req HashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, "path is required")
+		return
+	}
+
+	if req.HashID != "" {
+		if err := midhash.Validate(req.HashID); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
-	// Security check: ensure path is within FILES_PATH
-	absFilesPath, _ := filepath.Abs(s.config.FilesPath)
-	absFullPath, _ := filepath.Abs(fullPath)
-	if !strings.HasPrefix(absFullPath, absFilesPath) {
-		writeError(w, http.StatusBadRequest, "path must be within files directory")
+	fullPath, info, err := jobs.ResolvePath(s.config.FilesPath, req.Path)
+	if err != nil {
+		writeFileError(w, err)
 		return
 	}
 
-	// Check if file exists
-	fileInfo, err := os.Stat(fullPath)
+	hashID, err := midhash.File(fullPath)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "file not found")
+		writeFileError(w, err)
 		return
 	}
 
-	if fileInfo.IsDir() {
-		writeError(w, http.StatusBadRequest, "path is a directory, not a file")
+	response := HashResponse{HashID: hashID, Path: req.Path, Size: info.Size()}
+	if req.HashID != "" {
+		matches := strings.EqualFold(hashID, req.HashID)
+		response.Matches = &matches
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleExportFileCAR handles GET /file/car?path=
+// Streams the UnixFS DAG of a file as a CARv1, rooted at its "unixfs" CID
+func (s *Server) handleExportFileCAR(w http.ResponseWriter, r *http.Request) {
+	relPath := r.URL.Query().Get("path")
+	if relPath == "" {
+		writeError(w, http.StatusBadRequest, "path is required")
 		return
 	}
 
-	// Open and hash the file
-	file, err := os.Open(fullPath)
+	// Exporting a large file outlives the write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// The header needs the root, so the file is read twice unless its CID
+	// is cached
+	result, err := s.jobsManager.ComputeCID(r.Context(), jobs.CIDJobRequest{Path: relPath, Layout: jobs.LayoutUnixFS})
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to open file")
+		writeFileError(w, err)
 		return
 	}
-	defer file.Close()
-
-	// Compute SHA-256 hash
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to read file")
+	root, err := unixfs.ParseCID(result.CID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	hashBytes := hasher.Sum(nil)
 
-	// Build CIDv1 with raw codec (0x55) and sha256 multihash
-	// CIDv1 format: version (0x01) + codec (0x55) + multihash
-	// Multihash format: hash-code (0x12) + length (0x20) + hash
-	cidBytes := make([]byte, 0, 2+2+32)
-	cidBytes = append(cidBytes, 0x01)       // CIDv1
-	cidBytes = append(cidBytes, 0x55)       // raw codec
-	cidBytes = append(cidBytes, 0x12)       // sha256 code
-	cidBytes = append(cidBytes, 0x20)       // 32 bytes
-	cidBytes = append(cidBytes, hashBytes...)
+	fullPath, _, err := jobs.ResolvePath(s.config.FilesPath, relPath)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	defer file.Close()
 
-	// Encode as base32lower with 'b' prefix (multibase)
-	cid := "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(cidBytes))
+	w.Header().Set("Content-Type", "application/vnd.ipld.car; version=1")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", result.CID+".car"))
+	w.Header().Set("X-Content-CID", result.CID)
+	if err := unixfs.WriteCAR(w, root, file); err != nil {
+		// The status is sent: abort so the client sees a truncated response
+		log.Printf("[API] CAR export of %s failed: %v", relPath, err)
+		panic(http.ErrAbortHandler)
+	}
+}
 
-	writeJSON(w, http.StatusOK, CIDResponse{
-		CID:  cid,
-		Path: req.Path,
-		Size: fileInfo.Size(),
-	})
+// writeFileError maps errors resolving and reading a file under FILES_PATH
+// to HTTP status codes
+func writeFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrFileNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrInvalidPath), errors.Is(err, jobs.ErrIsDirectory), errors.Is(err, jobs.ErrUnsupportedLayout):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to read file")
+	}
 }
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// SourceHeader names the service making a write, recorded in the history
+const SourceHeader = "X-Service-Name"
+
+// historyCursorPattern matches history cursors (stream entry IDs)
+var historyCursorPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// HistoryEntry is a recorded write in a history response
+type HistoryEntry struct {
+	ID       string                   `json:"id"`
+	HashID   string                   `json:"hashId,omitempty"`
+	Revision int64                    `json:"revision,omitempty"`
+	Op       string                   `json:"op"`
+	Source   string                   `json:"source,omitempty"`
+	Time     time.Time                `json:"time"`
+	Changes  []storage.PropertyChange `json:"changes,omitempty"`
+	Files    int64                    `json:"files,omitempty"` // Files deleted by a clear
+}
+
+// HistoryResponse is the response for GET /api/metadata/{hashId}/history and
+// GET /api/metadata/history
+type HistoryResponse struct {
+	Entries    []HistoryEntry `json:"entries"`
+	Count      int            `json:"count"`
+	NextCursor string         `json:"nextCursor,omitempty"` // Empty on the last page
+}
+
+// RevertRequest is the request body for POST /api/metadata/{hashId}/revert
+type RevertRequest struct {
+	Revision *int64 `json:"revision"`
+}
+
+// RevertResponse is the response for POST /api/metadata/{hashId}/revert
+type RevertResponse struct {
+	HashID   string `json:"hashId"`
+	Revision int64  `json:"revision"` // Revision after the revert
+	Status   string `json:"status"`
+}
+
+// writer returns the store to write through for a request, recording its
+// writes as made by the service named in the SourceHeader
+func (s *Server) writer(r *http.Request) storage.Store {
+	return s.storage.WithSource(r.Header.Get(SourceHeader))
+}
+
+// handleGetHistory handles GET /api/metadata/{hashId}/history
+// Query parameters: cursor, limit (default 100)
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	hashID := mux.Vars(r)["hashId"]
+	if hashID == "" {
+		writeError(w, http.StatusBadRequest, "hash ID is required")
+		return
+	}
+	s.writeHistory(w, r, hashID)
+}
+
+// handleGetGlobalHistory handles GET /api/metadata/history
+// Query parameters: cursor, limit (default 100)
+func (s *Server) handleGetGlobalHistory(w http.ResponseWriter, r *http.Request) {
+	s.writeHistory(w, r, "")
+}
+
+// writeHistory writes a page of the history of a file, or of all files if
+// hashID is empty
+func (s *Server) writeHistory(w http.ResponseWriter, r *http.Request, hashID string) {
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	cursor, limit := parseCursorPage(r, 100)
+	if cursor != "" && !historyCursorPattern.MatchString(cursor) {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	entries, next, err := s.storage.History(hashID, cursor, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := HistoryResponse{
+		Entries:    make([]HistoryEntry, 0, len(entries)),
+		NextCursor: next,
+	}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, HistoryEntry{
+			ID:       entry.ID,
+			HashID:   entry.HashID,
+			Revision: entry.Revision,
+			Op:       entry.Op,
+			Source:   entry.Source,
+			Time:     entry.Time,
+			Changes:  entry.Changes,
+			Files:    entry.Files,
+		})
+	}
+	response.Count = len(response.Entries)
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleRevertMetadata handles POST /api/metadata/{hashId}/revert
+// Restores the metadata of a file at a revision as a new revision
+func (s *Server) handleRevertMetadata(w http.ResponseWriter, r *http.Request) {
+	hashID := mux.Vars(r)["hashId"]
+	if hashID == "" {
+		writeError(w, http.StatusBadRequest, "hash ID is required")
+		return
+	}
+
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Revision == nil {
+		writeError(w, http.StatusBadRequest, "revision is required")
+		return
+	}
+
+	revision, err := s.writer(r).RevertToRevision(hashID, *req.Revision)
+	switch {
+	case errors.Is(err, storage.ErrHistoryTrimmed):
+		writeError(w, http.StatusGone, err.Error())
+		return
+	case errors.Is(err, storage.ErrRevisionMismatch), errors.Is(err, storage.ErrConflict), errors.Is(err, storage.ErrStaleEpoch):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(revision))
+	writeJSON(w, http.StatusOK, RevertResponse{
+		HashID:   hashID,
+		Revision: revision,
+		Status:   "reverted",
+	})
+}
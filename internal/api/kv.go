@@ -54,12 +54,14 @@ func (s *Server) handleKVInfo(w http.ResponseWriter, r *http.Request) {
 
 	// Calculate total size from sizeByte metadata (if available)
 	var totalSize int64
-	for _, hashID := range hashIDs {
-		sizeStr, err := s.storage.GetProperty(hashID, "sizeByte")
-		if err == nil && sizeStr != "" {
-			if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
-				totalSize += size
-			}
+	sizes, err := s.storage.GetPropertyMulti(hashIDs, "sizeByte")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, sizeStr := range sizes {
+		if size, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
+			totalSize += size
 		}
 	}
 
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/metazla/meta-core/internal/leader"
+)
+
+// LeaderEventType is the webhook event type for leadership transitions
+// Subscribers must list it in eventTypes to receive leadership events
+const LeaderEventType = "leader"
+
+// leaderKeepAliveInterval is how often an SSE comment is sent to keep idle
+// connections open through proxies
+const leaderKeepAliveInterval = 15 * time.Second
+
+// leaderEventHub fans leadership events out to SSE clients
+type leaderEventHub struct {
+	clients map[chan leader.LeadershipEvent]bool
+	mu      sync.RWMutex
+}
+
+func newLeaderEventHub() *leaderEventHub {
+	return &leaderEventHub{
+		clients: make(map[chan leader.LeadershipEvent]bool),
+	}
+}
+
+func (h *leaderEventHub) add(ch chan leader.LeadershipEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[ch] = true
+}
+
+func (h *leaderEventHub) remove(ch chan leader.LeadershipEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, ch)
+	close(ch)
+}
+
+// publish sends an event to all clients without blocking the election loop
+func (h *leaderEventHub) publish(event leader.LeadershipEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- event:
+		default:
+			// Channel full, skip
+		}
+	}
+}
+
+// handleLeaderEvents handles GET /api/leader/events (Server-Sent Events)
+func (s *Server) handleLeaderEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	eventChan := make(chan leader.LeadershipEvent, 16)
+	s.leaderEvents.add(eventChan)
+	defer s.leaderEvents.remove(eventChan)
+
+	// Send the current view so clients do not have to wait for a transition
+	status := map[string]interface{}{
+		"status": "connected",
+		"role":   s.election.Role(),
+		"leader": s.election.LeaderInfo(),
+	}
+	data, _ := json.Marshal(status)
+	fmt.Fprintf(w, "event: connected\ndata: %s\n\n", data)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(leaderKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-eventChan:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -2,13 +2,21 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/midhash"
+	"github.com/metazla/meta-core/internal/storage"
 )
 
+// maxPageSize is the largest page a cursor listing returns
+const maxPageSize = 10000
+
 // HashIDsResponse is the response for GET /api/metadata/hash-ids
 type HashIDsResponse struct {
 	HashIds []string `json:"hashIds"`
@@ -27,9 +35,10 @@ type MetadataListItem struct {
 
 // MetadataListResponse is the response for GET /api/metadata/list
 type MetadataListResponse struct {
-	Items []MetadataListItem `json:"items"`
-	Count int                `json:"count"`
-	Total int                `json:"total"`
+	Items      []MetadataListItem `json:"items"`
+	Count      int                `json:"count"`
+	Total      int                `json:"total"`
+	NextCursor string             `json:"nextCursor,omitempty"` // Empty on the last page
 }
 
 // MetadataSearchRequest is the request body for POST /api/metadata/search
@@ -38,6 +47,9 @@ type MetadataSearchRequest struct {
 	HashID        string `json:"hashId,omitempty"`
 	Property      string `json:"property,omitempty"`
 	PropertyValue string `json:"propertyValue,omitempty"`
+	Filter        string `json:"filter,omitempty"` // Filter expression, see Filter
+	Sort          string `json:"sort,omitempty"`   // e.g. "-year,title", see ParseSort
+	Offset        int    `json:"offset,omitempty"`
 	Limit         int    `json:"limit,omitempty"`
 }
 
@@ -57,20 +69,29 @@ type MetadataSearchResponse struct {
 // MetadataBatchUpdateRequest is the request body for POST /api/metadata/batch
 type MetadataBatchUpdateRequest struct {
 	Updates []MetadataBatchItem `json:"updates"`
+	Atomic  bool                `json:"atomic,omitempty"` // Apply all updates or none
 }
 
 // MetadataBatchItem is a single item in a batch update
+// Changes are applied in field order: delete, metadata, properties,
+// deleteProperties, addToSet, removeFromSet.
 type MetadataBatchItem struct {
-	HashID     string            `json:"hashId"`
-	Metadata   map[string]string `json:"metadata,omitempty"`
-	Properties map[string]string `json:"properties,omitempty"`
+	HashID           string              `json:"hashId"`
+	IfRevision       *int64              `json:"ifRevision,omitempty"` // Atomic batches only: fail unless the file is at this revision
+	Delete           bool                `json:"delete,omitempty"`     // Delete the file's metadata first
+	Metadata         map[string]string   `json:"metadata,omitempty"`
+	Properties       map[string]string   `json:"properties,omitempty"`
+	DeleteProperties []string            `json:"deleteProperties,omitempty"`
+	AddToSet         map[string][]string `json:"addToSet,omitempty"`
+	RemoveFromSet    map[string][]string `json:"removeFromSet,omitempty"`
 }
 
 // MetadataBatchResult is a single result from a batch update
 type MetadataBatchResult struct {
-	HashID string `json:"hashId"`
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
+	HashID   string `json:"hashId"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Revision *int64 `json:"revision,omitempty"` // Atomic batches only: revision after the batch
 }
 
 // MetadataBatchResponse is the response for POST /api/metadata/batch
@@ -110,74 +131,77 @@ func (s *Server) handleGetHashIds(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleListMetadata handles GET /api/metadata/list
+// Pages are ordered by hash ID; pass the previous response's nextCursor as
+// cursor to get the next one.
 func (s *Server) handleListMetadata(w http.ResponseWriter, r *http.Request) {
 	if !s.storage.IsConnected() {
 		writeError(w, http.StatusServiceUnavailable, "storage not connected")
 		return
 	}
 
-	// Parse pagination parameters
-	offsetStr := r.URL.Query().Get("offset")
-	limitStr := r.URL.Query().Get("limit")
-
-	offset := 0
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil {
-			offset = o
-		}
-	}
+	cursor, limit := parseCursorPage(r, 100)
 
-	limit := 100
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	hashIDs, nextCursor, err := s.storage.ListHashIDs(cursor, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// Get all hash IDs
-	allHashIDs, err := s.storage.GetAllHashIDs()
+	total, err := s.storage.CountFiles()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	total := len(allHashIDs)
-
-	// Apply pagination
-	end := offset + limit
-	if end > total {
-		end = total
+	metadataByID, err := s.storage.GetMetadataFlatMulti(hashIDs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	var items []MetadataListItem
-	if offset < total {
-		for _, hashID := range allHashIDs[offset:end] {
-			metadata, err := s.storage.GetMetadataFlat(hashID)
-			if err != nil || metadata == nil {
-				continue
-			}
+	items := make([]MetadataListItem, 0, len(hashIDs))
+	for _, hashID := range hashIDs {
+		metadata, ok := metadataByID[hashID]
+		if !ok {
+			continue
+		}
 
-			item := MetadataListItem{
-				HashID:   hashID,
-				Title:    metadata["title"],
-				FileName: metadata["fileName"],
-				FilePath: metadata["filePath"],
-				Type:     metadata["type"],
-				Year:     metadata["year"],
-			}
-			items = append(items, item)
+		item := MetadataListItem{
+			HashID:   hashID,
+			Title:    metadata["title"],
+			FileName: metadata["fileName"],
+			FilePath: metadata["filePath"],
+			Type:     metadata["type"],
+			Year:     metadata["year"],
 		}
+		items = append(items, item)
 	}
 
 	response := MetadataListResponse{
-		Items: items,
-		Count: len(items),
-		Total: total,
+		Items:      items,
+		Count:      len(items),
+		Total:      total,
+		NextCursor: nextCursor,
 	}
 
 	writeJSON(w, http.StatusOK, response)
 }
 
+// parseCursorPage parses the cursor and limit query parameters of a listing
+// The limit is capped at maxPageSize.
+func parseCursorPage(r *http.Request, defaultLimit int) (string, int) {
+	limit := defaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return r.URL.Query().Get("cursor"), limit
+}
+
 // handleGetMetadataByHashId handles GET /api/metadata/{hashId}
 func (s *Server) handleGetMetadataByHashId(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -193,7 +217,7 @@ func (s *Server) handleGetMetadataByHashId(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	metadata, err := s.storage.GetMetadataFlat(hashID)
+	metadata, revision, err := s.storage.GetMetadataRevision(hashID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -204,6 +228,7 @@ func (s *Server) handleGetMetadataByHashId(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	w.Header().Set("ETag", formatETag(revision))
 	response := MetadataResponse{
 		HashID:   hashID,
 		Metadata: metadata,
@@ -236,7 +261,11 @@ func (s *Server) handleUpdateMetadataByHashId(w http.ResponseWriter, r *http.Req
 	// Exclude internal processing status field
 	delete(metadata, "processingStatus")
 
-	if err := s.storage.SetMetadataFlat(hashID, metadata); err != nil {
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Set: metadata}); !ok {
+			return
+		}
+	} else if err := s.writer(r).SetMetadataFlat(hashID, metadata); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -263,10 +292,19 @@ func (s *Server) handleDeleteMetadataByHashId(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	deletedCount, err := s.storage.DeleteMetadata(hashID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	var deletedCount int64
+	if r.Header.Get("If-Match") != "" {
+		before, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Delete: true})
+		if !ok {
+			return
+		}
+		deletedCount = int64(len(before))
+	} else {
+		var err error
+		if deletedCount, err = s.writer(r).DeleteMetadata(hashID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -341,7 +379,11 @@ func (s *Server) handleMetadataUpdateProperty(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := s.storage.SetProperty(hashID, req.Property, req.Value); err != nil {
+	if r.Header.Get("If-Match") != "" {
+		if _, ok := s.writeIfMatch(w, r, storage.BatchOp{HashID: hashID, Set: map[string]string{req.Property: req.Value}}); !ok {
+			return
+		}
+	} else if err := s.writer(r).SetProperty(hashID, req.Property, req.Value); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -395,79 +437,312 @@ func (s *Server) handleSearchMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all hash IDs
-	allHashIDs, err := s.storage.GetAllHashIDs()
+	var filter *Filter
+	if req.Filter != "" {
+		parsed, err := ParseFilter(req.Filter)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+			return
+		}
+		filter = parsed
+	}
+
+	sortKeys, err := ParseSort(req.Sort)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	// Without usable indexes every file is checked with substring matching
+	legacy := false
+	hashIDs, err := s.searchHashIDs(req, filter)
+	if errors.Is(err, storage.ErrNotIndexed) {
+		legacy = true
+		hashIDs, err = s.storage.GetAllHashIDs()
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	var results []MetadataSearchResult
-	total := len(allHashIDs)
+	// Index lookups are unordered; sort so repeated searches agree
+	sort.Strings(hashIDs)
 
-	// Search fields for query
-	searchFields := []string{"title", "fileName", "originaltitle", "showtitle", "filePath"}
+	// The candidates are the results, so only the requested page is read
+	if !legacy && filter == nil && len(sortKeys) == 0 {
+		page := paginate(hashIDs, req.Offset, req.Limit)
+		metadataByID, err := s.storage.GetMetadataFlatMulti(page)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 
-	for _, hashID := range allHashIDs {
-		if len(results) >= req.Limit {
-			break
+		results := make([]MetadataSearchResult, 0)
+		for _, hashID := range page {
+			metadata, ok := metadataByID[hashID]
+			if !ok {
+				continue
+			}
+			results = append(results, MetadataSearchResult{
+				HashID:   hashID,
+				Metadata: metadata,
+			})
 		}
 
-		metadata, err := s.storage.GetMetadataFlat(hashID)
-		if err != nil || metadata == nil {
+		writeJSON(w, http.StatusOK, MetadataSearchResponse{
+			Results: results,
+			Count:   len(results),
+			Total:   len(hashIDs),
+		})
+		return
+	}
+
+	metadataByID, err := s.storage.GetMetadataFlatMulti(hashIDs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]MetadataSearchResult, 0)
+	for _, hashID := range hashIDs {
+		metadata, ok := metadataByID[hashID]
+		if !ok {
+			continue
+		}
+		if legacy && !legacyMatch(req, hashID, metadata) {
 			continue
 		}
+		if filter != nil && !filter.Match(metadata) {
+			continue
+		}
+		results = append(results, MetadataSearchResult{
+			HashID:   hashID,
+			Metadata: metadata,
+		})
+	}
 
-		matches := false
+	SortResults(results, sortKeys)
+	page := paginate(results, req.Offset, req.Limit)
 
-		// Property search
-		if req.Property != "" && req.PropertyValue != "" {
-			value, ok := metadata[req.Property]
-			if ok && strings.Contains(strings.ToLower(value), strings.ToLower(req.PropertyValue)) {
-				matches = true
-			}
+	writeJSON(w, http.StatusOK, MetadataSearchResponse{
+		Results: page,
+		Count:   len(page),
+		Total:   len(results),
+	})
+}
+
+// paginate returns the page of items starting at offset
+func paginate[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+// searchHashIDs resolves a search request to candidate hash IDs using the
+// secondary indexes. Returns storage.ErrNotIndexed if the request needs a
+// property that has no index or the indexes are not built yet.
+func (s *Server) searchHashIDs(req MetadataSearchRequest, filter *Filter) ([]string, error) {
+	// Property search: values starting with the given one (case-insensitive)
+	if req.Property != "" {
+		if req.PropertyValue == "" {
+			return []string{}, nil
 		}
+		return s.storage.FindByPropertyPrefix(req.Property, req.PropertyValue)
+	}
 
-		// General query search
-		if req.Query != "" && req.Property == "" {
-			queryLower := strings.ToLower(req.Query)
+	if req.Query == "" {
+		if filter != nil {
+			hashIDs, ok, err := s.filterCandidates(filter.root)
+			if err != nil || ok {
+				return hashIDs, err
+			}
+		}
+		return s.storage.GetAllHashIDs()
+	}
 
-			// Check if query matches hashId
-			if strings.Contains(strings.ToLower(hashID), queryLower) {
-				matches = true
+	// General query: every word must start a word of a text field
+	hashIDs, err := s.storage.SearchText(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(hashIDs))
+	for _, hashID := range hashIDs {
+		found[hashID] = true
+	}
+	add := func(matches []string) {
+		for _, hashID := range matches {
+			if !found[hashID] {
+				found[hashID] = true
+				hashIDs = append(hashIDs, hashID)
 			}
+		}
+	}
+
+	// A query that is itself a hash ID matches that file
+	if metadata, err := s.storage.GetMetadataFlat(req.Query); err == nil && metadata != nil {
+		add([]string{req.Query})
+	}
 
-			// Check search fields
-			if !matches {
-				for _, field := range searchFields {
-					if value, ok := metadata[field]; ok {
-						if strings.Contains(strings.ToLower(value), queryLower) {
-							matches = true
-							break
-						}
-					}
+	// So does the start of a hash ID, with or without its "midhash256:" prefix
+	if prefix, ok := hashIDPrefix(req.Query); ok {
+		matches, err := s.storage.FindHashIDsByPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		add(matches)
+	}
+	return hashIDs, nil
+}
+
+// minHashIDPrefix is the number of hex digits a query needs to be looked up
+// as the start of a hash ID without its prefix
+const minHashIDPrefix = 4
+
+// hashIDPrefix returns the hash ID prefix a search query stands for: the
+// query itself if it has a hash ID prefix ("midhash256:ab12"), or else the
+// query with the prefix if it is at least minHashIDPrefix hex digits
+func hashIDPrefix(query string) (string, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if strings.Contains(query, ":") {
+		return query, !strings.ContainsAny(query, " \t")
+	}
+	if len(query) < minHashIDPrefix {
+		return "", false
+	}
+	for _, r := range query {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return "", false
+		}
+	}
+	return midhash.Prefix + query, true
+}
+
+// filterCandidates narrows a filter to the files the value indexes say can
+// match it. Returns false if the filter has to be checked against every file.
+func (s *Server) filterCandidates(n *filterNode) ([]string, bool, error) {
+	switch n.kind {
+	case "cmp":
+		field, value, ok := n.indexedEquality()
+		if !ok {
+			return nil, false, nil
+		}
+		hashIDs, err := s.storage.FindByProperty(field, value)
+		if errors.Is(err, storage.ErrNotIndexed) {
+			return nil, false, nil
+		}
+		return hashIDs, err == nil, err
+
+	case "and":
+		// Any indexed term bounds the result
+		var candidates map[string]struct{}
+		for _, child := range n.children {
+			hashIDs, ok, err := s.filterCandidates(child)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				continue
+			}
+			next := make(map[string]struct{}, len(hashIDs))
+			for _, hashID := range hashIDs {
+				if _, in := candidates[hashID]; candidates == nil || in {
+					next[hashID] = struct{}{}
 				}
 			}
+			candidates = next
 		}
-
-		// If no query or property filter, return all
-		if req.Query == "" && req.Property == "" {
-			matches = true
+		if candidates == nil {
+			return nil, false, nil
 		}
+		return setKeys(candidates), true, nil
+
+	case "or":
+		// Every alternative must be indexed
+		candidates := make(map[string]struct{})
+		for _, child := range n.children {
+			hashIDs, ok, err := s.filterCandidates(child)
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			for _, hashID := range hashIDs {
+				candidates[hashID] = struct{}{}
+			}
+		}
+		return setKeys(candidates), true, nil
+	}
 
-		if matches {
-			results = append(results, MetadataSearchResult{
-				HashID:   hashID,
-				Metadata: metadata,
-			})
+	return nil, false, nil
+}
+
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// legacyMatch applies the matching of searchHashIDs to one file, for
+// searches that cannot be served from the secondary indexes, so a search
+// finds the same files whether or not the indexes are built
+func legacyMatch(req MetadataSearchRequest, hashID string, metadata map[string]string) bool {
+	// Property search: an element starting with the value
+	if req.Property != "" {
+		prefix := strings.ToLower(strings.TrimSpace(req.PropertyValue))
+		if req.PropertyValue == "" {
+			return false
+		}
+		for _, element := range storage.SplitSet(metadata[req.Property]) {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(element)), prefix) {
+				return true
+			}
 		}
+		return false
 	}
 
-	writeJSON(w, http.StatusOK, MetadataSearchResponse{
-		Results: results,
-		Count:   len(results),
-		Total:   total,
-	})
+	// If no query, return all
+	if req.Query == "" {
+		return true
+	}
+
+	// The hash ID, or its start
+	if hashID == req.Query {
+		return true
+	}
+	if prefix, ok := hashIDPrefix(req.Query); ok && strings.HasPrefix(hashID, prefix) {
+		return true
+	}
+
+	// Every query word starting a word of a text field
+	words := make(map[string]bool)
+	for _, field := range storage.TextFields {
+		for _, token := range storage.Tokenize(metadata[field]) {
+			words[token] = true
+		}
+	}
+	tokens := storage.Tokenize(req.Query)
+	for _, token := range tokens {
+		found := false
+		for word := range words {
+			if strings.HasPrefix(word, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(tokens) > 0
 }
 
 // handleBatchUpdate handles POST /api/metadata/batch
@@ -488,6 +763,11 @@ func (s *Server) handleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Atomic {
+		s.applyAtomicBatch(w, r, req.Updates)
+		return
+	}
+
 	var results []MetadataBatchResult
 	successCount := 0
 	errorCount := 0
@@ -503,26 +783,7 @@ func (s *Server) handleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		var updateErr error
-
-		// Update complete metadata
-		if update.Metadata != nil {
-			// Exclude internal processing status
-			delete(update.Metadata, "processingStatus")
-			updateErr = s.storage.SetMetadataFlat(update.HashID, update.Metadata)
-		}
-
-		// Update individual properties
-		if updateErr == nil && update.Properties != nil {
-			for property, value := range update.Properties {
-				if err := s.storage.SetProperty(update.HashID, property, value); err != nil {
-					updateErr = err
-					break
-				}
-			}
-		}
-
-		if updateErr != nil {
+		if updateErr := applyBatchItem(s.writer(r), update); updateErr != nil {
 			results = append(results, MetadataBatchResult{
 				HashID: update.HashID,
 				Status: "error",
@@ -547,6 +808,218 @@ func (s *Server) handleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// applyBatchItem applies one batch item with individual storage writes,
+// stopping at the first error
+func applyBatchItem(store storage.Store, update MetadataBatchItem) error {
+	if update.Delete {
+		if _, err := store.DeleteMetadata(update.HashID); err != nil {
+			return err
+		}
+	}
+
+	// Update complete metadata
+	if update.Metadata != nil {
+		// Exclude internal processing status
+		delete(update.Metadata, "processingStatus")
+		if err := store.SetMetadataFlat(update.HashID, update.Metadata); err != nil {
+			return err
+		}
+	}
+
+	// Update individual properties
+	for property, value := range update.Properties {
+		if err := store.SetProperty(update.HashID, property, value); err != nil {
+			return err
+		}
+	}
+
+	for _, property := range update.DeleteProperties {
+		if err := store.DeleteProperty(update.HashID, property); err != nil {
+			return err
+		}
+	}
+
+	for property, values := range update.AddToSet {
+		for _, value := range values {
+			if _, err := store.AddToSet(update.HashID, property, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for property, values := range update.RemoveFromSet {
+		for _, value := range values {
+			if _, err := store.RemoveFromSet(update.HashID, property, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyAtomicBatch applies every update in one transaction
+// Any failure leaves the metadata untouched and fails the whole request.
+func (s *Server) applyAtomicBatch(w http.ResponseWriter, r *http.Request, updates []MetadataBatchItem) {
+	ops := make([]storage.BatchOp, 0, len(updates))
+	for i, update := range updates {
+		if update.HashID == "" {
+			writeError(w, http.StatusBadRequest, "update "+strconv.Itoa(i)+": missing hash ID")
+			return
+		}
+
+		set := make(map[string]string, len(update.Metadata)+len(update.Properties))
+		for property, value := range update.Metadata {
+			// Exclude internal processing status
+			if property != "processingStatus" {
+				set[property] = value
+			}
+		}
+		for property, value := range update.Properties {
+			set[property] = value
+		}
+
+		ops = append(ops, storage.BatchOp{
+			HashID:        update.HashID,
+			IfRevision:    update.IfRevision,
+			Delete:        update.Delete,
+			Set:           set,
+			Unset:         update.DeleteProperties,
+			AddToSet:      update.AddToSet,
+			RemoveFromSet: update.RemoveFromSet,
+		})
+	}
+
+	revisions, err := s.writer(r).ApplyBatch(ops)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrRevisionMismatch) {
+			status = http.StatusPreconditionFailed
+		} else if errors.Is(err, storage.ErrConflict) || errors.Is(err, storage.ErrStaleEpoch) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, "batch not applied: "+err.Error())
+		return
+	}
+
+	results := make([]MetadataBatchResult, len(updates))
+	for i, update := range updates {
+		revision := revisions[update.HashID]
+		results[i] = MetadataBatchResult{HashID: update.HashID, Status: "ok", Revision: &revision}
+	}
+
+	writeJSON(w, http.StatusOK, MetadataBatchResponse{
+		Status:  "completed",
+		Total:   len(results),
+		Success: len(results),
+		Results: results,
+	})
+}
+
+// handleReindexMetadata handles POST /api/metadata/reindex
+func (s *Server) handleReindexMetadata(w http.ResponseWriter, r *http.Request) {
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	indexed, err := s.storage.RebuildIndexes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"message": "Indexes rebuilt",
+		"indexed": indexed,
+	})
+}
+
+// handleReindexCID handles POST /api/metadata/reindex/cid
+func (s *Server) handleReindexCID(w http.ResponseWriter, r *http.Request) {
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	indexed, err := s.storage.RebuildCIDIndex()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"message": "CID index rebuilt",
+		"indexed": indexed,
+	})
+}
+
+// handleReindexPaths handles POST /api/metadata/reindex/paths
+// Rebuilds the path index and orphan set from the stored metadata
+func (s *Server) handleReindexPaths(w http.ResponseWriter, r *http.Request) {
+	if !s.storage.IsConnected() {
+		writeError(w, http.StatusServiceUnavailable, "storage not connected")
+		return
+	}
+
+	indexed, err := s.storage.RebuildPathIndex()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "ok",
+		"message": "Path index rebuilt",
+		"indexed": indexed,
+	})
+}
+
+// ensureIndexes rebuilds the secondary, CID and path indexes if they were
+// built for a different configuration (or never). Runs on the leader.
+// Legacy set values are migrated first, as the indexes hold their elements.
+// Runs one at a time, so a leadership change during startup does not start
+// a second migration or rebuild.
+func (s *Server) ensureIndexes() {
+	s.ensureMu.Lock()
+	defer s.ensureMu.Unlock()
+
+	if _, err := s.storage.MigrateSetEncoding(); err != nil {
+		log.Printf("[API] Warning: failed to migrate set values: %v", err)
+	}
+
+	current, err := s.storage.IndexesCurrent()
+	if err != nil {
+		log.Printf("[API] Warning: failed to check indexes: %v", err)
+	} else if !current {
+		log.Println("[API] Indexes are missing or outdated, rebuilding...")
+		if _, err := s.storage.RebuildIndexes(); err != nil {
+			log.Printf("[API] Warning: failed to rebuild indexes: %v", err)
+		}
+	}
+
+	current, err = s.storage.CIDIndexCurrent()
+	if err != nil {
+		log.Printf("[API] Warning: failed to check CID index: %v", err)
+	} else if !current {
+		log.Println("[API] CID index is missing or outdated, rebuilding...")
+		if _, err := s.storage.RebuildCIDIndex(); err != nil {
+			log.Printf("[API] Warning: failed to rebuild CID index: %v", err)
+		}
+	}
+
+	current, err = s.storage.PathIndexCurrent()
+	if err != nil {
+		log.Printf("[API] Warning: failed to check path index: %v", err)
+	} else if !current {
+		log.Println("[API] Path index is missing or outdated, rebuilding...")
+		if _, err := s.storage.RebuildPathIndex(); err != nil {
+			log.Printf("[API] Warning: failed to rebuild path index: %v", err)
+		}
+	}
+}
+
 // handleClearMetadata handles POST /api/metadata/clear
 func (s *Server) handleClearMetadata(w http.ResponseWriter, r *http.Request) {
 	if !s.storage.IsConnected() {
@@ -554,9 +1027,13 @@ func (s *Server) handleClearMetadata(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedCount, err := s.storage.ClearAllMetadata()
+	deletedCount, err := s.writer(r).ClearAllMetadata()
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrConflict) || errors.Is(err, storage.ErrStaleEpoch) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
 		return
 	}
 
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// Filter is a parsed search filter, evaluated against flat metadata maps
+//
+// Grammar (keywords are case-insensitive, adjacent terms are ANDed):
+//
+//	expr       := or
+//	or         := and ("OR" and)*
+//	and        := unary (["AND"] unary)*
+//	unary      := "NOT" unary | "(" expr ")" | "EXISTS" field | comparison
+//	comparison := field op value
+//	op         := "=" | "!=" | "^=" (prefix) | "~" (contains) | "<" | "<=" | ">" | ">="
+//
+// Values are bare words or double-quoted strings. String comparisons are
+// case-insensitive; = and != also match single elements of pipe-delimited
+// set fields. Ordering operators compare numerically when both sides are
+// numbers (with optional KB/MB/GB/TB or KiB/MiB/GiB/TiB size suffixes) and
+// as strings otherwise.
+type Filter struct {
+	root *filterNode
+}
+
+// filterNode is a node of the filter tree
+type filterNode struct {
+	kind     string // "and", "or", "not", "exists" or "cmp"
+	children []*filterNode
+	field    string
+	op       string
+	value    string
+	number   float64
+	numeric  bool // value parsed as a number
+}
+
+// SortKey is a field results are ordered by
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// sizeUnits are the size suffixes accepted in numeric values
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(input string) (*Filter, error) {
+	tokens, err := lexFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty filter")
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match returns true if the metadata satisfies the filter
+func (f *Filter) Match(metadata map[string]string) bool {
+	return f.root.match(metadata)
+}
+
+func (n *filterNode) match(metadata map[string]string) bool {
+	switch n.kind {
+	case "and":
+		for _, child := range n.children {
+			if !child.match(metadata) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, child := range n.children {
+			if child.match(metadata) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !n.children[0].match(metadata)
+	case "exists":
+		value, ok := metadata[n.field]
+		return ok && value != ""
+	}
+
+	value, ok := metadata[n.field]
+	if !ok {
+		return n.op == "!="
+	}
+
+	switch n.op {
+	case "=":
+		return equalsValue(value, n.value)
+	case "!=":
+		return !equalsValue(value, n.value)
+	case "^=":
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(n.value))
+	case "~":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(n.value))
+	}
+
+	var cmp int
+	if number, ok := parseNumber(value); ok && n.numeric {
+		cmp = compareFloats(number, n.number)
+	} else {
+		cmp = strings.Compare(strings.ToLower(value), strings.ToLower(n.value))
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// equalsValue compares case-insensitively against the whole value or any
+// element of a set
+func equalsValue(value, want string) bool {
+	if strings.EqualFold(value, want) {
+		return true
+	}
+	for _, element := range storage.SplitSet(value) {
+		if strings.EqualFold(strings.TrimSpace(element), want) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number with an optional size suffix (e.g. 4GB)
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	end := len(s)
+	for end > 0 && unicode.IsLetter(rune(s[end-1])) {
+		end--
+	}
+
+	multiplier := 1.0
+	if suffix := strings.ToLower(s[end:]); suffix != "" {
+		unit, ok := sizeUnits[suffix]
+		if !ok {
+			return 0, false
+		}
+		multiplier = unit
+	}
+
+	number, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return 0, false
+	}
+	return number * multiplier, true
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// indexedEquality returns the field and value if the node is an equality
+// comparison that a value index can answer
+func (n *filterNode) indexedEquality() (string, string, bool) {
+	if n.kind == "cmp" && n.op == "=" && !strings.Contains(n.value, "|") {
+		return n.field, n.value, true
+	}
+	return "", "", false
+}
+
+// filterToken is a lexical token of a filter expression
+type filterToken struct {
+	text   string
+	quoted bool // A quoted string, never a keyword or operator
+}
+
+// filterOperators are the comparison operators, longest first
+var filterOperators = []string{"!=", "<=", ">=", "^=", "=", "<", ">", "~"}
+
+// lexFilter splits a filter expression into tokens
+func lexFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(input) && input[j] != '"'; j++ {
+				if input[j] == '\\' && j+1 < len(input) {
+					j++
+				}
+				b.WriteByte(input[j])
+			}
+			if j >= len(input) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, filterToken{text: b.String(), quoted: true})
+			i = j + 1
+		default:
+			if op := operatorAt(input[i:]); op != "" {
+				tokens = append(tokens, filterToken{text: op})
+				i += len(op)
+				continue
+			}
+			j := i
+			for j < len(input) && !strings.ContainsRune(" \t\n\r()\"", rune(input[j])) && operatorAt(input[j:]) == "" {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: input[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// operatorAt returns the operator at the start of s, if any
+func operatorAt(s string) string {
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// filterParser is a recursive descent parser over filter tokens
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+// keyword returns true and consumes the next token if it is the keyword
+func (p *filterParser) keyword(word string) bool {
+	if p.done() || p.peek().quoted || !strings.EqualFold(p.peek().text, word) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// punct returns true and consumes the next token if it is the punctuation
+func (p *filterParser) punct(text string) bool {
+	if p.done() || p.peek().quoted || p.peek().text != text {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *filterParser) parseOr() (*filterNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []*filterNode{node}
+	for p.keyword("OR") {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &filterNode{kind: "or", children: children}, nil
+}
+
+func (p *filterParser) parseAnd() (*filterNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []*filterNode{node}
+	for !p.done() {
+		if !p.keyword("AND") {
+			// Implicit AND, unless the expression or group ends here
+			next := p.peek()
+			if !next.quoted && (next.text == ")" || strings.EqualFold(next.text, "OR")) {
+				break
+			}
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return &filterNode{kind: "and", children: children}, nil
+}
+
+func (p *filterParser) parseUnary() (*filterNode, error) {
+	if p.done() {
+		return nil, errors.New("unexpected end of filter")
+	}
+
+	if p.keyword("NOT") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNode{kind: "not", children: []*filterNode{node}}, nil
+	}
+
+	if p.punct("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punct(")") {
+			return nil, errors.New("missing )")
+		}
+		return node, nil
+	}
+
+	if p.keyword("EXISTS") {
+		field, err := p.operand("field")
+		if err != nil {
+			return nil, err
+		}
+		return &filterNode{kind: "exists", field: field}, nil
+	}
+
+	field, err := p.operand("field")
+	if err != nil {
+		return nil, err
+	}
+	if p.done() || p.peek().quoted || operatorAt(p.peek().text) != p.peek().text {
+		return nil, fmt.Errorf("expected operator after %q", field)
+	}
+	op := p.peek().text
+	p.pos++
+
+	value, err := p.operand("value")
+	if err != nil {
+		return nil, err
+	}
+
+	node := &filterNode{kind: "cmp", field: field, op: op, value: value}
+	node.number, node.numeric = parseNumber(value)
+	return node, nil
+}
+
+// operand consumes a field name or value
+func (p *filterParser) operand(what string) (string, error) {
+	if p.done() {
+		return "", fmt.Errorf("expected %s", what)
+	}
+	token := p.peek()
+	if !token.quoted && (token.text == "(" || token.text == ")" || operatorAt(token.text) != "") {
+		return "", fmt.Errorf("expected %s, got %q", what, token.text)
+	}
+	p.pos++
+	return token.text, nil
+}
+
+// ParseSort parses a sort specification: comma-separated fields, each
+// optionally prefixed with - for descending order (e.g. "-year,title")
+func ParseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: part}
+		if strings.HasPrefix(part, "-") {
+			key = SortKey{Field: strings.TrimSpace(part[1:]), Desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			key.Field = strings.TrimSpace(part[1:])
+		}
+		if key.Field == "" {
+			return nil, fmt.Errorf("invalid sort field %q", part)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// SortResults orders results by the sort keys, then by hash ID so the order
+// is stable across requests. Files missing a sort field come last.
+func SortResults(results []MetadataSearchResult, keys []SortKey) {
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, key := range keys {
+			a, aok := results[i].Metadata[key.Field]
+			b, bok := results[j].Metadata[key.Field]
+			if aok != bok {
+				return aok
+			}
+			if !aok {
+				continue
+			}
+
+			cmp := compareValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if key.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return results[i].HashID < results[j].HashID
+	})
+}
+
+// compareValues compares numerically if both values are numbers and
+// case-insensitively as strings otherwise
+func compareValues(a, b string) int {
+	if x, ok := parseNumber(a); ok {
+		if y, ok := parseNumber(b); ok {
+			return compareFloats(x, y)
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
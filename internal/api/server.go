@@ -5,30 +5,42 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/backup"
 	"github.com/metazla/meta-core/internal/config"
 	"github.com/metazla/meta-core/internal/discovery"
+	"github.com/metazla/meta-core/internal/jobs"
 	"github.com/metazla/meta-core/internal/leader"
 	"github.com/metazla/meta-core/internal/mounts"
+	"github.com/metazla/meta-core/internal/orphans"
 	"github.com/metazla/meta-core/internal/storage"
 	"github.com/metazla/meta-core/internal/watcher"
 )
 
 // Server is the HTTP API server for meta-core
 type Server struct {
-	config          *config.Config
-	election        *leader.Election
-	discovery       *discovery.Service
-	storage         *storage.Client
-	mountsManager   *mounts.Manager
-	mountsHandlers  *mounts.Handlers
+	config            *config.Config
+	election          *leader.Election
+	discovery         *discovery.Service
+	storage           storage.Store
+	mountsManager     *mounts.Manager
+	mountsHandlers    *mounts.Handlers
+	backupManager     *backup.Manager
+	backupHandlers    *backup.Handlers
+	jobsManager       *jobs.Manager
+	jobsHandlers      *jobs.Handlers
+	orphanCollector   *orphans.Collector
+	orphanHandlers    *orphans.Handlers
 	watcherDispatcher *watcher.Dispatcher
-	fileWatcher     *watcher.Watcher
-	watcherHandlers *watcher.Handlers
-	router          *mux.Router
-	server          *http.Server
+	fileWatcher       *watcher.Watcher
+	watcherHandlers   *watcher.Handlers
+	leaderEvents      *leaderEventHub
+	router            *mux.Router
+	server            *http.Server
+	ensureMu          sync.Mutex // Serializes ensureIndexes runs
 }
 
 // NewServer creates a new API server
@@ -36,14 +48,15 @@ func NewServer(
 	cfg *config.Config,
 	election *leader.Election,
 	disc *discovery.Service,
-	stor *storage.Client,
+	stor storage.Store,
 ) *Server {
 	s := &Server{
-		config:    cfg,
-		election:  election,
-		discovery: disc,
-		storage:   stor,
-		router:    mux.NewRouter(),
+		config:       cfg,
+		election:     election,
+		discovery:    disc,
+		storage:      stor,
+		router:       mux.NewRouter(),
+		leaderEvents: newLeaderEventHub(),
 	}
 
 	// Initialize mounts manager
@@ -55,15 +68,52 @@ func NewServer(
 		s.mountsHandlers = mounts.NewHandlers(mountsManager)
 	}
 
+	// Initialize backup manager
+	backupManager, err := backup.NewManager(cfg, election, stor)
+	if err != nil {
+		log.Printf("[API] Warning: failed to initialize backup manager: %v", err)
+	} else {
+		s.backupManager = backupManager
+		s.backupHandlers = backup.NewHandlers(backupManager)
+	}
+
+	s.jobsManager = jobs.NewManager(cfg)
+	s.jobsHandlers = jobs.NewHandlers(s.jobsManager)
+
+	// The dispatcher also delivers leadership events, so it exists even
+	// when the file watcher is disabled
+	s.watcherDispatcher = watcher.NewDispatcher()
+
 	// Initialize file watcher (if enabled)
 	if cfg.EnableFileWatcher && len(cfg.WatchFolderList) > 0 {
-		s.watcherDispatcher = watcher.NewDispatcher()
 		fileWatcher, err := watcher.NewWatcher(cfg, s.watcherDispatcher)
 		if err != nil {
 			log.Printf("[API] Warning: failed to initialize file watcher: %v", err)
 		} else {
 			s.fileWatcher = fileWatcher
-			s.watcherHandlers = watcher.NewHandlers(fileWatcher, s.watcherDispatcher)
+		}
+	}
+	s.watcherHandlers = watcher.NewHandlers(s.fileWatcher, s.watcherDispatcher)
+
+	// Track files deleted and moved on disk
+	s.orphanCollector = orphans.NewCollector(cfg, election, stor)
+	s.orphanHandlers = orphans.NewHandlers(s.orphanCollector)
+	s.watcherDispatcher.Listen(s.orphanCollector.HandleEvent)
+
+	// Publish leadership transitions to SSE clients and webhook subscribers
+	if election != nil {
+		election.Subscribe(func(event leader.LeadershipEvent) {
+			s.leaderEvents.publish(event)
+			s.watcherDispatcher.DispatchEvent(LeaderEventType, event)
+			if event.Type == leader.EventBecameLeader {
+				go s.ensureIndexes()
+			}
+		})
+
+		// Election starts before the API server, so the first leader
+		// transition may already have happened
+		if election.IsLeader() {
+			go s.ensureIndexes()
 		}
 	}
 
@@ -77,14 +127,24 @@ func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
 	s.router.HandleFunc("/status", s.handleStatus).Methods("GET")
 	s.router.HandleFunc("/leader", s.handleLeader).Methods("GET")
+	s.router.HandleFunc("/leader/step-down", s.handleStepDown).Methods("POST")
+	s.router.HandleFunc("/api/leader/events", s.handleLeaderEvents).Methods("GET")
 	s.router.HandleFunc("/role", s.handleRole).Methods("GET")
 
 	// Metadata Editor API routes (must be before /meta/{hash} routes)
 	s.router.HandleFunc("/api/metadata/hash-ids", s.handleGetHashIds).Methods("GET")
 	s.router.HandleFunc("/api/metadata/list", s.handleListMetadata).Methods("GET")
 	s.router.HandleFunc("/api/metadata/search", s.handleSearchMetadata).Methods("POST")
+	s.router.HandleFunc("/api/metadata/fulltext", s.handleFullTextSearch).Methods("GET")
 	s.router.HandleFunc("/api/metadata/batch", s.handleBatchUpdate).Methods("POST")
 	s.router.HandleFunc("/api/metadata/clear", s.handleClearMetadata).Methods("POST")
+	s.router.HandleFunc("/api/metadata/reindex", s.handleReindexMetadata).Methods("POST")
+	s.router.HandleFunc("/api/metadata/reindex/cid", s.handleReindexCID).Methods("POST")
+	s.router.HandleFunc("/api/metadata/reindex/paths", s.handleReindexPaths).Methods("POST")
+	s.router.HandleFunc("/api/metadata/history", s.handleGetGlobalHistory).Methods("GET")
+	s.router.HandleFunc("/api/metadata/changes", s.handleMetadataChanges).Methods("GET")
+	s.router.HandleFunc("/api/metadata/{hashId}/history", s.handleGetHistory).Methods("GET")
+	s.router.HandleFunc("/api/metadata/{hashId}/revert", s.handleRevertMetadata).Methods("POST")
 	s.router.HandleFunc("/api/metadata/{hashId}/property", s.handleMetadataGetProperty).Methods("GET")
 	s.router.HandleFunc("/api/metadata/{hashId}/property", s.handleMetadataUpdateProperty).Methods("PUT")
 	s.router.HandleFunc("/api/metadata/{hashId}", s.handleGetMetadataByHashId).Methods("GET")
@@ -105,19 +165,24 @@ func (s *Server) setupRoutes() {
 
 	// Metadata operations - set operations (must be before property routes)
 	s.router.HandleFunc("/meta/{hash}/_add/{key:.*}", s.handleAddToSet).Methods("POST")
+	s.router.HandleFunc("/meta/{hash}/_remove/{key:.*}", s.handleRemoveFromSet).Methods("POST")
 
 	// Metadata operations - property-level (key can contain slashes)
 	s.router.HandleFunc("/meta/{hash}/{key:.*}", s.handleGetProperty).Methods("GET")
 	s.router.HandleFunc("/meta/{hash}/{key:.*}", s.handlePutProperty).Methods("PUT")
 	s.router.HandleFunc("/meta/{hash}/{key:.*}", s.handleDeleteProperty).Methods("DELETE")
 
-	// Data operations
+	// Data operations (by-path must be before /data/{hash} routes)
+	s.router.HandleFunc("/data/by-path", s.handleGetDataByPath).Methods("GET")
 	s.router.HandleFunc("/data/{hash}/path", s.handleGetDataPath).Methods("GET")
+	s.router.HandleFunc("/data/{hash}/verify", s.handleVerifyData).Methods("GET")
 	s.router.HandleFunc("/data/{hash}", s.handleHeadData).Methods("HEAD")
 
 	// File operations (by CID)
+	s.router.HandleFunc("/file/car", s.handleExportFileCAR).Methods("GET")
 	s.router.HandleFunc("/file/{cid}", s.handleGetFileByCID).Methods("GET")
 	s.router.HandleFunc("/file/cid", s.handleComputeFileCID).Methods("POST")
+	s.router.HandleFunc("/file/hash", s.handleComputeFileHash).Methods("POST")
 
 	// Service discovery
 	s.router.HandleFunc("/services", s.handleListServices).Methods("GET")
@@ -129,13 +194,27 @@ func (s *Server) setupRoutes() {
 		log.Println("[API] Mount management routes registered at /api/mounts/*")
 	}
 
+	// Backup routes (if manager initialized)
+	if s.backupHandlers != nil {
+		s.backupHandlers.RegisterRoutes(s.router)
+		log.Println("[API] Backup routes registered at /api/backups/*")
+	}
+
+	s.jobsHandlers.RegisterRoutes(s.router)
+	log.Println("[API] Job routes registered at /api/jobs/*")
+
+	s.orphanHandlers.RegisterRoutes(s.router)
+	log.Println("[API] Orphan routes registered at /api/orphans/*")
+
 	log.Println("[API] Metadata Editor routes registered at /api/metadata/*")
 	log.Println("[API] KV Browser routes registered at /api/kv/*")
 
-	// File watcher routes (if watcher initialized)
-	if s.watcherHandlers != nil {
-		s.watcherHandlers.RegisterRoutes(s.router)
+	// Event subscription and file watcher routes
+	s.watcherHandlers.RegisterRoutes(s.router)
+	if s.fileWatcher != nil {
 		log.Println("[API] File watcher routes registered at /api/events/*, /api/scan/*")
+	} else {
+		log.Println("[API] Event subscription routes registered at /api/events/* (file watcher disabled)")
 	}
 
 	// Add middleware
@@ -143,6 +222,11 @@ func (s *Server) setupRoutes() {
 	s.router.Use(corsMiddleware)
 }
 
+// Handler returns the router serving the API
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
 // Start starts the HTTP server
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.config.HTTPHost, s.config.HTTPPort)
@@ -170,11 +254,27 @@ func (s *Server) Start() error {
 		}
 	}
 
+	// Start scheduled backups (if initialized)
+	if s.backupManager != nil {
+		s.backupManager.Start()
+	}
+
+	s.jobsManager.Start()
+	s.orphanCollector.Start()
+
 	return nil
 }
 
 // Stop gracefully stops the HTTP server
 func (s *Server) Stop() error {
+	// Stop scheduled backups
+	if s.backupManager != nil {
+		s.backupManager.Stop()
+	}
+
+	s.jobsManager.Stop()
+	s.orphanCollector.Stop()
+
 	// Stop file watcher
 	if s.fileWatcher != nil {
 		if err := s.fileWatcher.Stop(); err != nil {
@@ -207,8 +307,9 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-Match, X-Service-Name, Last-Event-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/leader"
+)
+
+// restoreTimeout bounds a restore, which outlives the server's write timeout
+const restoreTimeout = 5 * time.Minute
+
+// Handlers provides HTTP handlers for backup operations
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new backup handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers all backup-related routes
+func (h *Handlers) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/backups", h.handleListBackups).Methods("GET")
+	r.HandleFunc("/api/backups", h.handleCreateBackup).Methods("POST")
+	r.HandleFunc("/api/backups/{id}/restore", h.handleRestoreBackup).Methods("POST")
+}
+
+// handleListBackups handles GET /api/backups
+func (h *Handlers) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.manager.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, BackupsListResponse{
+		Backups: backups,
+		Count:   len(backups),
+	})
+}
+
+// handleCreateBackup handles POST /api/backups
+func (h *Handlers) handleCreateBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.manager.Create(r.Context(), ReasonManual)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, backup)
+}
+
+// handleRestoreBackup handles POST /api/backups/{id}/restore
+func (h *Handlers) handleRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// Loading a large snapshot can take longer than the write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(restoreTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	result, err := h.manager.Restore(ctx, id)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeManagerError maps manager errors to HTTP status codes
+func writeManagerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, leader.ErrNotLeader):
+		writeError(w, http.StatusConflict, "backups are taken by the leader")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Helper functions
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"error":   http.StatusText(status),
+		"message": message,
+	})
+}
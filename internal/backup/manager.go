@@ -0,0 +1,294 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// idTimeFormat is the timestamp part of a backup ID (UTC, sortable)
+const idTimeFormat = "20060102-150405.000"
+
+// ErrNotFound is returned when a backup ID does not exist
+var ErrNotFound = errors.New("backup not found")
+
+// idPattern matches backup IDs; it also guards against path traversal
+var idPattern = regexp.MustCompile(`^(\d{8}-\d{6}\.\d{3})-(scheduled|manual|pre-restore)$`)
+
+// Manager takes scheduled and on-demand snapshots of the leader's Redis
+// Backups are RDB files in the backups directory on the shared volume, so
+// every node can list them but only the leader creates or restores them.
+// In embedded mode they are embedded snapshots with a .snapshot extension;
+// backups in the other format are not listed, so they cannot be restored.
+type Manager struct {
+	config     *config.Config
+	election   *leader.Election
+	store      storage.Store // Told about restores, nil if there is none
+	backupsDir string
+	ext        string     // Backup file extension, taken from the snapshot file
+	mu         sync.Mutex // Serializes backups and restores
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewManager creates a new backup manager
+func NewManager(cfg *config.Config, election *leader.Election, store storage.Store) (*Manager, error) {
+	m := &Manager{
+		config:     cfg,
+		election:   election,
+		store:      store,
+		backupsDir: cfg.BackupsDir(),
+		ext:        filepath.Ext(election.SnapshotPath()),
+		stopChan:   make(chan struct{}),
+	}
+
+	if err := os.MkdirAll(m.backupsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backups directory: %w", err)
+	}
+
+	return m, nil
+}
+
+// Start runs scheduled backups in the background
+func (m *Manager) Start() {
+	if m.config.BackupIntervalMS <= 0 {
+		log.Println("[Backup] Scheduled backups disabled")
+		return
+	}
+
+	interval := time.Duration(m.config.BackupIntervalMS) * time.Millisecond
+	log.Printf("[Backup] Scheduled backups every %s, keeping %d", interval, m.config.BackupRetention)
+
+	m.wg.Add(1)
+	go m.scheduleLoop(interval)
+}
+
+// Stop stops scheduled backups
+func (m *Manager) Stop() {
+	close(m.stopChan)
+	m.wg.Wait()
+}
+
+// scheduleLoop takes a backup on every tick while this instance is leader
+func (m *Manager) scheduleLoop(interval time.Duration) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			if !m.election.IsLeader() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			if _, err := m.Create(ctx, ReasonScheduled); err != nil {
+				log.Printf("[Backup] Scheduled backup failed: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Create snapshots Redis and copies the snapshot into the backups directory
+// Returns leader.ErrNotLeader on followers
+func (m *Manager) Create(ctx context.Context, reason Reason) (*Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup, err := m.create(ctx, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	m.prune()
+	return backup, nil
+}
+
+// create takes a backup (caller must hold the lock)
+func (m *Manager) create(ctx context.Context, reason Reason) (*Backup, error) {
+	if err := m.election.Snapshot(ctx); err != nil {
+		return nil, err
+	}
+
+	id := time.Now().UTC().Format(idTimeFormat) + "-" + string(reason)
+	if err := copyFile(m.election.SnapshotPath(), m.path(id)); err != nil {
+		return nil, fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+
+	backup, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Backup] Created backup %s (%d bytes)", id, backup.Size)
+	return backup, nil
+}
+
+// Restore restarts the leader's Redis from a backup
+// The current state is backed up first so the restore can be undone. The
+// restore rolls the history and the change feed back too, so it is recorded
+// in both: feed consumers get a "restore" event telling them to resynchronize.
+func (m *Manager) Restore(ctx context.Context, id string) (*RestoreResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	preRestore, err := m.create(ctx, ReasonPreRestore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up current state: %w", err)
+	}
+
+	log.Printf("[Backup] Restoring backup %s", id)
+	if err := m.election.RestoreSnapshot(ctx, m.path(id)); err != nil {
+		return nil, err
+	}
+	if m.store != nil {
+		if err := m.store.RecordRestore(); err != nil {
+			log.Printf("[Backup] Warning: failed to record restore of %s: %v", id, err)
+		}
+	}
+
+	return &RestoreResponse{Restored: *backup, PreRestore: *preRestore}, nil
+}
+
+// List returns all backups, newest first
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.backupsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Backup, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), m.ext)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		backup, err := m.Get(id)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, *backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID > backups[j].ID
+	})
+	return backups, nil
+}
+
+// Get returns a backup by ID
+func (m *Manager) Get(id string) (*Backup, error) {
+	match := idPattern.FindStringSubmatch(id)
+	if match == nil {
+		return nil, ErrNotFound
+	}
+
+	stat, err := os.Stat(m.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	createdAt, err := time.Parse(idTimeFormat, match[1])
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	return &Backup{
+		ID:        id,
+		Reason:    Reason(match[2]),
+		CreatedAt: createdAt.UnixMilli(),
+		Size:      stat.Size(),
+	}, nil
+}
+
+// prune removes the oldest backups beyond the retention counts. Pre-restore
+// backups are counted apart from the others, so scheduled backups never push
+// out the undo of a restore. (caller must hold the lock)
+func (m *Manager) prune() {
+	backups, err := m.List()
+	if err != nil {
+		log.Printf("[Backup] Failed to list backups for retention: %v", err)
+		return
+	}
+
+	kept := make(map[bool]int) // Backups kept so far, by whether pre-restore
+	for _, backup := range backups {
+		preRestore := backup.Reason == ReasonPreRestore
+		retention := m.config.BackupRetention
+		if preRestore {
+			retention = m.config.PreRestoreRetention
+		}
+		if retention <= 0 || kept[preRestore] < retention {
+			kept[preRestore]++
+			continue
+		}
+
+		if err := os.Remove(m.path(backup.ID)); err != nil {
+			log.Printf("[Backup] Failed to remove %s: %v", backup.ID, err)
+			continue
+		}
+		log.Printf("[Backup] Removed expired backup %s", backup.ID)
+	}
+}
+
+// path returns the file path of a backup
+func (m *Manager) path(id string) string {
+	return filepath.Join(m.backupsDir, id+m.ext)
+}
+
+// copyFile copies src to dst through a temp file so dst is never partial
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tempPath := dst + ".tmp"
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, dst)
+}
@@ -0,0 +1,30 @@
+package backup
+
+// Reason describes why a backup was taken
+type Reason string
+
+const (
+	ReasonScheduled  Reason = "scheduled"
+	ReasonManual     Reason = "manual"
+	ReasonPreRestore Reason = "pre-restore" // Taken automatically before a restore
+)
+
+// Backup describes a Redis snapshot in the backups directory
+type Backup struct {
+	ID        string `json:"id"`
+	Reason    Reason `json:"reason"`
+	CreatedAt int64  `json:"createdAt"` // Unix ms
+	Size      int64  `json:"size"`
+}
+
+// BackupsListResponse is the response for listing backups
+type BackupsListResponse struct {
+	Backups []Backup `json:"backups"`
+	Count   int      `json:"count"`
+}
+
+// RestoreResponse is the response for a completed restore
+type RestoreResponse struct {
+	Restored   Backup `json:"restored"`
+	PreRestore Backup `json:"preRestore"` // Snapshot of the state that was replaced
+}
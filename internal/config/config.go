@@ -1,7 +1,14 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -11,6 +18,7 @@ type Config struct {
 	// Core paths
 	MetaCorePath string // Path to meta-core volume (default: /meta-core)
 	FilesPath    string // Path to files volume (default: /files)
+	ConfigFile   string // Optional JSON config file (default: /meta-core/config.json)
 
 	// Service identification
 	ServiceName    string // Service name (e.g., "meta-sort", "meta-fuse")
@@ -18,17 +26,65 @@ type Config struct {
 	APIPort        int    // Service HTTP port (for leader info)
 	BaseURL        string // Base URL for stable service discovery
 
+	// Leader lock configuration
+	LockBackend    string // Lock backend: "flock" or "lease" (default: "flock")
+	LockLeaseTTLMS int    // Lease TTL in ms for the lease backend (default: 15000)
+
 	// Redis configuration
-	RedisPort int // Redis port (default: 6379)
+	RedisMode        string // Redis mode: "external" or "embedded" (default: "external")
+	RedisPort        int    // Redis port (default: 6379)
+	RedisReplication bool   // Followers run a local read replica of the leader (default: false)
+	RedisReplicaDir  string // Local (non-shared) data dir for the replica (default: /tmp/meta-core-replica)
+
+	// Redis security and persistence (env overrides the config file)
+	RedisBind            string   // Bind address (default: 0.0.0.0)
+	RedisUsername        string   // ACL user meta-core connects as (default: the default user)
+	RedisPassword        string   // Password for RedisUsername, or requirepass if no username is set
+	RedisACLUsers        []string // Additional ACL rules, e.g. "reader on >secret ~* +@read"
+	RedisMaxMemory       string   // maxmemory, e.g. "512mb" (default: unlimited)
+	RedisMaxMemoryPolicy string   // maxmemory-policy (default: noeviction)
+	RedisSave            string   // RDB save schedule, "none" disables snapshots (default: "60 1")
+	RedisAppendFsync     string   // AOF fsync mode: always, everysec or no (default: everysec)
+
+	// Redis crash handling
+	RedisRestartBackoffMS    int // Delay before the first restart after a crash (default: 1000)
+	RedisRestartBackoffMaxMS int // Upper bound for the doubling restart delay (default: 60000)
+	RedisCrashThreshold      int // Crashes within the window before the leader steps down, 0 disables (default: 5)
+	RedisCrashWindowMS       int // Window for counting crashes (default: 300000)
+
+	// Backup configuration
+	BackupIntervalMS    int // Scheduled backup interval in ms, 0 disables (default: 3600000)
+	BackupRetention     int // Number of scheduled and manual backups to keep (default: 24)
+	PreRestoreRetention int // Number of pre-restore backups to keep, counted separately (default: 5)
+
+	// Metadata search configuration
+	IndexedFields []string // Properties with a value index for search (default: type,year,genre)
+	CIDFields     []string // CID properties served by /file/{cid}, as "property[:pathProperty]" (default: poster,backdrop,subtitles,nfo,trailer)
+
+	// Metadata history configuration
+	HistoryLength       int // History entries kept per file, 0 disables (default: 100)
+	HistoryGlobalLength int // History entries kept across all files, 0 disables (default: 10000)
+	ChangeFeedLength    int // Change feed events kept for consumers to catch up, 0 keeps all (default: 10000)
+
+	// File job configuration
+	JobWorkers     int // Files hashed concurrently by digest jobs (default: 2)
+	JobQueueSize   int // Jobs waiting for a worker before new ones are refused (default: 100)
+	JobCacheSize   int // Digest results cached by path, size and mtime (default: 10000)
+	JobRetentionMS int // How long finished jobs can be polled in ms (default: 3600000)
+
+	// Orphan configuration
+	OrphanGCIntervalMS int // How often orphaned metadata is relinked or purged in ms, 0 disables (default: 3600000)
+	OrphanRetentionMS  int // How long orphaned metadata is kept before it is purged in ms, 0 keeps it (default: 604800000)
 
 	// HTTP API configuration
 	HTTPPort int    // HTTP API port (default: 9000)
 	HTTPHost string // HTTP API host (default: "127.0.0.1")
 
 	// Timing configuration
-	HealthCheckIntervalMS int // Health check interval in ms (default: 5000)
-	HeartbeatIntervalMS   int // Service heartbeat interval in ms (default: 30000)
-	StaleThresholdMS      int // Stale service threshold in ms (default: 60000)
+	HealthCheckIntervalMS  int // Health check interval in ms (default: 5000)
+	HeartbeatIntervalMS    int // Service heartbeat interval in ms (default: 30000)
+	StaleThresholdMS       int // Stale service threshold in ms (default: 60000)
+	LeaderStaleThresholdMS int // Leader info considered stale after this many ms (default: 15000)
 
 	// File watcher configuration
 	WatchFolderList   []string // List of folders to watch for file changes
@@ -40,30 +96,89 @@ type Config struct {
 	MountsDir string // Path to mounts configuration (default: /meta-core/mounts)
 }
 
-// Load creates a Config from environment variables
+// fileConfig is the layout of the optional JSON config file
+type fileConfig struct {
+	Redis struct {
+		Mode            string   `json:"mode"`
+		Bind            string   `json:"bind"`
+		Username        string   `json:"username"`
+		Password        string   `json:"password"`
+		ACLUsers        []string `json:"aclUsers"`
+		MaxMemory       string   `json:"maxmemory"`
+		MaxMemoryPolicy string   `json:"maxmemoryPolicy"`
+		Save            string   `json:"save"`
+		AppendFsync     string   `json:"appendfsync"`
+	} `json:"redis"`
+}
+
+// Load creates a Config from the config file and environment variables
+// Environment variables take precedence over the file
 func Load() *Config {
+	metaCorePath := getEnv("META_CORE_PATH", "/meta-core")
+	configFile := getEnv("META_CORE_CONFIG", metaCorePath+"/config.json")
+	file := loadFileConfig(configFile)
+
 	cfg := &Config{
-		MetaCorePath:          getEnv("META_CORE_PATH", "/meta-core"),
-		FilesPath:             getEnv("FILES_PATH", "/files"),
-		ServiceName:           getEnv("SERVICE_NAME", "meta-core"),
-		ServiceVersion:        getEnv("SERVICE_VERSION", "1.0.0"),
-		APIPort:               getEnvInt("API_PORT", 8180),
-		BaseURL:               getEnv("BASE_URL", ""),
-		RedisPort:             getEnvInt("REDIS_PORT", 6379),
-		HTTPPort:              getEnvInt("META_CORE_HTTP_PORT", 9000),
-		HTTPHost:              getEnv("META_CORE_HTTP_HOST", "127.0.0.1"),
-		HealthCheckIntervalMS: getEnvInt("HEALTH_CHECK_INTERVAL_MS", 5000),
-		HeartbeatIntervalMS:   getEnvInt("HEARTBEAT_INTERVAL_MS", 30000),
-		StaleThresholdMS:      getEnvInt("STALE_THRESHOLD_MS", 60000),
-		WatchIntervalMS:       getEnvInt("WATCH_INTERVAL_MS", 1000),
-		DebounceMS:            getEnvInt("DEBOUNCE_MS", 30000),
-		EnableFileWatcher:     getEnvBool("ENABLE_FILE_WATCHER", true),
+		MetaCorePath:             metaCorePath,
+		ConfigFile:               configFile,
+		FilesPath:                getEnv("FILES_PATH", "/files"),
+		ServiceName:              getEnv("SERVICE_NAME", "meta-core"),
+		ServiceVersion:           getEnv("SERVICE_VERSION", "1.0.0"),
+		APIPort:                  getEnvInt("API_PORT", 8180),
+		BaseURL:                  getEnv("BASE_URL", ""),
+		LockBackend:              getEnv("LOCK_BACKEND", "flock"),
+		LockLeaseTTLMS:           getEnvInt("LOCK_LEASE_TTL_MS", 15000),
+		RedisMode:                getEnv("REDIS_MODE", orDefault(file.Redis.Mode, "external")),
+		RedisPort:                getEnvInt("REDIS_PORT", 6379),
+		RedisReplication:         getEnvBool("REDIS_REPLICATION", false),
+		RedisReplicaDir:          getEnv("REDIS_REPLICA_DIR", "/tmp/meta-core-replica"),
+		RedisBind:                getEnv("REDIS_BIND", orDefault(file.Redis.Bind, "0.0.0.0")),
+		RedisUsername:            getEnv("REDIS_USERNAME", file.Redis.Username),
+		RedisPassword:            getEnv("REDIS_PASSWORD", file.Redis.Password),
+		RedisMaxMemory:           getEnv("REDIS_MAXMEMORY", file.Redis.MaxMemory),
+		RedisMaxMemoryPolicy:     getEnv("REDIS_MAXMEMORY_POLICY", orDefault(file.Redis.MaxMemoryPolicy, "noeviction")),
+		RedisSave:                getEnv("REDIS_SAVE", orDefault(file.Redis.Save, "60 1")),
+		RedisAppendFsync:         getEnv("REDIS_APPENDFSYNC", orDefault(file.Redis.AppendFsync, "everysec")),
+		RedisRestartBackoffMS:    getEnvInt("REDIS_RESTART_BACKOFF_MS", 1000),
+		RedisRestartBackoffMaxMS: getEnvInt("REDIS_RESTART_BACKOFF_MAX_MS", 60000),
+		RedisCrashThreshold:      getEnvInt("REDIS_CRASH_THRESHOLD", 5),
+		RedisCrashWindowMS:       getEnvInt("REDIS_CRASH_WINDOW_MS", 300000),
+		BackupIntervalMS:         getEnvInt("BACKUP_INTERVAL_MS", 3600000),
+		BackupRetention:          getEnvInt("BACKUP_RETENTION", 24),
+		PreRestoreRetention:      getEnvInt("BACKUP_PRE_RESTORE_RETENTION", 5),
+		HTTPPort:                 getEnvInt("META_CORE_HTTP_PORT", 9000),
+		HTTPHost:                 getEnv("META_CORE_HTTP_HOST", "127.0.0.1"),
+		HealthCheckIntervalMS:    getEnvInt("HEALTH_CHECK_INTERVAL_MS", 5000),
+		HeartbeatIntervalMS:      getEnvInt("HEARTBEAT_INTERVAL_MS", 30000),
+		StaleThresholdMS:         getEnvInt("STALE_THRESHOLD_MS", 60000),
+		LeaderStaleThresholdMS:   getEnvInt("LEADER_STALE_THRESHOLD_MS", 15000),
+		WatchIntervalMS:          getEnvInt("WATCH_INTERVAL_MS", 1000),
+		DebounceMS:               getEnvInt("DEBOUNCE_MS", 30000),
+		EnableFileWatcher:        getEnvBool("ENABLE_FILE_WATCHER", true),
+		HistoryLength:            getEnvInt("HISTORY_LENGTH", 100),
+		HistoryGlobalLength:      getEnvInt("HISTORY_GLOBAL_LENGTH", 10000),
+		ChangeFeedLength:         getEnvInt("CHANGE_FEED_LENGTH", 10000),
+		JobWorkers:               getEnvInt("JOB_WORKERS", 2),
+		JobQueueSize:             getEnvInt("JOB_QUEUE_SIZE", 100),
+		JobCacheSize:             getEnvInt("JOB_CACHE_SIZE", 10000),
+		JobRetentionMS:           getEnvInt("JOB_RETENTION_MS", 3600000),
+		OrphanGCIntervalMS:       getEnvInt("ORPHAN_GC_INTERVAL_MS", 3600000),
+		OrphanRetentionMS:        getEnvInt("ORPHAN_RETENTION_MS", 604800000),
 	}
 
 	// Parse watch folder list (comma-separated)
 	watchFolders := getEnv("WATCH_FOLDER_LIST", "/files/")
 	cfg.WatchFolderList = parseCommaSeparated(watchFolders)
 
+	cfg.IndexedFields = parseCommaSeparated(getEnv("METADATA_INDEX_FIELDS", "type,year,genre"))
+	cfg.CIDFields = parseCommaSeparated(getEnv("METADATA_CID_FIELDS", "poster,backdrop,subtitles,nfo,trailer"))
+
+	// ACL rules contain spaces, so the env list is semicolon-separated
+	cfg.RedisACLUsers = file.Redis.ACLUsers
+	if aclUsers := getEnv("REDIS_ACL_USERS", ""); aclUsers != "" {
+		cfg.RedisACLUsers = parseSeparated(aclUsers, ";")
+	}
+
 	// Set mounts directory
 	cfg.MountsDir = cfg.MetaCorePath + "/mounts"
 
@@ -80,11 +195,114 @@ func (c *Config) InfoFilePath() string {
 	return c.MetaCorePath + "/locks/kv-leader.info"
 }
 
+// LeaseFilePath returns the path to the lease file used by the lease lock backend
+func (c *Config) LeaseFilePath() string {
+	return c.MetaCorePath + "/locks/kv-leader.lease"
+}
+
+// EpochFilePath returns the path to the leadership epoch file
+func (c *Config) EpochFilePath() string {
+	return c.MetaCorePath + "/locks/kv-leader.epoch"
+}
+
+// RedisPasswordFilePath returns the path to the Redis password generated
+// when none is configured (see EnsureRedisPassword)
+func (c *Config) RedisPasswordFilePath() string {
+	return c.MetaCorePath + "/locks/redis-password"
+}
+
+// RedisBindLoopback returns true if every REDIS_BIND address is a loopback
+// address, so Redis cannot be reached from the network
+func (c *Config) RedisBindLoopback() bool {
+	addrs := strings.Fields(c.RedisBind)
+	for _, addr := range addrs {
+		ip := net.ParseIP(strings.TrimPrefix(addr, "-"))
+		if ip == nil || !ip.IsLoopback() {
+			return false
+		}
+	}
+	return len(addrs) > 0
+}
+
+// EnsureRedisPassword sets a Redis password when none is configured and
+// Redis binds to a network address. The password is generated once and
+// published to every node in the lock directory (mode 0600), where all
+// nodes share it; the first node to start writes it.
+func (c *Config) EnsureRedisPassword() error {
+	if c.RedisPassword != "" || c.RedisBindLoopback() {
+		return nil
+	}
+
+	path := c.RedisPasswordFilePath()
+	password, err := readPassword(path)
+	if os.IsNotExist(err) {
+		password, err = publishPassword(path)
+	}
+	if err != nil {
+		return fmt.Errorf("no REDIS_PASSWORD set and %s unusable: %w", path, err)
+	}
+
+	c.RedisPassword = password
+	return nil
+}
+
+// readPassword reads a published password
+func readPassword(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimSpace(string(data))
+	if password == "" {
+		return "", fmt.Errorf("empty password file")
+	}
+	return password, nil
+}
+
+// publishPassword writes a new random password to path unless another node
+// got there first, and returns the password in the file
+func publishPassword(path string) (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	// Written aside (CreateTemp makes it 0600) and linked into place, which
+	// fails if the file exists, so concurrent nodes all end up with the
+	// first password
+	temp, err := os.CreateTemp(filepath.Dir(path), ".redis-password-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.WriteString(hex.EncodeToString(secret) + "\n")
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Link(temp.Name(), path); err != nil && !os.IsExist(err) {
+		return "", err
+	} else if err == nil {
+		log.Printf("[Config] No REDIS_PASSWORD set, generated one in %s", path)
+	}
+	return readPassword(path)
+}
+
 // RedisDataDir returns the path to Redis data directory
 func (c *Config) RedisDataDir() string {
 	return c.MetaCorePath + "/db/redis"
 }
 
+// BackupsDir returns the path to the Redis backups directory
+func (c *Config) BackupsDir() string {
+	return c.MetaCorePath + "/backups"
+}
+
 // ServicesDir returns the path to services directory
 func (c *Config) ServicesDir() string {
 	return c.MetaCorePath + "/services"
@@ -100,6 +318,33 @@ func (c *Config) MountsErrorDir() string {
 	return c.MountsDir + "/errors"
 }
 
+// loadFileConfig reads the JSON config file, returning an empty config if
+// it does not exist or cannot be parsed
+func loadFileConfig(path string) *fileConfig {
+	file := &fileConfig{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Config] Warning: failed to read %s: %v", path, err)
+		}
+		return file
+	}
+
+	if err := json.Unmarshal(data, file); err != nil {
+		log.Printf("[Config] Warning: ignoring invalid config file %s: %v", path, err)
+		return &fileConfig{}
+	}
+	return file
+}
+
+func orDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -125,10 +370,14 @@ func getEnvBool(key string, defaultValue bool) bool {
 }
 
 func parseCommaSeparated(s string) []string {
+	return parseSeparated(s, ",")
+}
+
+func parseSeparated(s, sep string) []string {
 	if s == "" {
 		return []string{}
 	}
-	parts := strings.Split(s, ",")
+	parts := strings.Split(s, sep)
 	result := make([]string, 0, len(parts))
 	for _, part := range parts {
 		trimmed := strings.TrimSpace(part)
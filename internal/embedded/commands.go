@@ -0,0 +1,896 @@
+package embedded
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// command is a command implementation
+// Handlers run with Server.mu held.
+type command struct {
+	arity int // Exact argument count including the name, or -N for at least N
+	run   func(s *Server, args []string) interface{}
+}
+
+// commands is the command table
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// Connection and server
+		"PING":     {-1, cmdPing},
+		"ECHO":     {2, func(s *Server, args []string) interface{} { return args[1] }},
+		"SELECT":   {2, cmdSelect},
+		"CLIENT":   {-2, func(s *Server, args []string) interface{} { return replyOK{} }},
+		"COMMAND":  {-1, func(s *Server, args []string) interface{} { return []string{} }},
+		"CONFIG":   {-2, cmdConfig},
+		"INFO":     {-1, cmdInfo},
+		"DBSIZE":   {1, func(s *Server, args []string) interface{} { return len(s.data.keys) }},
+		"FLUSHALL": {-1, cmdFlush},
+		"FLUSHDB":  {-1, cmdFlush},
+		"SAVE":     {1, cmdSave},
+		"BGSAVE":   {-1, cmdSave},
+		"LASTSAVE": {1, func(s *Server, args []string) interface{} { return s.lastSave.Unix() }},
+
+		// Replication: an embedded server is always a primary
+		"REPLICAOF": {3, cmdReplicaOf},
+
+		// Keys
+		"DEL":    {-2, cmdDel},
+		"UNLINK": {-2, cmdDel},
+		"EXISTS": {-2, cmdExists},
+		"TYPE":   {2, cmdType},
+		"KEYS":   {2, cmdKeys},
+		"SCAN":   {-2, cmdScan},
+
+		// Strings
+		"GET":    {2, cmdGet},
+		"SET":    {-3, cmdSet},
+		"INCR":   {2, func(s *Server, args []string) interface{} { return incrBy(s, args[1], 1) }},
+		"INCRBY": {3, cmdIncrBy},
+
+		// Hashes
+		"HGET":    {3, cmdHGet},
+		"HMGET":   {-3, cmdHMGet},
+		"HSET":    {-4, cmdHSet},
+		"HMSET":   {-4, cmdHSet},
+		"HDEL":    {-3, cmdHDel},
+		"HLEN":    {2, cmdHLen},
+		"HEXISTS": {3, cmdHExists},
+		"HKEYS":   {2, cmdHKeys},
+		"HGETALL": {2, cmdHGetAll},
+
+		// Sets
+		"SADD":      {-3, cmdSAdd},
+		"SREM":      {-3, cmdSRem},
+		"SMEMBERS":  {2, cmdSMembers},
+		"SCARD":     {2, cmdSCard},
+		"SISMEMBER": {3, cmdSIsMember},
+		"SINTER":    {-2, cmdSInter},
+		"SUNION":    {-2, cmdSUnion},
+
+		// Sorted sets
+		"ZADD":        {-4, cmdZAdd},
+		"ZREM":        {-3, cmdZRem},
+		"ZCARD":       {2, cmdZCard},
+		"ZRANGEBYLEX": {-4, cmdZRangeByLex},
+
+		// Streams
+		"XADD":      {-5, cmdXAdd},
+		"XLEN":      {2, cmdXLen},
+		"XRANGE":    {-4, cmdXRange},
+		"XREVRANGE": {-4, cmdXRevRange},
+	}
+}
+
+// Error implements error so lookup failures can be returned as errors
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// lookupCommand finds a command and checks its arity
+func lookupCommand(name string, args []string) (command, error) {
+	cmd, ok := commands[name]
+	if !ok {
+		return command{}, replyError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(args[0])))
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		return command{}, arityError(name)
+	}
+	return cmd, nil
+}
+
+func arityError(name string) replyError {
+	return replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// Connection and server
+
+func cmdPing(s *Server, args []string) interface{} {
+	if len(args) > 1 {
+		return args[1]
+	}
+	return replyStatus("PONG")
+}
+
+func cmdSelect(s *Server, args []string) interface{} {
+	if args[1] != "0" {
+		return replyError("ERR DB index is out of range")
+	}
+	return replyOK{}
+}
+
+// cmdConfig accepts CONFIG SET for compatibility; persistence and limits
+// are not configurable in embedded mode
+func cmdConfig(s *Server, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "SET", "RESETSTAT", "REWRITE":
+		return replyOK{}
+	case "GET":
+		return []string{}
+	}
+	return replyError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+}
+
+func cmdInfo(s *Server, args []string) interface{} {
+	lastSaveStatus := "ok"
+	if !s.lastSaveOK {
+		lastSaveStatus = "err"
+	}
+
+	var b strings.Builder
+	section := func(name string) bool {
+		if len(args) < 2 {
+			return true
+		}
+		for _, arg := range args[1:] {
+			if strings.EqualFold(arg, name) || strings.EqualFold(arg, "all") || strings.EqualFold(arg, "everything") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if section("server") {
+		fmt.Fprintf(&b, "# Server\r\nredis_mode:embedded\r\nprocess_id:%d\r\n\r\n", os.Getpid())
+	}
+	if section("memory") {
+		used := s.data.memoryUsage()
+		fmt.Fprintf(&b, "# Memory\r\nused_memory:%d\r\nused_memory_human:%s\r\n\r\n", used, humanBytes(used))
+	}
+	if section("persistence") {
+		fmt.Fprintf(&b, "# Persistence\r\nrdb_changes_since_last_save:%d\r\nrdb_bgsave_in_progress:0\r\nrdb_last_save_time:%d\r\nrdb_last_bgsave_status:%s\r\naof_enabled:0\r\naof_rewrite_in_progress:0\r\naof_rewrite_scheduled:0\r\n\r\n",
+			s.data.dirty, s.lastSave.Unix(), lastSaveStatus)
+	}
+	if section("replication") {
+		b.WriteString("# Replication\r\nrole:master\r\nconnected_slaves:0\r\n\r\n")
+	}
+	if section("keyspace") {
+		fmt.Fprintf(&b, "# Keyspace\r\ndb0:keys=%d,expires=0\r\n", len(s.data.keys))
+	}
+	return b.String()
+}
+
+// cmdReplicaOf accepts REPLICAOF NO ONE, a no-op on a primary, and refuses
+// to follow another server
+func cmdReplicaOf(s *Server, args []string) interface{} {
+	if strings.EqualFold(args[1], "NO") && strings.EqualFold(args[2], "ONE") {
+		return replyOK{}
+	}
+	return replyError("ERR replication is not supported in embedded mode")
+}
+
+func cmdFlush(s *Server, args []string) interface{} {
+	s.data.flush()
+	return replyOK{}
+}
+
+// cmdSave writes a snapshot; the server lock is released while writing
+func cmdSave(s *Server, args []string) interface{} {
+	if s.opts.SnapshotPath == "" {
+		return replyError("ERR persistence is disabled")
+	}
+
+	s.mu.Unlock()
+	err := s.Save()
+	s.mu.Lock()
+
+	if err != nil {
+		return replyError("ERR " + err.Error())
+	}
+	if strings.EqualFold(args[0], "BGSAVE") {
+		return replyStatus("Background saving started")
+	}
+	return replyOK{}
+}
+
+// Keys
+
+func cmdDel(s *Server, args []string) interface{} {
+	deleted := 0
+	for _, key := range args[1:] {
+		if s.data.delete(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func cmdExists(s *Server, args []string) interface{} {
+	count := 0
+	for _, key := range args[1:] {
+		if _, ok := s.data.keys[key]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+func cmdType(s *Server, args []string) interface{} {
+	e, ok := s.data.keys[args[1]]
+	if !ok {
+		return replyStatus("none")
+	}
+	return replyStatus(e.kind.String())
+}
+
+func cmdKeys(s *Server, args []string) interface{} {
+	return s.data.matchKeys(args[1])
+}
+
+// cmdScan returns every matching key in a single iteration
+func cmdScan(s *Server, args []string) interface{} {
+	pattern := "*"
+	for i := 2; i+1 < len(args); i += 2 {
+		if strings.EqualFold(args[i], "MATCH") {
+			pattern = args[i+1]
+		}
+	}
+	return []interface{}{"0", s.data.matchKeys(pattern)}
+}
+
+// matchKeys returns the sorted keys matching a glob pattern
+func (d *db) matchKeys(pattern string) []string {
+	keys := make([]string, 0)
+	for key := range d.keys {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// globMatch matches s against a Redis glob pattern (*, ?, [...] and \\ escapes)
+// Unlike path.Match, * also matches '/'.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				if s[0] != '[' {
+					return false
+				}
+				break
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= s[0] && s[0] <= class[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if class[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// Strings
+
+func cmdGet(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindString)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	return e.str
+}
+
+// cmdSet supports the NX and XX flags; expiry is not supported
+func cmdSet(s *Server, args []string) interface{} {
+	key, value := args[1], args[2]
+	nx, xx := false, false
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return replyError("ERR syntax error (expiry is not supported in embedded mode)")
+		}
+	}
+
+	_, exists := s.data.keys[key]
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+
+	s.data.keys[key] = &entry{kind: kindString, str: value}
+	s.data.touch(key)
+	return replyOK{}
+}
+
+func cmdIncrBy(s *Server, args []string) interface{} {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return replyError("ERR value is not an integer or out of range")
+	}
+	return incrBy(s, args[1], delta)
+}
+
+func incrBy(s *Server, key string, delta int64) interface{} {
+	e, err := s.data.getOrCreate(key, kindString)
+	if err != nil {
+		return err
+	}
+
+	current := int64(0)
+	if e.str != "" {
+		current, err = strconv.ParseInt(e.str, 10, 64)
+		if err != nil {
+			return replyError("ERR value is not an integer or out of range")
+		}
+	}
+
+	current += delta
+	e.str = strconv.FormatInt(current, 10)
+	s.data.touch(key)
+	return current
+}
+
+// Hashes
+
+func cmdHGet(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return nil
+	}
+	value, ok := e.hash[args[2]]
+	if !ok {
+		return nil
+	}
+	return value
+}
+
+func cmdHMGet(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, 0, len(args)-2)
+	for _, field := range args[2:] {
+		if e == nil {
+			values = append(values, nil)
+			continue
+		}
+		if value, ok := e.hash[field]; ok {
+			values = append(values, value)
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func cmdHSet(s *Server, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return arityError(args[0])
+	}
+
+	e, err := s.data.getOrCreate(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := e.hash[args[i]]; !ok {
+			added++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	s.data.touch(args[1])
+
+	if strings.EqualFold(args[0], "HMSET") {
+		return replyOK{}
+	}
+	return added
+}
+
+func cmdHDel(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+
+	deleted := 0
+	for _, field := range args[2:] {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		s.data.touch(args[1])
+		s.data.dropIfEmpty(args[1])
+	}
+	return deleted
+}
+
+func cmdHLen(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.hash)
+}
+
+func cmdHExists(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	_, ok := e.hash[args[2]]
+	return ok
+}
+
+func cmdHKeys(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0)
+	if e != nil {
+		for field := range e.hash {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func cmdHGetAll(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	pairs := make([]string, 0)
+	if e != nil {
+		for field, value := range e.hash {
+			pairs = append(pairs, field, value)
+		}
+	}
+	return pairs
+}
+
+// Sets
+
+func cmdSAdd(s *Server, args []string) interface{} {
+	e, err := s.data.getOrCreate(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+
+	added := 0
+	for _, member := range args[2:] {
+		if _, ok := e.set[member]; !ok {
+			e.set[member] = struct{}{}
+			added++
+		}
+	}
+	if added > 0 {
+		s.data.touch(args[1])
+	}
+	s.data.dropIfEmpty(args[1])
+	return added
+}
+
+func cmdSRem(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindSet)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+
+	removed := 0
+	for _, member := range args[2:] {
+		if _, ok := e.set[member]; ok {
+			delete(e.set, member)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.data.touch(args[1])
+		s.data.dropIfEmpty(args[1])
+	}
+	return removed
+}
+
+func cmdSMembers(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0)
+	if e != nil {
+		for member := range e.set {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdSCard(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindSet)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.set)
+}
+
+func cmdSIsMember(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindSet)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	_, ok := e.set[args[2]]
+	return ok
+}
+
+func cmdSInter(s *Server, args []string) interface{} {
+	sets := make([]map[string]struct{}, 0, len(args)-1)
+	for _, key := range args[1:] {
+		e, err := s.data.get(key, kindSet)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return []string{}
+		}
+		sets = append(sets, e.set)
+	}
+
+	members := make([]string, 0)
+	for member := range sets[0] {
+		inAll := true
+		for _, set := range sets[1:] {
+			if _, ok := set[member]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdSUnion(s *Server, args []string) interface{} {
+	union := make(map[string]struct{})
+	for _, key := range args[1:] {
+		e, err := s.data.get(key, kindSet)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			continue
+		}
+		for member := range e.set {
+			union[member] = struct{}{}
+		}
+	}
+
+	members := make([]string, 0, len(union))
+	for member := range union {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Sorted sets
+
+// cmdZAdd supports the NX, XX and CH flags
+func cmdZAdd(s *Server, args []string) interface{} {
+	var nx, xx, ch bool
+	i := 2
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return replyError("ERR syntax error")
+	}
+
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := strconv.ParseFloat(pairs[j], 64)
+		if err != nil {
+			return replyError("ERR value is not a valid float")
+		}
+		scores = append(scores, score)
+	}
+
+	e, err := s.data.getOrCreate(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+
+	added, changed := 0, 0
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		current, exists := e.zset[member]
+		if (exists && nx) || (!exists && xx) {
+			continue
+		}
+		if !exists {
+			added++
+		} else if current != score {
+			changed++
+		} else {
+			continue
+		}
+		e.zset[member] = score
+	}
+	if added+changed > 0 {
+		s.data.touch(args[1])
+	}
+	s.data.dropIfEmpty(args[1])
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZRem(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindZSet)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+
+	removed := 0
+	for _, member := range args[2:] {
+		if _, ok := e.zset[member]; ok {
+			delete(e.zset, member)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.data.touch(args[1])
+		s.data.dropIfEmpty(args[1])
+	}
+	return removed
+}
+
+func cmdZCard(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindZSet)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.zset)
+}
+
+// cmdZRangeByLex orders members by name, which is what Redis does when all
+// scores are equal (the only case ZRANGEBYLEX is defined for)
+func cmdZRangeByLex(s *Server, args []string) interface{} {
+	lower, lowerOK := parseLexBound(args[2])
+	upper, upperOK := parseLexBound(args[3])
+	if !lowerOK || !upperOK {
+		return replyError("ERR min or max not valid string range item")
+	}
+
+	offset, count := 0, -1
+	if len(args) > 4 {
+		if len(args) != 7 || !strings.EqualFold(args[4], "LIMIT") {
+			return replyError("ERR syntax error")
+		}
+		var err1, err2 error
+		offset, err1 = strconv.Atoi(args[5])
+		count, err2 = strconv.Atoi(args[6])
+		if err1 != nil || err2 != nil {
+			return replyError("ERR value is not an integer or out of range")
+		}
+	}
+
+	e, err := s.data.get(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0)
+	if e == nil || offset < 0 {
+		return members
+	}
+
+	for member := range e.zset {
+		if lower.below(member) && upper.above(member) {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+
+	if offset >= len(members) {
+		return []string{}
+	}
+	members = members[offset:]
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+	return members
+}
+
+// lexBound is a ZRANGEBYLEX range item: -, +, [value or (value
+type lexBound struct {
+	value     string
+	inclusive bool
+	infinite  int // -1 for -, 1 for +
+}
+
+func parseLexBound(arg string) (lexBound, bool) {
+	switch {
+	case arg == "-":
+		return lexBound{infinite: -1}, true
+	case arg == "+":
+		return lexBound{infinite: 1}, true
+	case strings.HasPrefix(arg, "["):
+		return lexBound{value: arg[1:], inclusive: true}, true
+	case strings.HasPrefix(arg, "("):
+		return lexBound{value: arg[1:]}, true
+	}
+	return lexBound{}, false
+}
+
+// below returns true if member is within the range as its lower bound
+func (b lexBound) below(member string) bool {
+	switch b.infinite {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	return member > b.value || (b.inclusive && member == b.value)
+}
+
+// above returns true if member is within the range as its upper bound
+func (b lexBound) above(member string) bool {
+	switch b.infinite {
+	case -1:
+		return false
+	case 1:
+		return true
+	}
+	return member < b.value || (b.inclusive && member == b.value)
+}
+
+// orZero returns err if set, 0 otherwise (for counts on missing keys)
+func orZero(err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
+
+// memoryUsage estimates the keyspace size in bytes
+func (d *db) memoryUsage() int64 {
+	var total int64
+	for key, e := range d.keys {
+		total += int64(len(key)) + 48
+		switch e.kind {
+		case kindString:
+			total += int64(len(e.str))
+		case kindHash:
+			for field, value := range e.hash {
+				total += int64(len(field)+len(value)) + 32
+			}
+		case kindSet:
+			for member := range e.set {
+				total += int64(len(member)) + 16
+			}
+		case kindZSet:
+			for member := range e.zset {
+				total += int64(len(member)) + 24
+			}
+		case kindStream:
+			for _, entry := range e.stream.Entries {
+				total += 16
+				for _, field := range entry.Fields {
+					total += int64(len(field)) + 8
+				}
+			}
+		}
+	}
+	return total
+}
+
+// humanBytes formats a size like Redis' used_memory_human
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	suffixes := []string{"K", "M", "G", "T"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.2f%s", value, suffixes[i])
+}
@@ -0,0 +1,279 @@
+package embedded
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// snapshotVersion is bumped when the snapshot layout changes incompatibly
+const snapshotVersion = 1
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// kind is the type of value held by a key
+type kind int
+
+const (
+	kindString kind = iota
+	kindHash
+	kindSet
+	kindZSet
+	kindStream
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindString:
+		return "string"
+	case kindHash:
+		return "hash"
+	case kindSet:
+		return "set"
+	case kindZSet:
+		return "zset"
+	case kindStream:
+		return "stream"
+	}
+	return "none"
+}
+
+// entry is the value held by a key
+type entry struct {
+	kind   kind
+	str    string
+	hash   map[string]string
+	set    map[string]struct{}
+	zset   map[string]float64 // Member -> score
+	stream *stream
+}
+
+// size returns the number of elements for aggregate types
+func (e *entry) size() int {
+	switch e.kind {
+	case kindHash:
+		return len(e.hash)
+	case kindSet:
+		return len(e.set)
+	case kindZSet:
+		return len(e.zset)
+	case kindStream:
+		return len(e.stream.Entries)
+	}
+	return 1
+}
+
+// db is the keyspace (caller must hold Server.mu)
+// Every write bumps the key's version, which is what WATCH compares.
+type db struct {
+	keys     map[string]*entry
+	versions map[string]uint64
+	version  uint64
+	dirty    int64 // Writes since the last snapshot
+}
+
+func newDB() *db {
+	return &db{
+		keys:     make(map[string]*entry),
+		versions: make(map[string]uint64),
+	}
+}
+
+// touch records a write to key
+func (d *db) touch(key string) {
+	d.version++
+	d.versions[key] = d.version
+	d.dirty++
+}
+
+// get returns the entry for key, or nil if it does not exist
+// Returns errWrongType if the key holds another type
+func (d *db) get(key string, k kind) (*entry, error) {
+	e, ok := d.keys[key]
+	if !ok {
+		return nil, nil
+	}
+	if e.kind != k {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+// getOrCreate returns the entry for key, creating an empty one if needed
+func (d *db) getOrCreate(key string, k kind) (*entry, error) {
+	e, err := d.get(key, k)
+	if err != nil || e != nil {
+		return e, err
+	}
+
+	e = &entry{kind: k}
+	switch k {
+	case kindHash:
+		e.hash = make(map[string]string)
+	case kindSet:
+		e.set = make(map[string]struct{})
+	case kindZSet:
+		e.zset = make(map[string]float64)
+	case kindStream:
+		e.stream = &stream{}
+	}
+	d.keys[key] = e
+	return e, nil
+}
+
+// delete removes key, returning true if it existed
+func (d *db) delete(key string) bool {
+	if _, ok := d.keys[key]; !ok {
+		return false
+	}
+	delete(d.keys, key)
+	d.touch(key)
+	return true
+}
+
+// dropIfEmpty removes aggregate keys that have no elements left, as Redis does
+func (d *db) dropIfEmpty(key string) {
+	if e, ok := d.keys[key]; ok && e.kind != kindString && e.size() == 0 {
+		delete(d.keys, key)
+	}
+}
+
+// flush removes all keys
+func (d *db) flush() {
+	for key := range d.keys {
+		d.touch(key)
+	}
+	d.keys = make(map[string]*entry)
+}
+
+// snapshot is the on-disk representation of the keyspace
+type snapshot struct {
+	Version int
+	Strings map[string]string
+	Hashes  map[string]map[string]string
+	Sets    map[string][]string
+	ZSets   map[string]map[string]float64
+	Streams map[string]*stream
+}
+
+// toSnapshot copies the keyspace into its on-disk form
+func (d *db) toSnapshot() *snapshot {
+	snap := &snapshot{
+		Version: snapshotVersion,
+		Strings: make(map[string]string),
+		Hashes:  make(map[string]map[string]string),
+		Sets:    make(map[string][]string),
+		ZSets:   make(map[string]map[string]float64),
+		Streams: make(map[string]*stream),
+	}
+
+	for key, e := range d.keys {
+		switch e.kind {
+		case kindString:
+			snap.Strings[key] = e.str
+		case kindHash:
+			hash := make(map[string]string, len(e.hash))
+			for field, value := range e.hash {
+				hash[field] = value
+			}
+			snap.Hashes[key] = hash
+		case kindSet:
+			members := make([]string, 0, len(e.set))
+			for member := range e.set {
+				members = append(members, member)
+			}
+			snap.Sets[key] = members
+		case kindZSet:
+			zset := make(map[string]float64, len(e.zset))
+			for member, score := range e.zset {
+				zset[member] = score
+			}
+			snap.ZSets[key] = zset
+		case kindStream:
+			snap.Streams[key] = &stream{
+				Entries: append([]streamEntry(nil), e.stream.Entries...),
+				LastID:  e.stream.LastID,
+			}
+		}
+	}
+	return snap
+}
+
+// loadSnapshot replaces the keyspace with the snapshot content
+func (d *db) loadSnapshot(snap *snapshot) error {
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	d.keys = make(map[string]*entry)
+	for key, value := range snap.Strings {
+		d.keys[key] = &entry{kind: kindString, str: value}
+	}
+	for key, hash := range snap.Hashes {
+		d.keys[key] = &entry{kind: kindHash, hash: hash}
+	}
+	for key, members := range snap.Sets {
+		set := make(map[string]struct{}, len(members))
+		for _, member := range members {
+			set[member] = struct{}{}
+		}
+		d.keys[key] = &entry{kind: kindSet, set: set}
+	}
+	for key, zset := range snap.ZSets {
+		d.keys[key] = &entry{kind: kindZSet, zset: zset}
+	}
+	for key, st := range snap.Streams {
+		d.keys[key] = &entry{kind: kindStream, stream: st}
+	}
+	return nil
+}
+
+// writeSnapshot atomically writes a snapshot to path
+func writeSnapshot(path string, snap *snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(file).Encode(snap); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// readSnapshot reads a snapshot from path, returning nil if it does not exist
+func readSnapshot(path string) (*snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var snap snapshot
+	if err := gob.NewDecoder(file).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	return &snap, nil
+}
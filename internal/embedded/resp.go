@@ -0,0 +1,158 @@
+package embedded
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxBulkLen bounds a single bulk string, as in Redis (proto-max-bulk-len)
+const maxBulkLen = 512 * 1024 * 1024
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand reads one command, either a RESP array of bulk strings or an
+// inline command (as typed into telnet or redis-cli without arguments)
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > 1024*1024 {
+		return nil, errProtocol
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if header == "" || header[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, errProtocol
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a CRLF (or LF) terminated line without the terminator
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writer encodes RESP2 replies
+type writer struct {
+	w *bufio.Writer
+}
+
+func (w *writer) simple(s string) {
+	fmt.Fprintf(w.w, "+%s\r\n", s)
+}
+
+func (w *writer) ok() {
+	w.simple("OK")
+}
+
+func (w *writer) err(msg string) {
+	fmt.Fprintf(w.w, "-%s\r\n", msg)
+}
+
+func (w *writer) int(n int64) {
+	fmt.Fprintf(w.w, ":%d\r\n", n)
+}
+
+func (w *writer) bulk(s string) {
+	fmt.Fprintf(w.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (w *writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) nullArray() {
+	w.w.WriteString("*-1\r\n")
+}
+
+func (w *writer) arrayLen(n int) {
+	fmt.Fprintf(w.w, "*%d\r\n", n)
+}
+
+func (w *writer) bulks(values []string) {
+	w.arrayLen(len(values))
+	for _, v := range values {
+		w.bulk(v)
+	}
+}
+
+// reply writes a command result produced by a handler
+func (w *writer) reply(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.null()
+	case replyOK:
+		w.ok()
+	case replyNullArray:
+		w.nullArray()
+	case replyStatus:
+		w.simple(string(v))
+	case replyError:
+		w.err(string(v))
+	case error:
+		w.err(v.Error())
+	case int:
+		w.int(int64(v))
+	case int64:
+		w.int(v)
+	case bool:
+		if v {
+			w.int(1)
+		} else {
+			w.int(0)
+		}
+	case string:
+		w.bulk(v)
+	case []string:
+		w.bulks(v)
+	case []interface{}:
+		w.arrayLen(len(v))
+		for _, item := range v {
+			w.reply(item)
+		}
+	default:
+		w.err(fmt.Sprintf("ERR unsupported reply type %T", v))
+	}
+}
+
+// Reply markers for values that have no natural Go representation
+type (
+	replyOK        struct{}
+	replyNullArray struct{}
+	replyStatus    string
+	replyError     string
+)
@@ -0,0 +1,392 @@
+package embedded
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSaveInterval is how often a changed keyspace is snapshotted
+const defaultSaveInterval = time.Second
+
+// Options configures an embedded server
+type Options struct {
+	Addr         string        // Listen address (host:port)
+	Username     string        // ACL user clients must authenticate as (default user if empty)
+	Password     string        // Password, no authentication if empty
+	SnapshotPath string        // Snapshot file, persistence is disabled if empty
+	SaveInterval time.Duration // How often a changed keyspace is saved (default: 1s)
+}
+
+// Server is an in-process server speaking the Redis protocol (RESP2)
+// It implements the subset of commands meta-core uses, including
+// WATCH/MULTI/EXEC, so the storage client works against it unchanged.
+// Commands run one at a time, as in Redis.
+type Server struct {
+	opts     Options
+	listener net.Listener
+
+	mu         sync.Mutex // Guards data; held while a command runs
+	data       *db
+	lastSave   time.Time
+	lastSaveOK bool
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a new embedded server
+func NewServer(opts Options) *Server {
+	if opts.SaveInterval <= 0 {
+		opts.SaveInterval = defaultSaveInterval
+	}
+	return &Server{
+		opts:       opts,
+		data:       newDB(),
+		lastSaveOK: true,
+		conns:      make(map[net.Conn]struct{}),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start loads the snapshot and starts accepting connections
+func (s *Server) Start() error {
+	if s.opts.SnapshotPath != "" {
+		snap, err := readSnapshot(s.opts.SnapshotPath)
+		if err != nil {
+			return err
+		}
+		if snap != nil {
+			if err := s.data.loadSnapshot(snap); err != nil {
+				return err
+			}
+			log.Printf("[Embedded] Loaded %d keys from %s", len(s.data.keys), s.opts.SnapshotPath)
+		}
+	}
+
+	listener, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.opts.Addr, err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	if s.opts.SnapshotPath != "" {
+		s.wg.Add(1)
+		go s.saveLoop()
+	}
+
+	log.Printf("[Embedded] Listening on %s", listener.Addr())
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.opts.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and writes a final snapshot
+func (s *Server) Close() error {
+	close(s.stopChan)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+
+	if s.opts.SnapshotPath == "" {
+		return nil
+	}
+	return s.Save()
+}
+
+// Save writes a snapshot of the keyspace
+func (s *Server) Save() error {
+	if s.opts.SnapshotPath == "" {
+		return errors.New("persistence disabled")
+	}
+
+	s.mu.Lock()
+	snap := s.data.toSnapshot()
+	dirty := s.data.dirty
+	s.mu.Unlock()
+
+	err := writeSnapshot(s.opts.SnapshotPath, snap)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSave = time.Now()
+	s.lastSaveOK = err == nil
+	if err == nil {
+		s.data.dirty -= dirty
+	}
+	return err
+}
+
+// saveLoop snapshots the keyspace whenever it has changed
+func (s *Server) saveLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.SaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			dirty := s.data.dirty
+			s.mu.Unlock()
+
+			if dirty == 0 {
+				continue
+			}
+			if err := s.Save(); err != nil {
+				log.Printf("[Embedded] Failed to save snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// acceptLoop accepts client connections
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.stopChan:
+				return
+			default:
+			}
+			log.Printf("[Embedded] Accept failed: %v", err)
+			continue
+		}
+
+		s.connsMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// session is the per-connection state
+type session struct {
+	authed  bool
+	inMulti bool
+	txError bool              // A command failed to queue; EXEC aborts
+	queued  [][]string        // Commands queued by MULTI
+	watched map[string]uint64 // Key versions recorded by WATCH
+}
+
+// serve handles one client connection
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	out := &writer{w: bufio.NewWriter(conn)}
+	sess := &session{authed: s.opts.Password == ""}
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				out.err("ERR Protocol error")
+				out.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		name := strings.ToUpper(args[0])
+		out.reply(s.handle(sess, name, args))
+
+		// Flush once the client has no more pipelined commands
+		if reader.Buffered() == 0 {
+			if err := out.w.Flush(); err != nil {
+				return
+			}
+		}
+		if name == "QUIT" {
+			out.w.Flush()
+			return
+		}
+	}
+}
+
+// handle runs a command in the context of a session
+func (s *Server) handle(sess *session, name string, args []string) interface{} {
+	switch name {
+	case "AUTH":
+		return s.auth(sess, args[1:])
+	case "HELLO":
+		// Clients fall back to RESP2 and AUTH
+		return replyError("ERR unknown command 'HELLO'")
+	case "QUIT":
+		return replyOK{}
+	}
+
+	if !sess.authed {
+		return replyError("NOAUTH Authentication required.")
+	}
+
+	switch name {
+	case "MULTI":
+		if sess.inMulti {
+			return replyError("ERR MULTI calls can not be nested")
+		}
+		sess.inMulti = true
+		sess.txError = false
+		sess.queued = nil
+		return replyOK{}
+
+	case "DISCARD":
+		if !sess.inMulti {
+			return replyError("ERR DISCARD without MULTI")
+		}
+		sess.reset()
+		return replyOK{}
+
+	case "EXEC":
+		if !sess.inMulti {
+			return replyError("ERR EXEC without MULTI")
+		}
+		return s.exec(sess)
+
+	case "WATCH":
+		if sess.inMulti {
+			return replyError("ERR WATCH inside MULTI is not allowed")
+		}
+		if len(args) < 2 {
+			return arityError(name)
+		}
+		s.mu.Lock()
+		if sess.watched == nil {
+			sess.watched = make(map[string]uint64)
+		}
+		for _, key := range args[1:] {
+			if _, ok := sess.watched[key]; !ok {
+				sess.watched[key] = s.data.versions[key]
+			}
+		}
+		s.mu.Unlock()
+		return replyOK{}
+
+	case "UNWATCH":
+		sess.watched = nil
+		return replyOK{}
+	}
+
+	cmd, err := lookupCommand(name, args)
+	if err != nil {
+		if sess.inMulti {
+			sess.txError = true
+		}
+		return err
+	}
+
+	if sess.inMulti {
+		sess.queued = append(sess.queued, args)
+		return replyStatus("QUEUED")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cmd.run(s, args)
+}
+
+// exec runs the queued transaction if no watched key has changed
+func (s *Server) exec(sess *session) interface{} {
+	defer sess.reset()
+
+	if sess.txError {
+		return replyError("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, version := range sess.watched {
+		if s.data.versions[key] != version {
+			return replyNullArray{}
+		}
+	}
+
+	replies := make([]interface{}, 0, len(sess.queued))
+	for _, args := range sess.queued {
+		cmd, err := lookupCommand(strings.ToUpper(args[0]), args)
+		if err != nil {
+			replies = append(replies, err)
+			continue
+		}
+		replies = append(replies, cmd.run(s, args))
+	}
+	return replies
+}
+
+// reset clears transaction and watch state
+func (sess *session) reset() {
+	sess.inMulti = false
+	sess.txError = false
+	sess.queued = nil
+	sess.watched = nil
+}
+
+// auth handles AUTH [username] password
+func (s *Server) auth(sess *session, args []string) interface{} {
+	var username, password string
+	switch len(args) {
+	case 1:
+		username, password = "default", args[0]
+	case 2:
+		username, password = args[0], args[1]
+	default:
+		return arityError("AUTH")
+	}
+
+	if s.opts.Password == "" {
+		return replyError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+
+	expected := s.opts.Username
+	if expected == "" {
+		expected = "default"
+	}
+	if username != expected || password != s.opts.Password {
+		return replyError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+
+	sess.authed = true
+	return replyOK{}
+}
@@ -0,0 +1,243 @@
+package embedded
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamID is a stream entry ID: milliseconds and a sequence number
+type streamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// streamEntry is a stream entry with its field-value pairs
+type streamEntry struct {
+	ID     streamID
+	Fields []string
+}
+
+// stream is an append-only log of entries in ID order
+type stream struct {
+	Entries []streamEntry
+	LastID  streamID
+}
+
+// parseStreamID parses an explicit entry ID ("ms" or "ms-seq"); a missing
+// sequence defaults to seq
+func parseStreamID(s string, seq uint64) (streamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	if !hasSeq {
+		return streamID{Ms: ms, Seq: seq}, true
+	}
+	n, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return streamID{}, false
+	}
+	return streamID{Ms: ms, Seq: n}, true
+}
+
+// parseRangeBound parses an XRANGE bound: -, +, an ID, or an exclusive
+// (ID. Returns the smallest (start) or largest (end) ID it admits.
+func parseRangeBound(s string, start bool) (streamID, bool) {
+	switch s {
+	case "-":
+		return streamID{}, true
+	case "+":
+		return streamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, true
+	}
+
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	defaultSeq := uint64(0)
+	if !start {
+		defaultSeq = math.MaxUint64
+	}
+	id, ok := parseStreamID(s, defaultSeq)
+	if !ok || !exclusive {
+		return id, ok
+	}
+
+	// Exclusive bounds move one ID inwards
+	if start {
+		if id.Seq == math.MaxUint64 {
+			return streamID{Ms: id.Ms + 1}, id.Ms != math.MaxUint64
+		}
+		return streamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Seq == 0 {
+		return streamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, id.Ms != 0
+	}
+	return streamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+}
+
+// entryReply formats an entry as XRANGE returns it
+func entryReply(e streamEntry) interface{} {
+	return []interface{}{e.ID.String(), e.Fields}
+}
+
+// cmdXAdd supports NOMKSTREAM and MAXLEN trimming (approximate trimming is
+// exact here)
+func cmdXAdd(s *Server, args []string) interface{} {
+	noMkStream := false
+	maxLen := -1
+	i := 2
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+			continue
+		case "MAXLEN":
+			i++
+			if i < len(args) && (args[i] == "~" || args[i] == "=") {
+				i++
+			}
+			if i >= len(args) {
+				return replyError("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				return replyError("ERR The MAXLEN argument must be >= 0.")
+			}
+			maxLen = n
+			i++
+			continue
+		}
+		break
+	}
+
+	if i >= len(args) {
+		return arityError("XADD")
+	}
+	idArg, fields := args[i], args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return arityError("XADD")
+	}
+
+	e, err := s.data.get(args[1], kindStream)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		if noMkStream {
+			return nil
+		}
+		if e, err = s.data.getOrCreate(args[1], kindStream); err != nil {
+			return err
+		}
+	}
+
+	last := e.stream.LastID
+	var id streamID
+	if idArg == "*" {
+		id = streamID{Ms: uint64(time.Now().UnixMilli())}
+		if !last.less(id) {
+			id = streamID{Ms: last.Ms, Seq: last.Seq + 1}
+		}
+	} else {
+		var ok bool
+		if id, ok = parseStreamID(idArg, 0); !ok {
+			return replyError("ERR Invalid stream ID specified as stream command argument")
+		}
+		if !last.less(id) {
+			return replyError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	}
+
+	e.stream.Entries = append(e.stream.Entries, streamEntry{ID: id, Fields: append([]string(nil), fields...)})
+	e.stream.LastID = id
+	if maxLen >= 0 && len(e.stream.Entries) > maxLen {
+		trimmed := len(e.stream.Entries) - maxLen
+		e.stream.Entries = append([]streamEntry(nil), e.stream.Entries[trimmed:]...)
+	}
+	s.data.touch(args[1])
+	return id.String()
+}
+
+func cmdXLen(s *Server, args []string) interface{} {
+	e, err := s.data.get(args[1], kindStream)
+	if err != nil || e == nil {
+		return orZero(err)
+	}
+	return len(e.stream.Entries)
+}
+
+func cmdXRange(s *Server, args []string) interface{} {
+	return xrange(s, args, false)
+}
+
+func cmdXRevRange(s *Server, args []string) interface{} {
+	return xrange(s, args, true)
+}
+
+// xrange serves XRANGE key start end [COUNT n] and XREVRANGE key end start
+// [COUNT n]
+func xrange(s *Server, args []string, reverse bool) interface{} {
+	startArg, endArg := args[2], args[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, ok1 := parseRangeBound(startArg, true)
+	end, ok2 := parseRangeBound(endArg, false)
+	if !ok1 || !ok2 {
+		return replyError("ERR Invalid stream ID specified as stream command argument")
+	}
+
+	count := -1
+	if len(args) > 4 {
+		if len(args) != 6 || !strings.EqualFold(args[4], "COUNT") {
+			return replyError("ERR syntax error")
+		}
+		n, err := strconv.Atoi(args[5])
+		if err != nil {
+			return replyError("ERR value is not an integer or out of range")
+		}
+		count = n
+	}
+
+	e, err := s.data.get(args[1], kindStream)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, 0)
+	if e == nil || end.less(start) {
+		return result
+	}
+
+	entries := e.stream.Entries
+	from := sort.Search(len(entries), func(i int) bool { return !entries[i].ID.less(start) })
+	to := sort.Search(len(entries), func(i int) bool { return end.less(entries[i].ID) })
+	if from >= to {
+		return result
+	}
+	matched := entries[from:to]
+
+	for i := range matched {
+		if count >= 0 && len(result) >= count {
+			break
+		}
+		entry := matched[i]
+		if reverse {
+			entry = matched[len(matched)-1-i]
+		}
+		result = append(result, entryReply(entry))
+	}
+	return result
+}
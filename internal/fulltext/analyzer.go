@@ -0,0 +1,245 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Field is a metadata property in the full-text index
+type Field struct {
+	Name   string
+	Weight float64 // Score of one occurrence of a term in the field
+}
+
+// Fields are the properties in the full-text index, heaviest first
+var Fields = []Field{
+	{Name: "title", Weight: 4},
+	{Name: "originaltitle", Weight: 3},
+	{Name: "showtitle", Weight: 3},
+	{Name: "fileName", Weight: 1},
+	{Name: "plot", Weight: 1},
+}
+
+// stopwords are too common to be worth indexing
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "at": true, "by": true, "for": true,
+	"in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"the": true, "to": true, "with": true,
+}
+
+// foldings maps accented and special Latin letters to ASCII
+var foldings = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ș': "s",
+	'ť': "t", 'ț': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'æ': "ae", 'œ': "oe", 'ß': "ss", 'þ': "th",
+}
+
+// Token is an analyzed word and its byte range in the original text
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Fold lowercases s and strips accents
+func Fold(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := foldings[r]; ok {
+			b.WriteString(folded)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Analyze splits text into words and reduces each to its index term
+// (folded and stemmed). Stopwords are dropped.
+func Analyze(text string) []Token {
+	var tokens []Token
+
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := Fold(text[start:end])
+		if !stopwords[word] {
+			tokens = append(tokens, Token{Term: Stem(word), Start: start, End: end})
+		}
+		start = -1
+	}
+
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// Terms returns the distinct index terms of text
+func Terms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, token := range Analyze(text) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
+
+// Weights returns the weight of every term of a file: the number of
+// occurrences in each indexed field times the field weight
+func Weights(fields map[string]string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, field := range Fields {
+		for _, token := range Analyze(fields[field.Name]) {
+			weights[token.Term] += field.Weight
+		}
+	}
+	return weights
+}
+
+// invariant are words ending in s that are the same in the singular
+var invariant = map[string]bool{
+	"news": true, "series": true, "species": true, "lens": true,
+	"atlas": true, "bias": true, "cosmos": true,
+}
+
+// Stem reduces an English word to a stem shared by its singular and plural
+// forms. Plurals follow Porter's step 1a (sses -> ss, ies -> i, a final s
+// dropped unless the word part before it has no other vowel), then -ed and
+// -ing are removed, a final e is dropped and a final y after a consonant
+// becomes i, so "movie" and "movies" both give "movi".
+func Stem(word string) string {
+	n := len(word)
+	if n < 3 || invariant[word] {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:n-2]
+	case strings.HasSuffix(word, "ies"):
+		if n > 4 {
+			word = word[:n-2]
+		} else {
+			word = word[:n-1] // ties -> tie
+		}
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s") && hasVowel(word[:n-2]):
+		word = word[:n-1]
+	case n > 5 && strings.HasSuffix(word, "ing") && hasVowel(word[:n-3]):
+		word = undouble(word[:n-3])
+	case n > 4 && strings.HasSuffix(word, "ed") && !strings.HasSuffix(word, "eed") && hasVowel(word[:n-2]):
+		word = undouble(word[:n-2])
+	}
+
+	n = len(word)
+	switch {
+	case n > 3 && word[n-1] == 'e' && word[n-2] != 'e':
+		return word[:n-1]
+	case n > 2 && word[n-1] == 'y' && !isVowel(word[n-2]):
+		return word[:n-1] + "i"
+	}
+	return word
+}
+
+// isVowel returns true for an ASCII vowel
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+// hasVowel returns true if s contains an ASCII vowel, counting y (myths)
+func hasVowel(s string) bool {
+	return strings.ContainsAny(s, "aeiouy")
+}
+
+// undouble removes a doubled final consonant left by suffix stripping
+// (running -> runn -> run)
+func undouble(stem string) string {
+	n := len(stem)
+	if n > 2 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeioulsz", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+// MaxEdits returns how many typos a query term tolerates
+func MaxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// Distance returns the Levenshtein distance between a and b, or limit+1 if it
+// exceeds limit
+func Distance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+
+	if prev[len(rb)] > limit {
+		return limit + 1
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,29 @@
+package fulltext
+
+import (
+	"html"
+	"strings"
+)
+
+// Highlight wraps the words of text whose index term is in terms in <mark>
+// tags; the rest of the text is HTML-escaped. Returns false if no word matched.
+func Highlight(text string, terms map[string]bool) (string, bool) {
+	var b strings.Builder
+	matched := false
+
+	last := 0
+	for _, token := range Analyze(text) {
+		if !terms[token.Term] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:token.Start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[token.Start:token.End]))
+		b.WriteString("</mark>")
+		last = token.End
+		matched = true
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+
+	return b.String(), matched
+}
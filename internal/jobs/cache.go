@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// cacheKey identifies a version of a file: a file rewritten in place gets a
+// new size or mtime and so misses the cache
+func cacheKey(path string, info os.FileInfo) string {
+	return fmt.Sprintf("%s\x00%d\x00%d", path, info.Size(), info.ModTime().UnixNano())
+}
+
+// cacheEntry holds the digests computed for a version of a file
+type cacheEntry struct {
+	key     string
+	digests map[string]string
+}
+
+// digestCache is a least-recently-used cache of file digests
+type digestCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+// newDigestCache creates a cache holding up to max files
+func newDigestCache(max int) *digestCache {
+	return &digestCache{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached digests of a file if every algorithm was computed
+func (c *digestCache) get(key string, algorithms []string) (map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+
+	digests := make(map[string]string, len(algorithms))
+	for _, name := range algorithms {
+		digest, ok := entry.digests[name]
+		if !ok {
+			return nil, false
+		}
+		digests[name] = digest
+	}
+	c.order.MoveToFront(element)
+	return digests, true
+}
+
+// put adds digests to the cached digests of a file
+func (c *digestCache) put(key string, digests map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		for name, digest := range digests {
+			entry.digests[name] = digest
+		}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	entry := &cacheEntry{key: key, digests: make(map[string]string, len(digests))}
+	for name, digest := range digests {
+		entry.digests[name] = digest
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/metazla/meta-core/internal/unixfs"
+)
+
+// readBufferSize is the size of the reads hashing a file, and so the
+// granularity of progress and cancellation
+const readBufferSize = 1 << 20
+
+// CID layouts
+const (
+	LayoutRaw    = "raw"    // A single raw block: the sha256 of the whole file
+	LayoutUnixFS = "unixfs" // The UnixFS DAG `ipfs add --cid-version 1` builds
+)
+
+// unixfsDigest is the name the UnixFS root CID is computed and cached under,
+// alongside the digests
+const unixfsDigest = "unixfs"
+
+// digestAlgorithms are the supported digests by name
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+var (
+	// ErrUnsupportedDigest is returned for an unknown digest algorithm
+	ErrUnsupportedDigest = errors.New("unsupported digest")
+	// ErrUnsupportedLayout is returned for an unknown CID layout
+	ErrUnsupportedLayout = errors.New("unsupported layout")
+	// ErrInvalidPath is returned for a path outside FILES_PATH
+	ErrInvalidPath = errors.New("path must be within files directory")
+	// ErrFileNotFound is returned when the file does not exist
+	ErrFileNotFound = errors.New("file not found")
+	// ErrIsDirectory is returned when the path is a directory
+	ErrIsDirectory = errors.New("path is a directory, not a file")
+)
+
+// ResolvePath returns the absolute path and file info of a regular file
+// given relative to filesPath
+func ResolvePath(filesPath, relPath string) (string, os.FileInfo, error) {
+	if relPath == "" {
+		return "", nil, fmt.Errorf("%w: path is required", ErrInvalidPath)
+	}
+
+	root, err := filepath.Abs(filesPath)
+	if err != nil {
+		return "", nil, err
+	}
+	fullPath, err := filepath.Abs(filepath.Join(root, relPath))
+	if err != nil {
+		return "", nil, err
+	}
+	if fullPath != root && !strings.HasPrefix(fullPath, root+string(filepath.Separator)) {
+		return "", nil, ErrInvalidPath
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", nil, ErrFileNotFound
+	}
+	if info.IsDir() {
+		return "", nil, ErrIsDirectory
+	}
+	return fullPath, info, nil
+}
+
+// ParseDigests validates digest algorithm names and returns them sorted,
+// always including sha256, which the CID is built from
+func ParseDigests(names []string) ([]string, error) {
+	seen := map[string]bool{"sha256": true}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := digestAlgorithms[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedDigest, name)
+		}
+		seen[name] = true
+	}
+
+	algorithms := make([]string, 0, len(seen))
+	for name := range seen {
+		algorithms = append(algorithms, name)
+	}
+	sort.Strings(algorithms)
+	return algorithms, nil
+}
+
+// parseLayout validates a CID layout, defaulting to LayoutRaw, and returns
+// the names to compute for it in addition to the digests
+func parseLayout(layout string) (string, []string, error) {
+	switch strings.ToLower(layout) {
+	case "", LayoutRaw:
+		return LayoutRaw, nil, nil
+	case LayoutUnixFS:
+		return LayoutUnixFS, []string{unixfsDigest}, nil
+	default:
+		return "", nil, fmt.Errorf("%w: %q", ErrUnsupportedLayout, layout)
+	}
+}
+
+// ComputeDigests hashes a file with every algorithm in one pass
+// The algorithm "unixfs" builds the UnixFS root CID instead of a digest.
+// progress, if set, is called with the bytes read so far after each read.
+func ComputeDigests(ctx context.Context, path string, algorithms []string, progress func(int64)) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hashers := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	var builder *unixfs.Builder
+	for _, name := range algorithms {
+		if name == unixfsDigest {
+			builder = unixfs.NewBuilder(nil)
+			writers = append(writers, builder)
+			continue
+		}
+		newHash, ok := digestAlgorithms[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedDigest, name)
+		}
+		hashers[name] = newHash()
+		writers = append(writers, hashers[name])
+	}
+	out := io.MultiWriter(writers...)
+
+	buf := make([]byte, readBufferSize)
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := file.Read(buf)
+		if n > 0 {
+			out.Write(buf[:n])
+			total += int64(n)
+			if progress != nil {
+				progress(total)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	digests := make(map[string]string, len(hashers))
+	for name, hasher := range hashers {
+		digests[name] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	if builder != nil {
+		root, err := builder.Finish()
+		if err != nil {
+			return nil, err
+		}
+		digests[unixfsDigest] = root.String()
+	}
+	return digests, nil
+}
+
+// RawCID returns the CIDv1 of a single raw block with the given sha256
+// digest, as base32lower with the "b" multibase prefix
+func RawCID(sha256Sum []byte) string {
+	return unixfs.CIDFromDigest(unixfs.CodecRaw, sha256Sum).String()
+}
+
+// newResult builds the result of a CID job from its digests
+func newResult(size int64, layout string, computed map[string]string) (*Result, error) {
+	sum, err := hex.DecodeString(computed["sha256"])
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("missing sha256 digest")
+	}
+
+	result := &Result{CID: RawCID(sum), Layout: layout, Size: size, Digests: make(map[string]string, len(computed))}
+	for name, digest := range computed {
+		if name != unixfsDigest {
+			result.Digests[name] = digest
+		}
+	}
+	if layout == LayoutUnixFS {
+		result.CID = computed[unixfsDigest]
+	}
+	return result, nil
+}
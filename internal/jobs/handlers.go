@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Handlers provides HTTP handlers for jobs
+type Handlers struct {
+	manager *Manager
+}
+
+// NewHandlers creates new job handlers
+func NewHandlers(manager *Manager) *Handlers {
+	return &Handlers{manager: manager}
+}
+
+// RegisterRoutes registers all job routes
+func (h *Handlers) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/jobs/cid", h.handleSubmitCID).Methods("POST")
+	r.HandleFunc("/api/jobs/{id}", h.handleGetJob).Methods("GET")
+}
+
+// handleSubmitCID handles POST /api/jobs/cid
+// Responds 200 with the completed job on a cache hit, 202 otherwise.
+func (h *Handlers) handleSubmitCID(w http.ResponseWriter, r *http.Request) {
+	var req CIDJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	job, err := h.manager.SubmitCID(req)
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	status := http.StatusAccepted
+	if job.Status == StatusCompleted {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, job)
+}
+
+// handleGetJob handles GET /api/jobs/{id}
+func (h *Handlers) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Get(mux.Vars(r)["id"])
+	if err != nil {
+		writeManagerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// writeManagerError maps manager errors to HTTP status codes
+func writeManagerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrFileNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidPath), errors.Is(err, ErrIsDirectory), errors.Is(err, ErrUnsupportedDigest), errors.Is(err, ErrUnsupportedLayout):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrQueueFull):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Helper functions
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"error":   http.StatusText(status),
+		"message": message,
+	})
+}
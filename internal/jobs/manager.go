@@ -0,0 +1,328 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/metazla/meta-core/internal/config"
+)
+
+// pruneInterval is how often finished jobs past their retention are dropped
+const pruneInterval = time.Minute
+
+var (
+	// ErrNotFound is returned when a job ID does not exist
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned when every worker is busy and the queue is full
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+// target is a version of a file and what to compute for it
+type target struct {
+	fullPath   string
+	info       os.FileInfo
+	key        string // Cache key of the file version
+	layout     string
+	algorithms []string
+}
+
+// job is a queued, running or finished job
+// Its Job fields are guarded by the manager's lock, except bytesRead.
+type job struct {
+	Job
+	*target
+	bytesRead atomic.Int64
+}
+
+// Manager runs file jobs, such as computing CIDs, in a bounded pool of
+// workers. Hashing a large file takes longer than the HTTP write timeout, so
+// clients submit a job and poll it instead. Results are cached by path, size
+// and mtime, so a file that has not changed is never hashed twice.
+// Jobs live in memory: they are polled on the node they were submitted to.
+type Manager struct {
+	config    *config.Config
+	queue     chan *job
+	cache     *digestCache
+	retention time.Duration
+	mu        sync.Mutex
+	jobs      map[string]*job
+	active    map[string]*job // Queued or running jobs by cache key
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewManager creates a new job manager
+func NewManager(cfg *config.Config) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		config:    cfg,
+		queue:     make(chan *job, orDefault(cfg.JobQueueSize, 100)),
+		cache:     newDigestCache(orDefault(cfg.JobCacheSize, 10000)),
+		retention: time.Duration(orDefault(cfg.JobRetentionMS, 3600000)) * time.Millisecond,
+		jobs:      make(map[string]*job),
+		active:    make(map[string]*job),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Start starts the workers
+func (m *Manager) Start() {
+	workers := orDefault(m.config.JobWorkers, 2)
+	log.Printf("[Jobs] Starting %d workers", workers)
+
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	m.wg.Add(1)
+	go m.pruneLoop()
+}
+
+// Stop cancels running jobs and stops the workers
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// SubmitCID queues a job computing the CID and digests of a file given
+// relative to FILES_PATH. A cached result completes the job immediately, and
+// a request for a file already being hashed returns the running job.
+func (m *Manager) SubmitCID(req CIDJobRequest) (*Job, error) {
+	target, err := m.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:        uuid.NewString(),
+			Type:      TypeCID,
+			Path:      req.Path,
+			Layout:    target.layout,
+			Status:    StatusQueued,
+			Size:      target.info.Size(),
+			CreatedAt: time.Now().UnixMilli(),
+		},
+		target: target,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cached, ok := m.cache.get(target.key, target.algorithms); ok {
+		result, err := newResult(target.info.Size(), target.layout, cached)
+		if err != nil {
+			return nil, err
+		}
+		j.Status = StatusCompleted
+		j.Cached = true
+		j.Result = result
+		j.bytesRead.Store(target.info.Size())
+		j.CompletedAt = j.CreatedAt
+		m.jobs[j.ID] = j
+		return m.snapshot(j), nil
+	}
+
+	if running, ok := m.active[target.key]; ok && running.layout == target.layout && covers(running.algorithms, target.algorithms) {
+		return m.snapshot(running), nil
+	}
+
+	select {
+	case m.queue <- j:
+	default:
+		return nil, ErrQueueFull
+	}
+	m.jobs[j.ID] = j
+	m.active[target.key] = j
+	return m.snapshot(j), nil
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m.snapshot(j), nil
+}
+
+// ComputeCID computes the CID and digests of a file given relative to
+// FILES_PATH in the caller's goroutine, using and filling the cache
+func (m *Manager) ComputeCID(ctx context.Context, req CIDJobRequest) (*Result, error) {
+	target, err := m.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached, ok := m.cache.get(target.key, target.algorithms); ok {
+		return newResult(target.info.Size(), target.layout, cached)
+	}
+
+	computed, err := ComputeDigests(ctx, target.fullPath, target.algorithms, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheIfUnchanged(target.fullPath, target.key, computed)
+	return newResult(target.info.Size(), target.layout, computed)
+}
+
+// resolve validates a CID request and stats its file
+func (m *Manager) resolve(req CIDJobRequest) (*target, error) {
+	layout, extra, err := parseLayout(req.Layout)
+	if err != nil {
+		return nil, err
+	}
+	algorithms, err := ParseDigests(req.Digests)
+	if err != nil {
+		return nil, err
+	}
+	fullPath, info, err := ResolvePath(m.config.FilesPath, req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &target{
+		fullPath:   fullPath,
+		info:       info,
+		key:        cacheKey(fullPath, info),
+		layout:     layout,
+		algorithms: append(algorithms, extra...),
+	}, nil
+}
+
+// worker runs queued jobs until the manager stops
+func (m *Manager) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case j := <-m.queue:
+			m.run(j)
+		}
+	}
+}
+
+// run hashes the file of a job and records the outcome
+func (m *Manager) run(j *job) {
+	m.mu.Lock()
+	j.Status = StatusRunning
+	j.StartedAt = time.Now().UnixMilli()
+	m.mu.Unlock()
+
+	digests, err := ComputeDigests(m.ctx, j.fullPath, j.algorithms, j.bytesRead.Store)
+	var result *Result
+	if err == nil {
+		m.cacheIfUnchanged(j.fullPath, j.key, digests)
+		result, err = newResult(j.Size, j.layout, digests)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+		log.Printf("[Jobs] Job %s (%s) failed: %v", j.ID, j.Path, err)
+	} else {
+		j.Status = StatusCompleted
+		j.Result = result
+	}
+	j.CompletedAt = time.Now().UnixMilli()
+	if m.active[j.key] == j {
+		delete(m.active, j.key)
+	}
+}
+
+// cacheIfUnchanged caches digests unless the file changed while it was
+// being hashed, in which case they may match neither version
+func (m *Manager) cacheIfUnchanged(fullPath, key string, digests map[string]string) {
+	info, err := os.Stat(fullPath)
+	if err != nil || cacheKey(fullPath, info) != key {
+		return
+	}
+	m.cache.put(key, digests)
+}
+
+// pruneLoop drops finished jobs once their retention has passed
+func (m *Manager) pruneLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.prune(time.Now())
+		}
+	}
+}
+
+// prune drops jobs that finished before now minus the retention
+func (m *Manager) prune(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := now.Add(-m.retention).UnixMilli()
+	for id, j := range m.jobs {
+		if j.CompletedAt != 0 && j.CompletedAt < cutoff {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot returns a copy of a job with its current progress
+// (caller must hold the lock)
+func (m *Manager) snapshot(j *job) *Job {
+	snapshot := j.Job
+	snapshot.BytesRead = j.bytesRead.Load()
+	switch {
+	case snapshot.Status == StatusCompleted:
+		snapshot.Progress = 1
+	case snapshot.Size > 0:
+		snapshot.Progress = float64(snapshot.BytesRead) / float64(snapshot.Size)
+	}
+	if snapshot.Progress > 1 {
+		// The file grew while it was being hashed
+		snapshot.Progress = 1
+	}
+	return &snapshot
+}
+
+// covers returns true if algorithms has every wanted algorithm
+func covers(algorithms, wanted []string) bool {
+	have := make(map[string]bool, len(algorithms))
+	for _, name := range algorithms {
+		have[name] = true
+	}
+	for _, name := range wanted {
+		if !have[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// orDefault returns value, or defaultValue if it is not positive
+func orDefault(value, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
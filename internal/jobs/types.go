@@ -0,0 +1,47 @@
+package jobs
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// TypeCID is the type of jobs computing the CID and digests of a file
+const TypeCID = "cid"
+
+// Job describes a background job and its progress
+type Job struct {
+	ID          string  `json:"id"`
+	Type        string  `json:"type"`
+	Path        string  `json:"path"` // Relative to FILES_PATH
+	Layout      string  `json:"layout"`
+	Status      Status  `json:"status"`
+	Size        int64   `json:"size"`
+	BytesRead   int64   `json:"bytesRead"`
+	Progress    float64 `json:"progress"` // 0 to 1
+	Cached      bool    `json:"cached"`   // Answered from the digest cache
+	Result      *Result `json:"result,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	CreatedAt   int64   `json:"createdAt"` // Unix ms
+	StartedAt   int64   `json:"startedAt,omitempty"`
+	CompletedAt int64   `json:"completedAt,omitempty"`
+}
+
+// Result is the outcome of a CID job
+type Result struct {
+	CID     string            `json:"cid"`
+	Layout  string            `json:"layout"`
+	Size    int64             `json:"size"`
+	Digests map[string]string `json:"digests"` // Hex digest by algorithm
+}
+
+// CIDJobRequest is the request body for POST /api/jobs/cid
+type CIDJobRequest struct {
+	Path    string   `json:"path"`
+	Layout  string   `json:"layout"`  // "raw" (default) or "unixfs"
+	Digests []string `json:"digests"` // Computed in addition to sha256
+}
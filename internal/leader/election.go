@@ -1,14 +1,15 @@
 package leader
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/metazla/meta-core/internal/config"
@@ -22,8 +23,15 @@ type LeaderLockInfo struct {
 	BaseURL   string `json:"baseUrl,omitempty"`
 	Timestamp int64  `json:"timestamp"`
 	PID       int    `json:"pid"`
+	Epoch     int64  `json:"epoch,omitempty"` // Fencing token, increases with every new leader
 }
 
+// ErrNotLeader is returned by StepDown when this instance is not the leader
+var ErrNotLeader = errors.New("this instance is not the leader")
+
+// ErrNoSuccessor is returned by StepDown when no other node took over in time
+var ErrNoSuccessor = errors.New("no other node took over leadership")
+
 // Role represents the current role of this instance
 type Role string
 
@@ -33,13 +41,14 @@ const (
 	RoleFollower Role = "follower"
 )
 
-// Election handles leader election using flock on shared filesystem
+// Election handles leader election using a lock on the shared filesystem
 type Election struct {
 	config *config.Config
 
-	lockFile   *os.File
+	lock       LockBackend
 	role       Role
 	leaderInfo *LeaderLockInfo
+	epoch      int64 // Epoch held while leader
 	mu         sync.RWMutex
 
 	redisManager *RedisManager
@@ -49,17 +58,29 @@ type Election struct {
 	onBecomeLeader   func()
 	onBecomeFollower func(info *LeaderLockInfo)
 	onLeaderLost     func()
+	listeners        []func(LeadershipEvent)
+
+	// Follower state
+	leaderStale        bool
+	readingFromReplica bool
+	holdOffUntil       time.Time // Do not contend for the lock before this time
+
+	// transitionMu serializes role transitions between the health check loop
+	// and explicit requests such as StepDown
+	transitionMu sync.Mutex
 
 	// Lifecycle
-	stopChan     chan struct{}
+	stopChan       chan struct{}
 	isShuttingDown bool
-	wg           sync.WaitGroup
+	wg             sync.WaitGroup
 }
 
 // StorageConnector interface for connecting to Redis
 type StorageConnector interface {
 	Connect(url string) error
+	ConnectReplica(url string) error
 	Close() error
+	SetEpoch(epoch int64)
 }
 
 // NewElection creates a new leader election instance
@@ -102,6 +123,20 @@ func (e *Election) Start() error {
 		return fmt.Errorf("failed to create lock directory: %w", err)
 	}
 
+	lock, err := NewLockBackend(e.config)
+	if err != nil {
+		return err
+	}
+	e.lock = lock
+	log.Printf("[Election] Using %s lock backend", lock.Name())
+
+	if err := checkRedisMode(e.config.RedisMode); err != nil {
+		return err
+	}
+	if e.redisManager.Embedded() && e.config.RedisReplication {
+		log.Println("[Election] Warning: local replicas are not supported in embedded mode, followers read from the leader")
+	}
+
 	// Try to acquire the lock
 	acquired, err := e.tryAcquireLock()
 	if err != nil {
@@ -113,6 +148,7 @@ func (e *Election) Start() error {
 			return err
 		}
 	} else {
+		log.Println("[Election] Lock is held by another process")
 		if err := e.transitionToFollower(); err != nil {
 			return err
 		}
@@ -133,8 +169,8 @@ func (e *Election) Stop() error {
 
 	e.wg.Wait()
 
-	// Stop Redis if we were leader
-	if e.Role() == RoleLeader {
+	// Stop Redis if we were leader or are running a replica
+	if e.Role() == RoleLeader || e.redisManager.IsReplica() {
 		if err := e.redisManager.Stop(); err != nil {
 			log.Printf("[Election] Error stopping Redis: %v", err)
 		}
@@ -170,39 +206,18 @@ func (e *Election) IsLeader() bool {
 	return e.Role() == RoleLeader
 }
 
-// tryAcquireLock attempts to acquire exclusive flock on the lock file
+// tryAcquireLock attempts to acquire the leader lock without blocking
 func (e *Election) tryAcquireLock() (bool, error) {
-	lockPath := e.config.LockFilePath()
-
-	// Open or create the lock file
-	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0666)
-	if err != nil {
-		return false, fmt.Errorf("failed to open lock file: %w", err)
-	}
-
-	// Try non-blocking exclusive flock
-	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-	if err != nil {
-		f.Close()
-		if err == syscall.EWOULDBLOCK {
-			log.Println("[Election] Lock is held by another process")
-			return false, nil
-		}
-		return false, fmt.Errorf("flock failed: %w", err)
-	}
-
-	e.lockFile = f
-	log.Printf("[Election] Acquired flock on %s", lockPath)
-	return true, nil
+	return e.lock.TryAcquire()
 }
 
-// releaseLock releases the flock
+// releaseLock releases the leader lock
 func (e *Election) releaseLock() {
-	if e.lockFile != nil {
-		syscall.Flock(int(e.lockFile.Fd()), syscall.LOCK_UN)
-		e.lockFile.Close()
-		e.lockFile = nil
-		log.Println("[Election] Released flock")
+	if e.lock == nil {
+		return
+	}
+	if err := e.lock.Release(); err != nil {
+		log.Printf("[Election] Failed to release lock: %v", err)
 	}
 }
 
@@ -210,11 +225,16 @@ func (e *Election) releaseLock() {
 func (e *Election) transitionToLeader() error {
 	log.Println("[Election] Transitioning to LEADER role")
 
-	e.mu.Lock()
-	e.role = RoleLeader
-	e.mu.Unlock()
+	// Promote the local replica if we have one, otherwise start from disk
+	if e.redisManager.IsReplica() {
+		e.detachReplica()
+		if err := e.redisManager.Promote(); err != nil {
+			log.Printf("[Election] Failed to promote replica, restarting from disk: %v", err)
+			e.redisManager.Stop()
+		}
+	}
 
-	// Start Redis
+	// Start Redis (no-op if the promoted replica is already running)
 	if err := e.redisManager.Start(); err != nil {
 		return fmt.Errorf("failed to start Redis: %w", err)
 	}
@@ -224,10 +244,26 @@ func (e *Election) transitionToLeader() error {
 		return fmt.Errorf("Redis not ready: %w", err)
 	}
 
+	// Claim a new epoch so writes from any previous leader can be fenced off
+	epoch, err := e.nextEpoch()
+	if err != nil {
+		return fmt.Errorf("failed to allocate epoch: %w", err)
+	}
+	if err := e.redisManager.ClaimEpoch(epoch); err != nil {
+		return fmt.Errorf("failed to record epoch in Redis: %w", err)
+	}
+	log.Printf("[Election] Claimed leadership epoch %d", epoch)
+
 	// Build and write leader info
+	// Role is published together with the new info so that readers never
+	// see RoleLeader paired with the previous leader's info
 	info := e.buildLeaderInfo()
+	info.Epoch = epoch
 	e.mu.Lock()
+	previous := e.leaderInfo
+	e.role = RoleLeader
 	e.leaderInfo = info
+	e.epoch = epoch
 	e.mu.Unlock()
 
 	if err := e.writeLeaderInfo(info); err != nil {
@@ -236,6 +272,7 @@ func (e *Election) transitionToLeader() error {
 
 	// Connect storage to local Redis
 	if e.storage != nil {
+		e.storage.SetEpoch(epoch)
 		if err := e.storage.Connect(info.API); err != nil {
 			log.Printf("[Election] Warning: failed to connect storage: %v", err)
 		}
@@ -245,6 +282,7 @@ func (e *Election) transitionToLeader() error {
 	if e.onBecomeLeader != nil {
 		e.onBecomeLeader()
 	}
+	e.emit(EventBecameLeader, previous, info)
 
 	log.Println("[Election] Now acting as LEADER")
 	return nil
@@ -265,6 +303,7 @@ func (e *Election) transitionToFollower() error {
 	}
 
 	e.mu.Lock()
+	previous := e.leaderInfo
 	e.leaderInfo = info
 	e.mu.Unlock()
 
@@ -273,15 +312,19 @@ func (e *Election) transitionToFollower() error {
 
 		// Connect storage to leader's Redis
 		if e.storage != nil {
+			e.storage.SetEpoch(info.Epoch)
 			if err := e.storage.Connect(info.API); err != nil {
 				log.Printf("[Election] Warning: failed to connect to leader: %v", err)
 			}
 		}
 
+		e.syncReplica(info)
+
 		// Notify callback
 		if e.onBecomeFollower != nil {
 			e.onBecomeFollower(info)
 		}
+		e.emit(EventLeaderChanged, previous, info)
 	}
 
 	log.Println("[Election] Now acting as FOLLOWER")
@@ -293,9 +336,15 @@ func (e *Election) buildLeaderInfo() *LeaderLockInfo {
 	ip := getLocalIP()
 	hostname, _ := os.Hostname()
 
+	// A loopback-bound Redis is only reachable from this host
+	api := redisURL(e.config.RedisUsername, ip, e.config.RedisPort)
+	if e.config.RedisBindLoopback() {
+		api = e.redisManager.LocalURL()
+	}
+
 	return &LeaderLockInfo{
 		Host:      hostname,
-		API:       fmt.Sprintf("redis://%s:%d", ip, e.config.RedisPort),
+		API:       api,
 		HTTP:      fmt.Sprintf("http://%s:%d", ip, e.config.APIPort),
 		BaseURL:   e.config.BaseURL,
 		Timestamp: time.Now().UnixMilli(),
@@ -364,35 +413,352 @@ func (e *Election) healthCheckLoop() {
 
 // performHealthCheck checks health based on current role
 func (e *Election) performHealthCheck() {
+	e.transitionMu.Lock()
+	defer e.transitionMu.Unlock()
+
 	switch e.Role() {
 	case RoleLeader:
+		// Keep the lock alive (lease backends expire otherwise)
+		if err := e.lock.Renew(); err != nil {
+			e.stepDown(fmt.Sprintf("failed to renew lock: %v", err))
+			return
+		}
+
+		// Make sure no newer leader has been elected behind our back
+		if reason := e.checkFencing(); reason != "" {
+			e.stepDown(reason)
+			return
+		}
+
 		// Update timestamp in leader info
 		e.updateLeaderTimestamp()
 
 		// Check if Redis is still running
 		if !e.redisManager.IsRunning() {
-			log.Println("[Election] Redis not running, attempting restart...")
-			if err := e.redisManager.Start(); err != nil {
-				log.Printf("[Election] Failed to restart Redis: %v", err)
-			}
+			e.restartRedis()
 		}
 
 	case RoleFollower:
-		// Re-read leader info in case it changed
-		info, err := e.readLeaderInfo()
-		if err != nil {
-			log.Printf("[Election] Failed to read leader info: %v", err)
+		e.followerHealthCheck()
+	}
+}
+
+// followerHealthCheck contends for the lock and tracks the current leader
+func (e *Election) followerHealthCheck() {
+	if e.isShuttingDown {
+		return
+	}
+
+	// Retry the lock - it is released when the leader process dies
+	// (skipped right after a voluntary step-down so another node can win)
+	acquired, err := false, error(nil)
+	if time.Now().After(e.holdOffUntil) {
+		acquired, err = e.tryAcquireLock()
+	}
+	if err != nil {
+		log.Printf("[Election] Failed to retry lock: %v", err)
+	} else if acquired {
+		log.Println("[Election] Lock became available, taking over leadership")
+		if err := e.transitionToLeader(); err != nil {
+			log.Printf("[Election] Failed to take over leadership: %v", err)
+			e.abandonLeadership()
+		}
+		return
+	}
+
+	// Re-read leader info in case it changed
+	info, err := e.readLeaderInfo()
+	if err != nil {
+		log.Printf("[Election] Failed to read leader info: %v", err)
+		return
+	}
+
+	if info == nil {
+		return
+	}
+
+	// Detect a leader that stopped refreshing its timestamp while still
+	// holding the lock (e.g. stale NFS lock after a crash)
+	age := time.Now().UnixMilli() - info.Timestamp
+	if age > int64(e.config.LeaderStaleThresholdMS) {
+		if !e.leaderStale {
+			log.Printf("[Election] Leader info is stale (%dms old), leader presumed lost", age)
+			e.leaderStale = true
+			if e.onLeaderLost != nil {
+				e.onLeaderLost()
+			}
+			e.emit(EventLeaderLost, info, nil)
+		}
+		return
+	}
+	e.leaderStale = false
+
+	e.mu.Lock()
+	previous := e.leaderInfo
+	e.leaderInfo = info
+	e.mu.Unlock()
+
+	// Reconnect when a new leader has taken over
+	if previous == nil || previous.API != info.API || previous.PID != info.PID || previous.Host != info.Host || previous.Epoch != info.Epoch {
+		log.Printf("[Election] Leader changed, now at %s", info.API)
+
+		if e.storage != nil {
+			e.storage.SetEpoch(info.Epoch)
+			if err := e.storage.Connect(info.API); err != nil {
+				log.Printf("[Election] Warning: failed to connect to leader: %v", err)
+			}
+		}
+
+		if e.onBecomeFollower != nil {
+			e.onBecomeFollower(info)
+		}
+		e.emit(EventLeaderChanged, previous, info)
+	}
+
+	e.syncReplica(info)
+}
+
+// restartRedis restarts a crashed Redis once its backoff has elapsed
+// If Redis keeps crashing, leadership is handed to another node, which
+// holds its own copy of Redis (and possibly a healthier disk or host)
+func (e *Election) restartRedis() {
+	if e.redisManager.CrashLooping() {
+		status := e.redisManager.Status()
+		e.redisManager.ResetCrashes()
+
+		// Give other nodes a chance to win the lock before retrying
+		e.holdOffUntil = time.Now().Add(time.Duration(e.config.RedisRestartBackoffMaxMS) * time.Millisecond)
+		e.stepDown(fmt.Sprintf("Redis crashed %d times within %dms", status.RecentCrashes, e.config.RedisCrashWindowMS))
+		return
+	}
+
+	if !e.redisManager.RestartDue() {
+		return
+	}
+
+	status := e.redisManager.Status()
+	if status.LastExit != nil {
+		log.Printf("[Election] Redis not running (last exit: %s, %d recent crashes), attempting restart...", status.LastExit.Error, status.RecentCrashes)
+	} else {
+		log.Println("[Election] Redis not running, attempting restart...")
+	}
+	if err := e.redisManager.Start(); err != nil {
+		log.Printf("[Election] Failed to restart Redis: %v", err)
+	}
+}
+
+// RedisStatus returns the state of the locally managed Redis process
+func (e *Election) RedisStatus() RedisStatus {
+	return e.redisManager.Status()
+}
+
+// syncReplica keeps the local read replica following the current leader and
+// routes storage reads to it only while its replication link is up
+func (e *Election) syncReplica(info *LeaderLockInfo) {
+	if !e.config.RedisReplication || e.redisManager.Embedded() || isSelf(info) {
+		return
+	}
+
+	// Back off after replica crashes like the primary does
+	if !e.redisManager.IsRunning() && !e.redisManager.RestartDue() {
+		return
+	}
+
+	if err := e.redisManager.StartReplica(info.API); err != nil {
+		log.Printf("[Election] Failed to run local replica: %v", err)
+		e.detachReplica()
+		return
+	}
+
+	linkUp := e.redisManager.ReplicaLinkUp()
+	switch {
+	case linkUp && !e.readingFromReplica && e.storage != nil:
+		if err := e.storage.ConnectReplica(e.redisManager.LocalURL()); err != nil {
+			log.Printf("[Election] Failed to connect to local replica: %v", err)
 			return
 		}
+		e.readingFromReplica = true
+		log.Println("[Election] Local replica in sync, serving reads from it")
+	case !linkUp && e.readingFromReplica:
+		log.Println("[Election] Local replica out of sync, reading from leader")
+		e.detachReplica()
+	}
+}
+
+// detachReplica sends storage reads back to the leader
+func (e *Election) detachReplica() {
+	if !e.readingFromReplica || e.storage == nil {
+		e.readingFromReplica = false
+		return
+	}
+	if err := e.storage.ConnectReplica(""); err != nil {
+		log.Printf("[Election] Failed to detach replica: %v", err)
+	}
+	e.readingFromReplica = false
+}
+
+// isSelf returns true if the leader info describes this process
+func isSelf(info *LeaderLockInfo) bool {
+	hostname, _ := os.Hostname()
+	return info.PID == os.Getpid() && info.Host == hostname
+}
 
-		if info != nil {
-			e.mu.Lock()
-			e.leaderInfo = info
-			e.mu.Unlock()
+// StepDown hands leadership over to another node
+// Redis is snapshotted and stopped, the lock is released and this instance
+// becomes a follower that does not contend for the lock until ctx ends.
+// Blocks until another node reports leadership and returns its info.
+func (e *Election) StepDown(ctx context.Context) (*LeaderLockInfo, error) {
+	e.transitionMu.Lock()
+
+	if e.Role() != RoleLeader {
+		e.transitionMu.Unlock()
+		return nil, ErrNotLeader
+	}
+
+	e.mu.RLock()
+	oldEpoch := e.epoch
+	e.mu.RUnlock()
+
+	log.Println("[Election] Graceful step-down requested, flushing Redis...")
+	if err := e.redisManager.Persist(ctx); err != nil {
+		e.transitionMu.Unlock()
+		return nil, fmt.Errorf("failed to flush Redis: %w", err)
+	}
+
+	// Stay out of the election for the whole wait so another node can win
+	holdOff := time.Now().Add(3 * time.Duration(e.config.HealthCheckIntervalMS) * time.Millisecond)
+	if deadline, ok := ctx.Deadline(); ok && deadline.After(holdOff) {
+		holdOff = deadline
+	}
+	e.holdOffUntil = holdOff
+
+	e.stepDown("graceful handoff")
+	e.transitionMu.Unlock()
+
+	// Wait for a successor to publish its leader info
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.transitionMu.Lock()
+			e.holdOffUntil = time.Time{}
+			e.transitionMu.Unlock()
+			return nil, ErrNoSuccessor
+		case <-ticker.C:
+			info, err := e.readLeaderInfo()
+			if err != nil || info == nil {
+				continue
+			}
+			// A higher epoch can only come from a new leader: we hold off
+			if info.Epoch > oldEpoch {
+				log.Printf("[Election] Leadership handed over to %s (epoch %d)", info.Host, info.Epoch)
+				return info, nil
+			}
 		}
 	}
 }
 
+// Snapshot flushes the leader's Redis to SnapshotPath
+func (e *Election) Snapshot(ctx context.Context) error {
+	if e.Role() != RoleLeader {
+		return ErrNotLeader
+	}
+	return e.redisManager.Persist(ctx)
+}
+
+// SnapshotPath returns the file Snapshot writes
+func (e *Election) SnapshotPath() string {
+	return e.redisManager.SnapshotPath()
+}
+
+// RestoreSnapshot restarts the leader's Redis from a snapshot (see SnapshotPath)
+// Health checks are paused for the duration so Redis is not restarted
+// underneath the restore.
+func (e *Election) RestoreSnapshot(ctx context.Context, snapshotPath string) error {
+	e.transitionMu.Lock()
+	defer e.transitionMu.Unlock()
+
+	if e.Role() != RoleLeader {
+		return ErrNotLeader
+	}
+
+	if err := e.redisManager.Restore(ctx, snapshotPath); err != nil {
+		return err
+	}
+
+	// The snapshot carries the epoch it was taken under; put ours back so
+	// fencing keeps working
+	e.mu.RLock()
+	epoch := e.epoch
+	e.mu.RUnlock()
+
+	if err := e.redisManager.ClaimEpoch(epoch); err != nil {
+		return fmt.Errorf("failed to record epoch in Redis: %w", err)
+	}
+	return nil
+}
+
+// checkFencing looks for an epoch newer than our own in the lock directory,
+// the leader info file and Redis. Returns a reason if one is found.
+func (e *Election) checkFencing() string {
+	e.mu.RLock()
+	own := e.epoch
+	e.mu.RUnlock()
+
+	if fileEpoch, err := e.readEpoch(); err != nil {
+		log.Printf("[Election] Failed to read epoch file: %v", err)
+	} else if fileEpoch > own {
+		return fmt.Sprintf("epoch file has epoch %d, ours is %d", fileEpoch, own)
+	}
+
+	if info, err := e.readLeaderInfo(); err == nil && info != nil && info.Epoch > own {
+		return fmt.Sprintf("leader %s claims epoch %d, ours is %d", info.Host, info.Epoch, own)
+	}
+
+	if redisEpoch, err := e.redisManager.Epoch(); err == nil && redisEpoch > own {
+		return fmt.Sprintf("Redis has epoch %d, ours is %d", redisEpoch, own)
+	}
+
+	return ""
+}
+
+// stepDown gives up leadership after a newer leader has been detected
+func (e *Election) stepDown(reason string) {
+	log.Printf("[Election] Stepping down: %s", reason)
+
+	if e.onLeaderLost != nil {
+		e.onLeaderLost()
+	}
+
+	e.abandonLeadership()
+
+	e.mu.Lock()
+	previous := e.leaderInfo
+	e.leaderInfo = nil
+	e.epoch = 0
+	e.mu.Unlock()
+
+	e.emit(EventLeaderLost, previous, nil)
+
+	if err := e.transitionToFollower(); err != nil {
+		log.Printf("[Election] Failed to become follower: %v", err)
+	}
+}
+
+// abandonLeadership rolls back a failed takeover so another node can lead
+func (e *Election) abandonLeadership() {
+	if err := e.redisManager.Stop(); err != nil {
+		log.Printf("[Election] Error stopping Redis: %v", err)
+	}
+	e.releaseLock()
+
+	e.mu.Lock()
+	e.role = RoleFollower
+	e.mu.Unlock()
+}
+
 // updateLeaderTimestamp updates the timestamp in leader info
 func (e *Election) updateLeaderTimestamp() {
 	e.mu.Lock()
@@ -0,0 +1,59 @@
+package leader
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readEpoch reads the highest leadership epoch recorded in the lock directory
+// Returns 0 if no epoch has been recorded yet
+func (e *Election) readEpoch() (int64, error) {
+	data, err := os.ReadFile(e.config.EpochFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return 0, nil
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid epoch file: %w", err)
+	}
+	return epoch, nil
+}
+
+// nextEpoch increments and persists the leadership epoch
+// Must only be called while holding the leader lock
+func (e *Election) nextEpoch() (int64, error) {
+	current, err := e.readEpoch()
+	if err != nil {
+		return 0, err
+	}
+
+	// Never go backwards, even if the file was lost or rolled back
+	epoch := current + 1
+	if redisEpoch, err := e.redisManager.Epoch(); err == nil && redisEpoch >= epoch {
+		epoch = redisEpoch + 1
+	}
+
+	epochPath := e.config.EpochFilePath()
+	tempPath := epochPath + ".tmp"
+
+	if err := os.WriteFile(tempPath, []byte(strconv.FormatInt(epoch, 10)), 0644); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tempPath, epochPath); err != nil {
+		return 0, err
+	}
+
+	return epoch, nil
+}
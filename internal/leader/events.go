@@ -0,0 +1,75 @@
+package leader
+
+import (
+	"os"
+	"time"
+)
+
+// LeadershipEventType identifies an election transition
+type LeadershipEventType string
+
+const (
+	// EventBecameLeader is emitted when this instance becomes leader
+	EventBecameLeader LeadershipEventType = "became-leader"
+	// EventLeaderChanged is emitted when a follower sees a new leader
+	EventLeaderChanged LeadershipEventType = "leader-changed"
+	// EventLeaderLost is emitted when the leader is gone or this instance steps down
+	EventLeaderLost LeadershipEventType = "leader-lost"
+)
+
+// LeadershipEvent describes an election transition as seen by this instance
+type LeadershipEvent struct {
+	Type      LeadershipEventType `json:"type"`
+	Node      string              `json:"node"` // Hostname of the reporting instance
+	Role      Role                `json:"role"` // Role of the reporting instance after the transition
+	OldLeader *LeaderLockInfo     `json:"oldLeader,omitempty"`
+	NewLeader *LeaderLockInfo     `json:"newLeader,omitempty"`
+	Epoch     int64               `json:"epoch"`
+	Timestamp int64               `json:"timestamp"`
+}
+
+// Subscribe registers a listener for leadership events
+// Listeners are called synchronously from the election loop and must not block
+func (e *Election) Subscribe(fn func(LeadershipEvent)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+// emit notifies all listeners of a transition
+func (e *Election) emit(eventType LeadershipEventType, oldLeader, newLeader *LeaderLockInfo) {
+	hostname, _ := os.Hostname()
+
+	e.mu.RLock()
+	listeners := make([]func(LeadershipEvent), len(e.listeners))
+	copy(listeners, e.listeners)
+	role := e.role
+	e.mu.RUnlock()
+
+	event := LeadershipEvent{
+		Type:      eventType,
+		Node:      hostname,
+		Role:      role,
+		OldLeader: copyInfo(oldLeader),
+		NewLeader: copyInfo(newLeader),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if newLeader != nil {
+		event.Epoch = newLeader.Epoch
+	} else if oldLeader != nil {
+		event.Epoch = oldLeader.Epoch
+	}
+
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// copyInfo returns a copy of the info so listeners cannot mutate election state
+func copyInfo(info *LeaderLockInfo) *LeaderLockInfo {
+	if info == nil {
+		return nil
+	}
+	c := *info
+	return &c
+}
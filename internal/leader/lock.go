@@ -0,0 +1,46 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/metazla/meta-core/internal/config"
+)
+
+// Lock backend names accepted by LOCK_BACKEND
+const (
+	LockBackendFlock = "flock"
+	LockBackendLease = "lease"
+)
+
+// ErrLockLost is returned by Renew when the lock is no longer held
+var ErrLockLost = errors.New("leader lock lost")
+
+// LockBackend provides the exclusive lock that decides leadership
+type LockBackend interface {
+	// Name returns the backend identifier (e.g. "flock")
+	Name() string
+
+	// TryAcquire attempts to take the lock without blocking
+	// Returns false if another process holds it
+	TryAcquire() (bool, error)
+
+	// Renew keeps a held lock alive; called on every leader health check
+	// Returns ErrLockLost if the lock has been taken over
+	Renew() error
+
+	// Release gives up the lock if held
+	Release() error
+}
+
+// NewLockBackend creates the lock backend selected in config
+func NewLockBackend(cfg *config.Config) (LockBackend, error) {
+	switch cfg.LockBackend {
+	case "", LockBackendFlock:
+		return newFlockBackend(cfg.LockFilePath()), nil
+	case LockBackendLease:
+		return newLeaseBackend(cfg.LeaseFilePath(), cfg.LockLeaseTTLMS), nil
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q", cfg.LockBackend)
+	}
+}
@@ -0,0 +1,72 @@
+package leader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+)
+
+// flockBackend uses POSIX flock on a shared lock file
+// The lock is released automatically by the kernel when the process dies
+type flockBackend struct {
+	path string
+	file *os.File
+}
+
+func newFlockBackend(path string) *flockBackend {
+	return &flockBackend{path: path}
+}
+
+// Name returns the backend identifier
+func (b *flockBackend) Name() string {
+	return LockBackendFlock
+}
+
+// TryAcquire attempts to acquire exclusive flock on the lock file
+func (b *flockBackend) TryAcquire() (bool, error) {
+	if b.file != nil {
+		return true, nil
+	}
+
+	// Open or create the lock file
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	// Try non-blocking exclusive flock
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil // Held by another process
+		}
+		return false, fmt.Errorf("flock failed: %w", err)
+	}
+
+	b.file = f
+	log.Printf("[Election] Acquired flock on %s", b.path)
+	return true, nil
+}
+
+// Renew is a no-op: flock is held for as long as the file stays open
+func (b *flockBackend) Renew() error {
+	if b.file == nil {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release releases the flock
+func (b *flockBackend) Release() error {
+	if b.file == nil {
+		return nil
+	}
+
+	syscall.Flock(int(b.file.Fd()), syscall.LOCK_UN)
+	err := b.file.Close()
+	b.file = nil
+	log.Println("[Election] Released flock")
+	return err
+}
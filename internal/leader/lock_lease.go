@@ -0,0 +1,189 @@
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// leaseSettleDelay is how long to wait before re-reading a freshly written
+// lease, so that a concurrent writer's rename has landed before we verify
+const leaseSettleDelay = 200 * time.Millisecond
+
+// leaseRecord is the content of the lease file
+type leaseRecord struct {
+	Owner     string `json:"owner"`
+	Host      string `json:"host"`
+	PID       int    `json:"pid"`
+	RenewedAt int64  `json:"renewedAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// leaseBackend implements the lock as a lease file with a TTL
+// The holder renews the timestamp and mtime on every health check; the lease
+// can be taken over once both are older than the TTL. Works on filesystems
+// where flock is a no-op (object-storage backed volumes).
+type leaseBackend struct {
+	path  string
+	ttl   time.Duration
+	owner string
+	held  bool
+}
+
+func newLeaseBackend(path string, ttlMS int) *leaseBackend {
+	return &leaseBackend{
+		path:  path,
+		ttl:   time.Duration(ttlMS) * time.Millisecond,
+		owner: uuid.NewString(),
+	}
+}
+
+// Name returns the backend identifier
+func (b *leaseBackend) Name() string {
+	return LockBackendLease
+}
+
+// TryAcquire takes the lease if it is free, expired or already ours
+func (b *leaseBackend) TryAcquire() (bool, error) {
+	current, mtime, err := b.read()
+	if err != nil {
+		return false, err
+	}
+
+	if current != nil && current.Owner != b.owner && !b.expired(current, mtime) {
+		return false, nil // Held by another process
+	}
+
+	if err := b.write(); err != nil {
+		return false, err
+	}
+
+	// Verify we won against any concurrent writer
+	time.Sleep(leaseSettleDelay)
+	current, _, err = b.read()
+	if err != nil {
+		return false, err
+	}
+	if current == nil || current.Owner != b.owner {
+		log.Println("[Election] Lost lease race to another process")
+		return false, nil
+	}
+
+	b.held = true
+	log.Printf("[Election] Acquired lease on %s (ttl %s)", b.path, b.ttl)
+	return true, nil
+}
+
+// Renew extends the lease, failing if another process has taken it over
+func (b *leaseBackend) Renew() error {
+	if !b.held {
+		return ErrLockLost
+	}
+
+	current, _, err := b.read()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != b.owner {
+		b.held = false
+		return ErrLockLost
+	}
+
+	return b.write()
+}
+
+// Release removes the lease file if we hold it
+func (b *leaseBackend) Release() error {
+	if !b.held {
+		return nil
+	}
+	b.held = false
+
+	current, _, err := b.read()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != b.owner {
+		return nil
+	}
+
+	if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Println("[Election] Released lease")
+	return nil
+}
+
+// expired returns true if neither the timestamp nor the mtime was renewed
+// within the TTL
+func (b *leaseBackend) expired(record *leaseRecord, mtime time.Time) bool {
+	now := time.Now()
+	if now.UnixMilli() < record.ExpiresAt {
+		return false
+	}
+	return now.Sub(mtime) > b.ttl
+}
+
+// read loads the lease file, returning nil if it does not exist
+func (b *leaseBackend) read() (*leaseRecord, time.Time, error) {
+	stat, err := os.Stat(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	var record leaseRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		// A torn or corrupt lease is treated as expired
+		log.Printf("[Election] Ignoring unreadable lease file: %v", err)
+		return &leaseRecord{}, time.Time{}, nil
+	}
+
+	return &record, stat.ModTime(), nil
+}
+
+// write atomically replaces the lease file with a fresh lease owned by us
+func (b *leaseBackend) write() error {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+
+	record := leaseRecord{
+		Owner:     b.owner,
+		Host:      hostname,
+		PID:       os.Getpid(),
+		RenewedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(b.ttl).UnixMilli(),
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := fmt.Sprintf("%s.%s.tmp", b.path, b.owner)
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, b.path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// Renew mtime explicitly; some filesystems keep the old one on rename
+	return os.Chtimes(b.path, now, now)
+}
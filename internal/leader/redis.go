@@ -3,29 +3,52 @@ package leader
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
 	"github.com/redis/go-redis/v9"
 )
 
 // RedisManager handles spawning and managing the Redis process
+// On the leader it runs the primary; on followers (with replication enabled)
+// it runs a local read replica of the leader that can be promoted on failover.
+// In embedded mode the primary is served in-process (see redis_embedded.go).
 type RedisManager struct {
-	config  *config.Config
-	cmd     *exec.Cmd
-	running bool
-	mu      sync.RWMutex
+	config    *config.Config
+	cmd       *exec.Cmd
+	embedded  *embedded.Server // Set while running in embedded mode
+	exited    chan struct{}    // Closed once the current process has been reaped
+	running   bool
+	replicaOf string // Leader address (host:port) while running as replica
+	output    *lineRing
+
+	// Crash tracking (see redis_status.go)
+	crashes      []time.Time
+	totalCrashes int
+	nextRestart  time.Time
+	lastExit     *RedisExit
+
+	mu sync.RWMutex
 }
 
 // NewRedisManager creates a new Redis manager
 func NewRedisManager(cfg *config.Config) *RedisManager {
 	return &RedisManager{
 		config: cfg,
+		output: newLineRing(outputTailLines),
 	}
 }
 
@@ -34,9 +57,21 @@ func (rm *RedisManager) Start() error {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
+	return rm.startPrimary("yes")
+}
+
+// startPrimary spawns Redis as primary on the shared data directory
+// (caller must hold the lock)
+func (rm *RedisManager) startPrimary(appendOnly string) error {
 	if rm.running {
 		return nil
 	}
+	if err := rm.checkAuth(); err != nil {
+		return err
+	}
+	if rm.Embedded() {
+		return rm.startEmbedded()
+	}
 
 	// Ensure Redis data directory exists
 	dataDir := rm.config.RedisDataDir()
@@ -46,32 +81,477 @@ func (rm *RedisManager) Start() error {
 
 	log.Printf("[Redis] Spawning Redis on port %d...", rm.config.RedisPort)
 
-	// Build Redis arguments matching TypeScript implementation
+	args := rm.baseArgs(dataDir)
+	args = append(args,
+		"--appendonly", appendOnly,
+		"--appendfilename", "appendonly.aof",
+		"--dbfilename", "dump.rdb",
+	)
+	if rm.config.RedisAppendFsync != "" {
+		args = append(args, "--appendfsync", rm.config.RedisAppendFsync)
+	}
+	args = append(args, rm.saveArgs()...)
+
+	return rm.spawn(args, rm.secretConfig(false))
+}
+
+// StartReplica runs a local read replica of the leader at the given Redis URL
+// If a replica is already running it is re-pointed at the new leader
+func (rm *RedisManager) StartReplica(leaderURL string) error {
+	if rm.Embedded() {
+		return fmt.Errorf("replicas are not supported in embedded mode")
+	}
+
+	leaderAddr, err := redisAddr(leaderURL)
+	if err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(leaderAddr)
+	if err != nil {
+		return fmt.Errorf("invalid leader address %q: %w", leaderAddr, err)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if err := rm.checkAuth(); err != nil {
+		return err
+	}
+	if rm.running {
+		if rm.replicaOf == leaderAddr {
+			return nil
+		}
+		if rm.replicaOf == "" {
+			return fmt.Errorf("Redis is running as primary")
+		}
+
+		// Re-point the existing replica at the new leader
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		client := rm.localClient()
+		defer client.Close()
+
+		if err := client.Do(ctx, "REPLICAOF", host, port).Err(); err != nil {
+			return fmt.Errorf("replicaof failed: %w", err)
+		}
+		rm.replicaOf = leaderAddr
+		log.Printf("[Redis] Replica now following %s", leaderAddr)
+		return nil
+	}
+
+	// Replica data lives on local disk, never on the shared volume
+	dataDir := rm.config.RedisReplicaDir
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create replica data directory: %w", err)
+	}
+
+	log.Printf("[Redis] Spawning replica of %s on port %d...", leaderAddr, rm.config.RedisPort)
+
+	args := rm.baseArgs(dataDir)
+	args = append(args,
+		"--replicaof", host, port,
+		"--replica-read-only", "yes",
+		"--appendonly", "no",
+		"--save", "",
+	)
+
+	if err := rm.spawn(args, rm.secretConfig(true)); err != nil {
+		return err
+	}
+	rm.replicaOf = leaderAddr
+	return nil
+}
+
+// Promote turns a running replica into the primary
+// Persistence is switched to the shared data directory so the promoted
+// instance takes over durability from the old leader
+func (rm *RedisManager) Promote() error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if !rm.running || rm.replicaOf == "" {
+		return fmt.Errorf("no replica running")
+	}
+
+	dataDir := rm.config.RedisDataDir()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create Redis data directory: %w", err)
+	}
+
+	log.Printf("[Redis] Promoting replica of %s to primary...", rm.replicaOf)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := rm.localClient()
+	defer client.Close()
+
+	commands := [][]interface{}{
+		{"REPLICAOF", "NO", "ONE"},
+		{"CONFIG", "SET", "dir", dataDir},
+		{"CONFIG", "SET", "dbfilename", "dump.rdb"},
+		{"CONFIG", "SET", "save", rm.saveSchedule()},
+		{"CONFIG", "SET", "appendonly", "yes"},
+	}
+	if rm.config.RedisAppendFsync != "" {
+		commands = append(commands, []interface{}{"CONFIG", "SET", "appendfsync", rm.config.RedisAppendFsync})
+	}
+	for _, args := range commands {
+		if err := client.Do(ctx, args...).Err(); err != nil {
+			return fmt.Errorf("%v failed: %w", args, err)
+		}
+	}
+
+	rm.replicaOf = ""
+	log.Println("[Redis] Replica promoted to primary")
+	return nil
+}
+
+// Persist forces an RDB snapshot of the primary and waits for it to finish
+// The AOF is fsynced by Redis itself on graceful shutdown
+func (rm *RedisManager) Persist(ctx context.Context) error {
+	client := rm.localClient()
+	defer client.Close()
+
+	if err := client.BgSave(ctx).Err(); err != nil && !strings.Contains(err.Error(), "in progress") {
+		return fmt.Errorf("bgsave failed: %w", err)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for snapshot: %w", ctx.Err())
+		case <-ticker.C:
+			info, err := client.Info(ctx, "persistence").Result()
+			if err != nil {
+				return fmt.Errorf("info persistence failed: %w", err)
+			}
+			if strings.Contains(info, "rdb_bgsave_in_progress:1") {
+				continue
+			}
+			if !strings.Contains(info, "rdb_last_bgsave_status:ok") {
+				return fmt.Errorf("snapshot failed")
+			}
+			return nil
+		}
+	}
+}
+
+// Restore restarts the primary from an RDB snapshot
+// The current AOF is moved aside (it would otherwise take precedence over
+// the RDB on load), Redis is started with appendonly disabled so it loads the
+// snapshot, then AOF is re-enabled which rewrites it from the restored data.
+func (rm *RedisManager) Restore(ctx context.Context, snapshotPath string) error {
+	if rm.IsReplica() {
+		return fmt.Errorf("cannot restore a replica")
+	}
+
+	if err := rm.Stop(); err != nil {
+		return fmt.Errorf("failed to stop Redis: %w", err)
+	}
+
+	rm.mu.Lock()
+	dataDir := rm.config.RedisDataDir()
+	if rm.Embedded() {
+		// The embedded server has no AOF; it loads the snapshot on start
+		if err := copyFile(snapshotPath, rm.SnapshotPath()); err != nil {
+			rm.mu.Unlock()
+			return fmt.Errorf("failed to copy snapshot: %w", err)
+		}
+		log.Printf("[Redis] Restoring from %s", snapshotPath)
+		err := rm.startPrimary("no")
+		rm.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return rm.WaitForReady(30 * time.Second)
+	}
+
+	for _, name := range []string{"appendonlydir", "appendonly.aof"} {
+		path := filepath.Join(dataDir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		aside := path + ".pre-restore"
+		os.RemoveAll(aside)
+		if err := os.Rename(path, aside); err != nil {
+			rm.mu.Unlock()
+			return fmt.Errorf("failed to move %s aside: %w", name, err)
+		}
+	}
+
+	if err := copyFile(snapshotPath, rm.SnapshotPath()); err != nil {
+		rm.mu.Unlock()
+		return fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+
+	log.Printf("[Redis] Restoring from %s", snapshotPath)
+	err := rm.startPrimary("no")
+	rm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := rm.WaitForReady(30 * time.Second); err != nil {
+		return err
+	}
+
+	client := rm.localClient()
+	defer client.Close()
+
+	if err := client.ConfigSet(ctx, "appendonly", "yes").Err(); err != nil {
+		return fmt.Errorf("failed to re-enable AOF: %w", err)
+	}
+
+	// Wait for the AOF rewrite so the restored data is durable
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for AOF rewrite: %w", ctx.Err())
+		case <-ticker.C:
+			info, err := client.Info(ctx, "persistence").Result()
+			if err != nil {
+				return fmt.Errorf("info persistence failed: %w", err)
+			}
+			if strings.Contains(info, "aof_rewrite_in_progress:1") || strings.Contains(info, "aof_rewrite_scheduled:1") {
+				continue
+			}
+			log.Println("[Redis] Restore complete")
+			return nil
+		}
+	}
+}
+
+// copyFile copies src to dst through a temp file so dst is never partial
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tempPath := dst + ".tmp"
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, dst)
+}
+
+// IsReplica returns true if Redis is running as a replica of the leader
+func (rm *RedisManager) IsReplica() bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.running && rm.replicaOf != ""
+}
+
+// ReplicaLinkUp returns true if the local replica is in sync with the leader
+func (rm *RedisManager) ReplicaLinkUp() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := rm.localClient()
+	defer client.Close()
+
+	info, err := client.Info(ctx, "replication").Result()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(info, "master_link_status:up")
+}
+
+// LocalURL returns the Redis URL of the locally managed instance
+func (rm *RedisManager) LocalURL() string {
+	return redisURL(rm.config.RedisUsername, rm.localHost(), rm.config.RedisPort)
+}
+
+// localHost returns the address this instance reaches its own Redis at: a
+// loopback address from REDIS_BIND if it lists one, else the first address,
+// with wildcards mapped to the loopback of their family
+func (rm *RedisManager) localHost() string {
+	addrs := strings.Fields(rm.config.RedisBind)
+	for _, addr := range addrs {
+		addr = strings.TrimPrefix(addr, "-") // Optional address marker
+		if ip := net.ParseIP(addr); ip != nil && ip.IsLoopback() {
+			return addr
+		}
+	}
+	if len(addrs) == 0 {
+		return "127.0.0.1"
+	}
+
+	switch addr := strings.TrimPrefix(addrs[0], "-"); addr {
+	case "", "*", "0.0.0.0":
+		return "127.0.0.1"
+	case "::", "::*":
+		return "::1"
+	default:
+		return addr
+	}
+}
+
+// redisURL builds a Redis URL carrying the ACL username but never the
+// password, which clients take from their own config
+func redisURL(username, host string, port int) string {
+	u := url.URL{Scheme: "redis", Host: net.JoinHostPort(host, strconv.Itoa(port))}
+	if username != "" {
+		u.User = url.User(username)
+	}
+	return u.String()
+}
+
+// localClient creates a short-lived client for the local Redis
+func (rm *RedisManager) localClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(rm.localHost(), strconv.Itoa(rm.config.RedisPort)),
+		Username: rm.config.RedisUsername,
+		Password: rm.config.RedisPassword,
+	})
+}
+
+// checkAuth refuses to serve Redis to the network without a password
+// (see config.EnsureRedisPassword)
+func (rm *RedisManager) checkAuth() error {
+	if rm.config.RedisPassword == "" && !rm.config.RedisBindLoopback() {
+		return fmt.Errorf("refusing to start Redis on %q without a password: set REDIS_PASSWORD or bind to 127.0.0.1", rm.config.RedisBind)
+	}
+	return nil
+}
+
+// baseArgs returns the redis-server arguments shared by primary and replica
+// The leading "-" makes Redis read secretConfig from stdin, which keeps
+// passwords out of the process list
+func (rm *RedisManager) baseArgs(dataDir string) []string {
 	args := []string{
+		"-",
 		"--port", fmt.Sprintf("%d", rm.config.RedisPort),
-		"--bind", "0.0.0.0",
-		"--protected-mode", "no",
+		"--protected-mode", "yes",
 		"--dir", dataDir,
-		"--appendonly", "yes",
-		"--appendfilename", "appendonly.aof",
-		"--dbfilename", "dump.rdb",
-		"--save", "60", "1", // Save after 60 seconds if at least 1 key changed
 		"--loglevel", "warning",
 	}
 
+	// Unset options keep the redis-server defaults
+	optional := [][2]string{
+		{"--bind", rm.config.RedisBind},
+		{"--maxmemory", rm.config.RedisMaxMemory},
+		{"--maxmemory-policy", rm.config.RedisMaxMemoryPolicy},
+	}
+	for _, opt := range optional {
+		if opt[1] != "" {
+			args = append(args, opt[0], opt[1])
+		}
+	}
+	return args
+}
+
+// saveSchedule returns the RDB save schedule in CONFIG SET form
+func (rm *RedisManager) saveSchedule() string {
+	if rm.config.RedisSave == "none" {
+		return ""
+	}
+	return rm.config.RedisSave
+}
+
+// saveArgs returns the --save arguments for the configured schedule
+func (rm *RedisManager) saveArgs() []string {
+	schedule := strings.Fields(rm.saveSchedule())
+	if len(schedule) == 0 {
+		return []string{"--save", ""}
+	}
+	return append([]string{"--save"}, schedule...)
+}
+
+// secretConfig builds the authentication part of the Redis config
+// With a username the default user is disabled and meta-core connects as
+// that ACL user; otherwise the password is set with requirepass
+func (rm *RedisManager) secretConfig(replica bool) string {
+	var lines []string
+	username := rm.config.RedisUsername
+	password := rm.config.RedisPassword
+
+	if username != "" {
+		auth := "nopass"
+		if password != "" {
+			auth = quoteConfig(">" + password)
+		}
+		lines = append(lines,
+			"user default off resetpass -@all",
+			fmt.Sprintf("user %s on %s ~* &* +@all", quoteConfig(username), auth),
+		)
+	} else if password != "" {
+		lines = append(lines, "requirepass "+quoteConfig(password))
+	}
+
+	for _, rule := range rm.config.RedisACLUsers {
+		lines = append(lines, "user "+rule)
+	}
+
+	if replica {
+		if username != "" {
+			lines = append(lines, "masteruser "+quoteConfig(username))
+		}
+		if password != "" {
+			lines = append(lines, "masterauth "+quoteConfig(password))
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// quoteConfig quotes a value for the Redis config file format
+func quoteConfig(value string) string {
+	if !strings.ContainsAny(value, " \t\"'\\") {
+		return value
+	}
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return "\"" + value + "\""
+}
+
+// spawn starts redis-server with the given arguments, passing config on
+// stdin (caller must hold the lock)
+func (rm *RedisManager) spawn(args []string, stdinConfig string) error {
 	rm.cmd = exec.Command("redis-server", args...)
-	rm.cmd.Stdout = os.Stdout
-	rm.cmd.Stderr = os.Stderr
+	rm.cmd.Stdin = strings.NewReader(stdinConfig)
+	rm.output = newLineRing(outputTailLines)
+	rm.cmd.Stdout = io.MultiWriter(os.Stdout, rm.output)
+	rm.cmd.Stderr = io.MultiWriter(os.Stderr, rm.output)
 
 	if err := rm.cmd.Start(); err != nil {
+		rm.cmd = nil
+		rm.recordCrash(err)
 		return fmt.Errorf("failed to start Redis: %w", err)
 	}
 
 	rm.running = true
+	rm.exited = make(chan struct{})
 	log.Printf("[Redis] Started with PID %d", rm.cmd.Process.Pid)
 
 	// Monitor the process in background
-	go rm.monitorProcess()
+	go rm.monitorProcess(rm.cmd, rm.exited)
 
 	return nil
 }
@@ -81,6 +561,9 @@ func (rm *RedisManager) Stop() error {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
+	if rm.embedded != nil {
+		return rm.stopEmbedded()
+	}
 	if !rm.running || rm.cmd == nil || rm.cmd.Process == nil {
 		return nil
 	}
@@ -93,21 +576,18 @@ func (rm *RedisManager) Stop() error {
 	}
 
 	// Wait up to 10 seconds for graceful shutdown
-	done := make(chan error, 1)
-	go func() {
-		done <- rm.cmd.Wait()
-	}()
-
+	// The process is reaped by monitorProcess
 	select {
-	case <-done:
+	case <-rm.exited:
 		log.Println("[Redis] Stopped gracefully")
 	case <-time.After(10 * time.Second):
 		log.Println("[Redis] Timeout, sending SIGKILL...")
 		rm.cmd.Process.Kill()
-		<-done
+		<-rm.exited
 	}
 
 	rm.running = false
+	rm.replicaOf = ""
 	rm.cmd = nil
 	return nil
 }
@@ -126,9 +606,7 @@ func (rm *RedisManager) WaitForReady(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	client := redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("localhost:%d", rm.config.RedisPort),
-	})
+	client := rm.localClient()
 	defer client.Close()
 
 	ticker := time.NewTicker(100 * time.Millisecond)
@@ -152,26 +630,84 @@ func (rm *RedisManager) Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	client := redis.NewClient(&redis.Options{
-		Addr: fmt.Sprintf("localhost:%d", rm.config.RedisPort),
-	})
+	client := rm.localClient()
 	defer client.Close()
 
 	return client.Ping(ctx).Err()
 }
 
-// monitorProcess monitors the Redis process and updates state when it exits
-func (rm *RedisManager) monitorProcess() {
-	if rm.cmd == nil {
-		return
+// Epoch returns the leadership epoch recorded in Redis (0 if none)
+func (rm *RedisManager) Epoch() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client := rm.localClient()
+	defer client.Close()
+
+	epoch, err := client.Get(ctx, storage.EpochKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
 	}
+	return epoch, err
+}
+
+// ClaimEpoch records the leadership epoch in Redis
+// The stored value only ever increases; a lower epoch is rejected
+func (rm *RedisManager) ClaimEpoch(epoch int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	err := rm.cmd.Wait()
+	client := rm.localClient()
+	defer client.Close()
+
+	return client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, storage.EpochKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current > epoch {
+			return fmt.Errorf("%w: redis has epoch %d, claimed %d", storage.ErrStaleEpoch, current, epoch)
+		}
 
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, storage.EpochKey, epoch, 0)
+			return nil
+		})
+		return err
+	}, storage.EpochKey)
+}
+
+// redisAddr extracts host:port from a redis:// URL
+func redisAddr(redisURL string) (string, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Redis URL %q: %w", redisURL, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid Redis URL %q", redisURL)
+	}
+	return u.Host, nil
+}
+
+// monitorProcess monitors the Redis process and updates state when it exits
+func (rm *RedisManager) monitorProcess(cmd *exec.Cmd, exited chan struct{}) {
+	err := cmd.Wait()
+	close(exited)
+
+	// Stop (or a restart) may already have replaced the process
 	rm.mu.Lock()
-	rm.running = false
+	unexpected := rm.cmd == cmd
+	if unexpected {
+		rm.running = false
+		rm.replicaOf = ""
+		rm.cmd = nil
+		rm.recordCrash(err)
+	}
 	rm.mu.Unlock()
 
+	if !unexpected {
+		return
+	}
 	if err != nil {
 		log.Printf("[Redis] Process exited with error: %v", err)
 	} else {
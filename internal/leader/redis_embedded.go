@@ -0,0 +1,90 @@
+package leader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/metazla/meta-core/internal/embedded"
+)
+
+// Redis modes accepted by REDIS_MODE
+const (
+	RedisModeExternal = "external"
+	RedisModeEmbedded = "embedded"
+)
+
+// embeddedSnapshotFile is the snapshot written by the embedded server
+const embeddedSnapshotFile = "embedded.snapshot"
+
+// checkRedisMode validates the configured Redis mode
+func checkRedisMode(mode string) error {
+	switch mode {
+	case "", RedisModeExternal, RedisModeEmbedded:
+		return nil
+	default:
+		return fmt.Errorf("unknown Redis mode %q", mode)
+	}
+}
+
+// Embedded returns true if Redis is served in-process instead of by redis-server
+func (rm *RedisManager) Embedded() bool {
+	return rm.config.RedisMode == RedisModeEmbedded
+}
+
+// SnapshotPath returns the snapshot file of the primary in the data directory
+// (dump.rdb for redis-server, embedded.snapshot in embedded mode)
+func (rm *RedisManager) SnapshotPath() string {
+	if rm.Embedded() {
+		return filepath.Join(rm.config.RedisDataDir(), embeddedSnapshotFile)
+	}
+	return filepath.Join(rm.config.RedisDataDir(), "dump.rdb")
+}
+
+// startEmbedded serves the keyspace in-process (caller must hold the lock)
+// It listens on the same address and credentials as redis-server would, so
+// other instances and replicas-to-be connect to it unchanged.
+func (rm *RedisManager) startEmbedded() error {
+	dataDir := rm.config.RedisDataDir()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create Redis data directory: %w", err)
+	}
+
+	if len(rm.config.RedisACLUsers) > 0 {
+		log.Println("[Redis] Warning: additional ACL users are ignored in embedded mode")
+	}
+
+	log.Printf("[Redis] Starting embedded server on port %d...", rm.config.RedisPort)
+
+	server := embedded.NewServer(embedded.Options{
+		Addr:         fmt.Sprintf("%s:%d", rm.config.RedisBind, rm.config.RedisPort),
+		Username:     rm.config.RedisUsername,
+		Password:     rm.config.RedisPassword,
+		SnapshotPath: rm.SnapshotPath(),
+	})
+	if err := server.Start(); err != nil {
+		rm.recordCrash(err)
+		return fmt.Errorf("failed to start embedded Redis: %w", err)
+	}
+
+	rm.embedded = server
+	rm.running = true
+	return nil
+}
+
+// stopEmbedded stops the embedded server, writing a final snapshot
+// (caller must hold the lock)
+func (rm *RedisManager) stopEmbedded() error {
+	log.Println("[Redis] Stopping embedded server...")
+
+	err := rm.embedded.Close()
+	rm.embedded = nil
+	rm.running = false
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	log.Println("[Redis] Stopped gracefully")
+	return nil
+}
@@ -0,0 +1,179 @@
+package leader
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputTailLines is how many lines of redis-server output are kept
+const outputTailLines = 50
+
+// RedisStatus describes the managed Redis process
+type RedisStatus struct {
+	Running        bool       `json:"running"`
+	Mode           string     `json:"mode,omitempty"` // "primary", "replica" or "embedded"
+	PID            int        `json:"pid,omitempty"`
+	TotalCrashes   int        `json:"totalCrashes"`
+	RecentCrashes  int        `json:"recentCrashes"` // Within the crash window
+	CrashThreshold int        `json:"crashThreshold"`
+	NextRestartAt  int64      `json:"nextRestartAt,omitempty"` // Unix ms, while backing off
+	LastExit       *RedisExit `json:"lastExit,omitempty"`
+}
+
+// RedisExit describes an unexpected exit of the Redis process
+type RedisExit struct {
+	Time   int64    `json:"time"`
+	Error  string   `json:"error"`
+	Output []string `json:"output,omitempty"` // Last lines of stderr and stdout (Redis logs to stdout)
+}
+
+// Status returns the current state of the managed process
+func (rm *RedisManager) Status() RedisStatus {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	status := RedisStatus{
+		Running:        rm.running,
+		TotalCrashes:   rm.totalCrashes,
+		RecentCrashes:  rm.recentCrashesLocked(),
+		CrashThreshold: rm.config.RedisCrashThreshold,
+		LastExit:       rm.lastExit,
+	}
+	if rm.running && rm.embedded != nil {
+		status.Mode = "embedded"
+		status.PID = os.Getpid()
+	} else if rm.running {
+		status.Mode = "primary"
+		if rm.replicaOf != "" {
+			status.Mode = "replica"
+		}
+		if rm.cmd != nil && rm.cmd.Process != nil {
+			status.PID = rm.cmd.Process.Pid
+		}
+	} else if time.Now().Before(rm.nextRestart) {
+		status.NextRestartAt = rm.nextRestart.UnixMilli()
+	}
+	return status
+}
+
+// RestartDue returns true once the backoff after the last crash has elapsed
+func (rm *RedisManager) RestartDue() bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return !time.Now().Before(rm.nextRestart)
+}
+
+// CrashLooping returns true if Redis crashed at least the configured number
+// of times within the crash window
+func (rm *RedisManager) CrashLooping() bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	threshold := rm.config.RedisCrashThreshold
+	return threshold > 0 && rm.recentCrashesLocked() >= threshold
+}
+
+// ResetCrashes clears the crash history and backoff
+// The last exit is kept for diagnostics
+func (rm *RedisManager) ResetCrashes() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.crashes = nil
+	rm.nextRestart = time.Time{}
+}
+
+// recordCrash records an unexpected exit or failed start and schedules the
+// next restart with exponential backoff (caller must hold the lock)
+func (rm *RedisManager) recordCrash(err error) {
+	now := time.Now()
+
+	message := "exited"
+	if err != nil {
+		message = err.Error()
+	}
+	rm.lastExit = &RedisExit{
+		Time:   now.UnixMilli(),
+		Error:  message,
+		Output: rm.output.Lines(),
+	}
+
+	rm.totalCrashes++
+	recent := rm.recentCrashesLocked()
+	rm.crashes = append(rm.crashes[len(rm.crashes)-recent:], now)
+	recent++
+
+	backoff := time.Duration(rm.config.RedisRestartBackoffMS) * time.Millisecond
+	maxBackoff := time.Duration(rm.config.RedisRestartBackoffMaxMS) * time.Millisecond
+	for i := 1; i < recent && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	rm.nextRestart = now.Add(backoff)
+}
+
+// recentCrashesLocked returns the number of crashes within the crash window
+// Crashes are recorded in order, so they are the tail of the slice
+// (caller must hold the lock)
+func (rm *RedisManager) recentCrashesLocked() int {
+	cutoff := time.Now().Add(-time.Duration(rm.config.RedisCrashWindowMS) * time.Millisecond)
+	count := 0
+	for i := len(rm.crashes) - 1; i >= 0 && rm.crashes[i].After(cutoff); i-- {
+		count++
+	}
+	return count
+}
+
+// lineRing keeps the last lines written to it
+type lineRing struct {
+	lines   []string
+	partial []byte
+	max     int
+	mu      sync.Mutex
+}
+
+func newLineRing(max int) *lineRing {
+	return &lineRing{max: max}
+}
+
+// Write implements io.Writer
+func (r *lineRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.add(strings.TrimRight(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	r.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// add appends a line, dropping the oldest (caller must hold the lock)
+func (r *lineRing) add(line string) {
+	if len(r.lines) == r.max {
+		r.lines = r.lines[1:]
+	}
+	r.lines = append(r.lines, line)
+}
+
+// Lines returns a copy of the buffered lines, including a trailing partial line
+func (r *lineRing) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := make([]string, len(r.lines), len(r.lines)+1)
+	copy(lines, r.lines)
+	if len(r.partial) > 0 {
+		lines = append(lines, string(r.partial))
+	}
+	return lines
+}
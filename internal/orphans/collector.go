@@ -0,0 +1,461 @@
+package orphans
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/storage"
+	"github.com/metazla/meta-core/internal/watcher"
+)
+
+const (
+	// Source is the change history source of the collector's writes
+	Source = "orphans"
+	// eventQueueSize is the number of file events waiting to be handled
+	// before new ones are dropped
+	eventQueueSize = 10000
+	// maxSeen bounds the partial hashes remembered for relinking
+	maxSeen = 10000
+)
+
+// Collector keeps metadata in step with the files on disk, driven by file
+// watcher events. Metadata whose file is deleted is marked orphaned
+// (status=missing) rather than deleted, since the file may come back: when a
+// file with its hash ID, or with the same partial hash, appears again the
+// metadata is relinked to it. Orphans missing for longer than the retention
+// are purged by a periodic collection. Only the leader acts on events.
+type Collector struct {
+	config   *config.Config
+	election *leader.Election // nil acts as leader
+	store    storage.Store
+	events   chan watcher.FileEvent
+	mu       sync.Mutex        // Serializes event handling and collections
+	seen     map[string]string // Partial hash to path of files without metadata
+	orphans  []storage.Orphan  // Orphans cached for the event batch being handled
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewCollector creates a new orphan collector
+func NewCollector(cfg *config.Config, election *leader.Election, store storage.Store) *Collector {
+	return &Collector{
+		config:   cfg,
+		election: election,
+		store:    store.WithSource(Source),
+		events:   make(chan watcher.FileEvent, eventQueueSize),
+		seen:     make(map[string]string),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start handles queued file events and runs periodic collections in the
+// background
+func (c *Collector) Start() {
+	c.wg.Add(1)
+	go c.eventLoop()
+
+	if c.config.OrphanGCIntervalMS <= 0 {
+		log.Println("[Orphans] Periodic collection disabled")
+		return
+	}
+
+	interval := time.Duration(c.config.OrphanGCIntervalMS) * time.Millisecond
+	log.Printf("[Orphans] Collecting every %s", interval)
+
+	c.wg.Add(1)
+	go c.collectLoop(interval)
+}
+
+// Stop stops handling events and collecting
+func (c *Collector) Stop() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+// HandleEvent queues a file event, dropping it if the queue is full
+// It never blocks, so it can listen to the watcher's dispatcher.
+func (c *Collector) HandleEvent(event watcher.FileEvent) {
+	select {
+	case c.events <- event:
+	default:
+		log.Printf("[Orphans] Warning: event queue full, dropping %s %s", event.Type, event.Path)
+	}
+}
+
+// eventLoop handles queued events in order
+func (c *Collector) eventLoop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case event := <-c.events:
+			if !c.isLeader() || !c.store.IsConnected() {
+				continue
+			}
+			// Handle whatever queued up meanwhile as one batch
+			batch := []watcher.FileEvent{event}
+			for len(batch) < eventQueueSize && len(c.events) > 0 {
+				batch = append(batch, <-c.events)
+			}
+			c.processBatch(batch)
+		}
+	}
+}
+
+// collectLoop runs a collection on every tick while this instance is leader
+func (c *Collector) collectLoop(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			if !c.isLeader() || !c.store.IsConnected() {
+				continue
+			}
+			if _, err := c.Collect(time.Now()); err != nil {
+				log.Printf("[Orphans] Collection failed: %v", err)
+			}
+		}
+	}
+}
+
+// isLeader returns true if this instance acts on events
+func (c *Collector) isLeader() bool {
+	return c.election == nil || c.election.IsLeader()
+}
+
+// Process applies a file event to the metadata: a deleted or renamed-away
+// file orphans the metadata at its path, and an added or changed file
+// updates (or relinks) the metadata it belongs to
+func (c *Collector) Process(event watcher.FileEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.dropOrphans()
+
+	return c.process(event)
+}
+
+// processBatch applies events in order, logging the ones that fail
+// The orphan list is read at most once for the batch.
+func (c *Collector) processBatch(events []watcher.FileEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.dropOrphans()
+
+	for _, event := range events {
+		if err := c.process(event); err != nil {
+			log.Printf("[Orphans] Failed to handle %s %s: %v", event.Type, event.Path, err)
+		}
+	}
+}
+
+// process applies one event; the caller holds c.mu
+func (c *Collector) process(event watcher.FileEvent) error {
+	switch event.Type {
+	case watcher.EventTypeDelete, watcher.EventTypeRename:
+		return c.markMissing(storage.NormalizePath(event.Path))
+	case watcher.EventTypeAdd, watcher.EventTypeChange:
+		return c.identify(storage.NormalizePath(event.Path), event.HashID, event.PartialHash)
+	}
+	return nil
+}
+
+// markMissing orphans the metadata of the files at a path, unless a file
+// was written there again since the event (e.g. an editor's atomic save)
+func (c *Collector) markMissing(relPath string) error {
+	if c.exists(relPath) {
+		return nil
+	}
+
+	hashIDs, err := c.store.LookupHashesByPath(relPath)
+	if err != nil {
+		return err
+	}
+
+	missingSince := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for _, hashID := range hashIDs {
+		metadata, revision, err := c.store.GetMetadataRevision(hashID)
+		if err != nil {
+			return err
+		}
+		if metadata[storage.StatusProperty] == storage.StatusMissing {
+			continue
+		}
+
+		applied, err := c.applied(storage.BatchOp{
+			HashID:     hashID,
+			IfRevision: &revision,
+			Set: map[string]string{
+				storage.StatusProperty:       storage.StatusMissing,
+				storage.MissingSinceProperty: missingSince,
+			},
+		})
+		if err != nil || !applied {
+			return err
+		}
+		if c.orphans != nil {
+			c.orphans = append(c.orphans, storage.Orphan{
+				HashID:      hashID,
+				Path:        metadata[storage.FilePathProperty],
+				PartialHash: metadata[storage.PartialHashProperty],
+			})
+		}
+		log.Printf("[Orphans] %s is missing (%s)", hashID, relPath)
+	}
+	return nil
+}
+
+// identify updates the metadata of a file that was added or changed: the
+// metadata with its hash ID if there is any, or else the one orphan with
+// its partial hash
+func (c *Collector) identify(relPath, hashID, partialHash string) error {
+	if hashID != "" {
+		metadata, revision, err := c.store.GetMetadataRevision(hashID)
+		if err != nil {
+			return err
+		}
+		if len(metadata) > 0 {
+			return c.update(hashID, metadata, revision, relPath, partialHash)
+		}
+	}
+
+	if partialHash == "" {
+		return nil
+	}
+
+	orphans, err := c.orphanList()
+	if err != nil {
+		return err
+	}
+	var matches []storage.Orphan
+	for _, orphan := range orphans {
+		if orphan.PartialHash == partialHash {
+			matches = append(matches, orphan)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		// The file may have been moved here before its old path is reported
+		// deleted: remember it for the next collection
+		if len(c.seen) >= maxSeen {
+			c.seen = make(map[string]string)
+		}
+		c.seen[partialHash] = relPath
+		return nil
+	case 1:
+		return c.relink(matches[0].HashID, relPath, partialHash)
+	default:
+		log.Printf("[Orphans] %d orphans share the partial hash of %s, not relinking", len(matches), relPath)
+		return nil
+	}
+}
+
+// update records the path and partial hash of a file whose metadata exists
+// The path only moves if the metadata is orphaned or its old path is gone,
+// so a copy of a file does not take over its metadata.
+func (c *Collector) update(hashID string, metadata map[string]string, revision int64, relPath, partialHash string) error {
+	op := storage.BatchOp{HashID: hashID, IfRevision: &revision, Set: make(map[string]string)}
+
+	orphaned := metadata[storage.StatusProperty] == storage.StatusMissing
+	oldPath := storage.NormalizePath(metadata[storage.FilePathProperty])
+	if oldPath != relPath && (orphaned || oldPath == "" || !c.exists(oldPath)) {
+		op.Set[storage.FilePathProperty] = relPath
+	}
+	if partialHash != "" && metadata[storage.PartialHashProperty] != partialHash && (oldPath == relPath || op.Set[storage.FilePathProperty] != "") {
+		op.Set[storage.PartialHashProperty] = partialHash
+	}
+	if orphaned && (oldPath == relPath || op.Set[storage.FilePathProperty] != "") {
+		op.Unset = []string{storage.StatusProperty, storage.MissingSinceProperty}
+		log.Printf("[Orphans] Relinked %s to %s", hashID, relPath)
+	}
+
+	if len(op.Set) == 0 && len(op.Unset) == 0 {
+		return nil
+	}
+	return c.apply(op)
+}
+
+// relink points orphaned metadata at a file and clears its missing status
+func (c *Collector) relink(hashID, relPath, partialHash string) error {
+	metadata, revision, err := c.store.GetMetadataRevision(hashID)
+	if err != nil {
+		return err
+	}
+	if metadata[storage.StatusProperty] != storage.StatusMissing {
+		return nil
+	}
+
+	op := storage.BatchOp{
+		HashID:     hashID,
+		IfRevision: &revision,
+		Set:        map[string]string{storage.FilePathProperty: relPath},
+		Unset:      []string{storage.StatusProperty, storage.MissingSinceProperty},
+	}
+	if partialHash != "" {
+		op.Set[storage.PartialHashProperty] = partialHash
+	}
+	applied, err := c.applied(op)
+	if err != nil || !applied {
+		return err
+	}
+	for i, orphan := range c.orphans {
+		if orphan.HashID == hashID {
+			c.orphans = append(c.orphans[:i], c.orphans[i+1:]...)
+			break
+		}
+	}
+
+	log.Printf("[Orphans] Relinked %s to %s", hashID, relPath)
+	return nil
+}
+
+// orphanList returns the orphans, read once per event batch and kept in step
+// with the batch's own writes; the caller holds c.mu
+// A stale entry is harmless: relink re-reads the file before writing.
+func (c *Collector) orphanList() ([]storage.Orphan, error) {
+	if c.orphans == nil {
+		orphans, err := c.store.Orphans()
+		if err != nil {
+			return nil, err
+		}
+		c.orphans = orphans
+	}
+	return c.orphans, nil
+}
+
+// dropOrphans forgets the orphans cached for an event batch
+func (c *Collector) dropOrphans() {
+	c.orphans = nil
+}
+
+// purge deletes orphaned metadata that is still missing since before the
+// cutoff, at the revision it was checked at. Returns true if it was deleted.
+func (c *Collector) purge(hashID string, cutoff time.Time) (bool, error) {
+	metadata, revision, err := c.store.GetMetadataRevision(hashID)
+	if err != nil {
+		return false, err
+	}
+	if metadata[storage.StatusProperty] != storage.StatusMissing {
+		return false, nil
+	}
+	ms, err := strconv.ParseInt(metadata[storage.MissingSinceProperty], 10, 64)
+	if err != nil || !time.UnixMilli(ms).Before(cutoff) {
+		return false, nil
+	}
+
+	return c.applied(storage.BatchOp{HashID: hashID, IfRevision: &revision, Delete: true})
+}
+
+// Collect relinks orphans whose file is back at its path, or was seen
+// elsewhere with the same partial hash, and purges orphans missing since
+// before now minus the retention. Returns leader.ErrNotLeader on followers.
+func (c *Collector) Collect(now time.Time) (*CollectResult, error) {
+	if !c.isLeader() {
+		return nil, leader.ErrNotLeader
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orphans, err := c.store.Orphans()
+	if err != nil {
+		return nil, err
+	}
+
+	retention := time.Duration(c.config.OrphanRetentionMS) * time.Millisecond
+	result := &CollectResult{}
+	for _, orphan := range orphans {
+		relPath := storage.NormalizePath(orphan.Path)
+		if seenPath, ok := c.seen[orphan.PartialHash]; ok && orphan.PartialHash != "" && !c.exists(relPath) {
+			delete(c.seen, orphan.PartialHash)
+			relPath = seenPath
+		}
+
+		if relPath != "" && c.exists(relPath) {
+			if err := c.relink(orphan.HashID, relPath, orphan.PartialHash); err != nil {
+				return result, err
+			}
+			result.Relinked++
+			continue
+		}
+
+		if retention > 0 && !orphan.MissingSince.IsZero() && now.Sub(orphan.MissingSince) > retention {
+			purged, err := c.purge(orphan.HashID, now.Add(-retention))
+			if err != nil {
+				return result, err
+			}
+			if !purged {
+				continue
+			}
+			log.Printf("[Orphans] Purged %s, missing since %s", orphan.HashID, orphan.MissingSince.Format(time.RFC3339))
+			result.Purged++
+		}
+	}
+
+	if result.Relinked > 0 || result.Purged > 0 {
+		log.Printf("[Orphans] Collection relinked %d and purged %d of %d orphans", result.Relinked, result.Purged, len(orphans))
+	}
+	return result, nil
+}
+
+// List returns the orphans, the longest missing first
+func (c *Collector) List() ([]OrphanInfo, error) {
+	orphans, err := c.store.Orphans()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]OrphanInfo, len(orphans))
+	for i, orphan := range orphans {
+		infos[i] = OrphanInfo{
+			HashID:      orphan.HashID,
+			Path:        orphan.Path,
+			PartialHash: orphan.PartialHash,
+		}
+		if !orphan.MissingSince.IsZero() {
+			infos[i].MissingSince = orphan.MissingSince.UnixMilli()
+		}
+	}
+	return infos, nil
+}
+
+// apply writes one operation, skipping it if the file changed since it was
+// read: the next event or collection sees the new state
+func (c *Collector) apply(op storage.BatchOp) error {
+	_, err := c.applied(op)
+	return err
+}
+
+// applied is apply that also returns whether the operation was written
+func (c *Collector) applied(op storage.BatchOp) (bool, error) {
+	_, err := c.store.ApplyBatch([]storage.BatchOp{op})
+	if errors.Is(err, storage.ErrRevisionMismatch) {
+		log.Printf("[Orphans] %s changed concurrently, skipping", op.HashID)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// exists returns true if a file exists at a path relative to FILES_PATH
+func (c *Collector) exists(relPath string) bool {
+	if relPath == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(c.config.FilesPath, filepath.FromSlash(relPath)))
+	return err == nil
+}
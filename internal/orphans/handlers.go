@@ -0,0 +1,77 @@
+package orphans
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/leader"
+)
+
+// Handlers provides HTTP handlers for orphan operations
+type Handlers struct {
+	collector *Collector
+}
+
+// NewHandlers creates new orphan handlers
+func NewHandlers(collector *Collector) *Handlers {
+	return &Handlers{collector: collector}
+}
+
+// RegisterRoutes registers all orphan-related routes
+func (h *Handlers) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/orphans", h.handleListOrphans).Methods("GET")
+	r.HandleFunc("/api/orphans/gc", h.handleCollect).Methods("POST")
+}
+
+// handleListOrphans handles GET /api/orphans
+func (h *Handlers) handleListOrphans(w http.ResponseWriter, r *http.Request) {
+	orphans, err := h.collector.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, OrphansListResponse{
+		Orphans: orphans,
+		Count:   len(orphans),
+	})
+}
+
+// handleCollect handles POST /api/orphans/gc
+func (h *Handlers) handleCollect(w http.ResponseWriter, r *http.Request) {
+	result, err := h.collector.Collect(time.Now())
+	if err != nil {
+		writeCollectorError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// writeCollectorError maps collector errors to HTTP status codes
+func writeCollectorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, leader.ErrNotLeader):
+		writeError(w, http.StatusConflict, "orphans are collected by the leader")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Helper functions
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"error":   http.StatusText(status),
+		"message": message,
+	})
+}
@@ -0,0 +1,21 @@
+package orphans
+
+// OrphanInfo describes metadata whose file is missing
+type OrphanInfo struct {
+	HashID       string `json:"hashId"`
+	Path         string `json:"path"` // Last known path, relative to FILES_PATH
+	PartialHash  string `json:"partialHash,omitempty"`
+	MissingSince int64  `json:"missingSince,omitempty"` // Unix ms
+}
+
+// OrphansListResponse is the response for listing orphans
+type OrphansListResponse struct {
+	Orphans []OrphanInfo `json:"orphans"`
+	Count   int          `json:"count"`
+}
+
+// CollectResult is the outcome of a garbage collection
+type CollectResult struct {
+	Relinked int `json:"relinked"`
+	Purged   int `json:"purged"`
+}
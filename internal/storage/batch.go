@@ -0,0 +1,82 @@
+package storage
+
+// BatchOp is a set of changes to one file in an atomic batch
+// The changes are applied in field order: Delete, Set, Unset, AddToSet,
+// RemoveFromSet. A batch may hold several operations on the same file.
+type BatchOp struct {
+	HashID        string
+	IfRevision    *int64              // Fail the batch unless the file is at this revision
+	Delete        bool                // Delete all metadata of the file first
+	Set           map[string]string   // Properties to set
+	Unset         []string            // Properties to delete
+	AddToSet      map[string][]string // Values to add to set properties (see SplitSet)
+	RemoveFromSet map[string][]string // Values to remove from set properties
+}
+
+// ApplyBatch applies all operations in one fenced transaction that watches
+// every file they touch: either the whole batch is written or nothing is.
+// Returns the revision of every file after the batch, ErrRevisionMismatch if
+// a file is not at its expected revision and ErrConflict if the files keep
+// changing concurrently.
+// Uses Redis: WATCH file:{hashId}... MULTI ... EXEC
+func (c *Client) ApplyBatch(ops []BatchOp) (map[string]int64, error) {
+	return c.WithSource("").ApplyBatch(ops)
+}
+
+// applyBatchOp returns the metadata of a file after op
+func applyBatchOp(metadata map[string]string, op BatchOp) map[string]string {
+	if op.Delete {
+		metadata = make(map[string]string)
+	}
+	for property, value := range op.Set {
+		metadata[property] = value
+	}
+	for _, property := range op.Unset {
+		delete(metadata, property)
+	}
+	for property, values := range op.AddToSet {
+		for _, value := range values {
+			metadata[property] = addSetValue(metadata[property], value)
+		}
+	}
+	for property, values := range op.RemoveFromSet {
+		for _, value := range values {
+			current, ok := metadata[property]
+			if !ok {
+				continue
+			}
+			if updated := removeSetValue(current, value); updated == "" {
+				delete(metadata, property)
+			} else {
+				metadata[property] = updated
+			}
+		}
+	}
+	return metadata
+}
+
+// addSetValue adds value to a set unless already present
+func addSetValue(current, value string) string {
+	elements := SplitSet(current)
+	for _, element := range elements {
+		if element == value {
+			return current
+		}
+	}
+	return JoinSet(append(elements, value))
+}
+
+// removeSetValue removes value from a set
+func removeSetValue(current, value string) string {
+	elements := SplitSet(current)
+	kept := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if element != value {
+			kept = append(kept, element)
+		}
+	}
+	if len(kept) == len(elements) {
+		return current
+	}
+	return JoinSet(kept)
+}
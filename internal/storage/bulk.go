@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// bulkBatchSize is the number of files per pipeline in bulk operations
+const bulkBatchSize = 1000
+
+// GetMetadataFlatMulti retrieves the metadata of many files
+// Files without metadata are left out of the result.
+// Uses pipelined Redis Hash reads: HGETALL file:{hashId}...
+func (c *Client) GetMetadataFlatMulti(hashIDs []string) (map[string]map[string]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	result := make(map[string]map[string]string, len(hashIDs))
+	err := forBatches(hashIDs, func(batch []string) error {
+		reads := make([]*redis.MapStringStringCmd, len(batch))
+		_, err := c.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, hashID := range batch {
+				reads[i] = pipe.HGetAll(ctx, c.buildHashKey(hashID))
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("hgetall failed: %w", err)
+		}
+
+		for i, hashID := range batch {
+			if metadata := reads[i].Val(); len(metadata) > 0 {
+				result[hashID] = metadata
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPropertyMulti retrieves one property of many files
+// Files without the property are left out of the result.
+// Uses pipelined Redis Hash reads: HGET file:{hashId} {property}...
+func (c *Client) GetPropertyMulti(hashIDs []string, property string) (map[string]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	result := make(map[string]string, len(hashIDs))
+	err := c.readFieldsMulti(ctx, hashIDs, []string{property}, func(hashID string, values map[string]string) bool {
+		if value, ok := values[property]; ok {
+			result[hashID] = value
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMetadataFlatMulti stores metadata for many files, with the same
+// semantics as SetMetadataFlat for each. Each batch of bulkBatchSize files
+// is written in one fenced transaction; if a batch fails, the batches
+// before it stay written.
+func (c *Client) SetMetadataFlatMulti(items map[string]map[string]string) error {
+	return c.WithSource("").SetMetadataFlatMulti(items)
+}
+
+// SetMetadataFlatMulti stores metadata for many files, recording each batch
+// as made by the client's source
+func (w *sourcedClient) SetMetadataFlatMulti(items map[string]map[string]string) error {
+	c := w.Client
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	hashIDs := make([]string, 0, len(items))
+	for hashID, metadata := range items {
+		if len(metadata) > 0 {
+			hashIDs = append(hashIDs, hashID)
+		}
+	}
+	sort.Strings(hashIDs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	return forBatches(hashIDs, func(batch []string) error {
+		ops := make([]BatchOp, len(batch))
+		for i, hashID := range batch {
+			ops[i] = BatchOp{HashID: hashID, Set: items[hashID]}
+		}
+		_, err := c.applyOps(ctx, "set", w.source, ops)
+		return err
+	})
+}
+
+// readFieldsMulti reads fields of many files with pipelined HMGETs and calls
+// fn with each file's values (missing fields left out) until it returns false
+// (caller must hold the lock)
+func (c *Client) readFieldsMulti(ctx context.Context, hashIDs []string, fields []string, fn func(hashID string, values map[string]string) bool) error {
+	done := false
+	return forBatches(hashIDs, func(batch []string) error {
+		if done {
+			return nil
+		}
+
+		reads := make([]*redis.SliceCmd, len(batch))
+		_, err := c.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, hashID := range batch {
+				reads[i] = pipe.HMGet(ctx, c.buildHashKey(hashID), fields...)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("hmget failed: %w", err)
+		}
+
+		for i, hashID := range batch {
+			if !fn(hashID, fieldValues(fields, reads[i].Val())) {
+				done = true
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// forBatches calls fn with consecutive slices of at most bulkBatchSize items
+func forBatches(items []string, fn func(batch []string) error) error {
+	for start := 0; start < len(items); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		if err := fn(items[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
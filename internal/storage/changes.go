@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultChangeFeedLength is the default number of events the change feed
+// keeps (see SetChangeFeedLength)
+const DefaultChangeFeedLength = 10000
+
+// ErrChangesTrimmed is returned by Changes when events after the cursor have
+// been trimmed from the feed, so a consumer must resynchronize
+var ErrChangesTrimmed = errors.New("changes trimmed")
+
+// ChangeEvent is an event of the change feed
+// A "clear" event (ClearAllMetadata) has no HashID and means every file
+// changed; so does a "restore" event (RecordRestore), after which consumers
+// must resynchronize.
+type ChangeEvent struct {
+	ID       string // Stream entry ID, the cursor to resume after
+	HashID   string
+	Revision int64    // Revision of the file after the write
+	Op       string   // As in HistoryEntry
+	Keys     []string // Properties the write changed
+	Time     time.Time
+}
+
+// SetChangeFeedLength sets how many events the change feed keeps
+// (approximately, as Redis trims whole nodes), 0 for all. It bounds how long
+// a consumer can be disconnected and still catch up.
+func (c *Client) SetChangeFeedLength(length int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changeFeedLength = length
+}
+
+// buildChangeFeedKey constructs the key of the change feed stream
+func (c *Client) buildChangeFeedKey() string {
+	return c.buildKey("changes")
+}
+
+// changedKeys returns the properties of a write's changes
+func changedKeys(changes []PropertyChange) []string {
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Property
+	}
+	return keys
+}
+
+// queueChange queues the XADD of an event to the change feed
+// (caller must hold the lock)
+func (c *Client) queueChange(ctx context.Context, pipe redis.Pipeliner, event ChangeEvent) {
+	keys, err := json.Marshal(event.Keys)
+	if err != nil {
+		// Unreachable: keys are plain strings
+		log.Printf("[Storage] Warning: failed to encode change of %s: %v", event.HashID, err)
+		return
+	}
+
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.buildChangeFeedKey(),
+		MaxLen: int64(c.changeFeedLength),
+		Approx: true,
+		Values: []interface{}{
+			"hashId", event.HashID,
+			"revision", event.Revision,
+			"op", event.Op,
+			"keys", string(keys),
+		},
+	})
+}
+
+// LatestChangeID returns the ID of the newest change event, "0-0" if the
+// feed is empty. Changes after it are the ones yet to come.
+// Uses Redis Stream: XREVRANGE changes + - COUNT 1
+func (c *Client) LatestChangeID() (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return "", fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := c.reader().XRevRangeN(ctx, c.buildChangeFeedKey(), "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("xrevrange failed: %w", err)
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// Changes returns up to count change events after the event ID since,
+// oldest first. Returns ErrChangesTrimmed if the feed no longer reaches back
+// to since, as events after it may be lost.
+// Uses Redis Stream: XRANGE changes (since + COUNT count
+func (c *Client) Changes(since string, count int) ([]ChangeEvent, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	key := c.buildChangeFeedKey()
+	var oldest, messages *redis.XMessageSliceCmd
+	_, err := c.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		oldest = pipe.XRangeN(ctx, key, "-", "+", 1)
+		messages = pipe.XRangeN(ctx, key, "("+since, "+", int64(count))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("xrange failed: %w", err)
+	}
+
+	// The event at the cursor itself is gone: trimming reached past it
+	if first := oldest.Val(); len(first) > 0 && since != "0-0" && streamIDLess(since, first[0].ID) {
+		return nil, fmt.Errorf("%w: oldest event is %s", ErrChangesTrimmed, first[0].ID)
+	}
+
+	events := make([]ChangeEvent, 0, len(messages.Val()))
+	for _, message := range messages.Val() {
+		event, err := parseChangeEvent(message)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parseChangeEvent decodes a change feed entry
+func parseChangeEvent(message redis.XMessage) (ChangeEvent, error) {
+	value := func(field string) string {
+		s, _ := message.Values[field].(string)
+		return s
+	}
+
+	event := ChangeEvent{
+		ID:     message.ID,
+		HashID: value("hashId"),
+		Op:     value("op"),
+		Time:   streamIDTime(message.ID),
+	}
+	if revision := value("revision"); revision != "" {
+		event.Revision, _ = strconv.ParseInt(revision, 10, 64)
+	}
+	if keys := value("keys"); keys != "" {
+		if err := json.Unmarshal([]byte(keys), &event.Keys); err != nil {
+			return ChangeEvent{}, fmt.Errorf("invalid change event %s: %w", message.ID, err)
+		}
+	}
+	return event, nil
+}
+
+// streamIDTime returns the time a stream entry was added, from its ID
+func streamIDTime(id string) time.Time {
+	ms, _, _ := strings.Cut(id, "-")
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(n).UTC()
+}
+
+// streamIDLess returns true if stream ID a sorts before b
+func streamIDLess(a, b string) bool {
+	parse := func(id string) (uint64, uint64) {
+		msPart, seqPart, _ := strings.Cut(id, "-")
+		ms, _ := strconv.ParseUint(msPart, 10, 64)
+		seq, _ := strconv.ParseUint(seqPart, 10, 64)
+		return ms, seq
+	}
+	aMs, aSeq := parse(a)
+	bMs, bSeq := parse(b)
+	return aMs < bMs || (aMs == bMs && aSeq < bSeq)
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cidIndexVersion is bumped when the CID index layout changes, forcing a
+// rebuild
+const cidIndexVersion = 1
+
+// DefaultCIDFields are the CID-bearing properties indexed by default
+var DefaultCIDFields = []string{"poster", "backdrop", "subtitles", "nfo", "trailer"}
+
+// CIDField is a property holding CIDs and the property holding the path of
+// the file each CID identifies
+type CIDField struct {
+	Property     string
+	PathProperty string
+}
+
+// ParseCIDFields parses CID field specs: "property:pathProperty", or just
+// "property" for a path in property+"Path" (e.g. poster and posterPath)
+func ParseCIDFields(specs []string) []CIDField {
+	fields := make([]CIDField, 0, len(specs))
+	for _, spec := range specs {
+		property, pathProperty, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if property == "" {
+			continue
+		}
+		if !ok || pathProperty == "" {
+			pathProperty = property + "Path"
+		}
+		fields = append(fields, CIDField{Property: property, PathProperty: pathProperty})
+	}
+	return fields
+}
+
+// SetCIDFields sets the properties whose CIDs are indexed for LookupPathByCID
+func (c *Client) SetCIDFields(fields []CIDField) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cidFields = append([]CIDField(nil), fields...)
+}
+
+// buildCIDKey constructs the key of the hash mapping the files that
+// reference a CID to the path of the CID's file
+func (c *Client) buildCIDKey(cid string) string {
+	return c.buildKey("cid:" + cid)
+}
+
+// buildCIDMetaKey constructs the key recording which CID fields the CID
+// index was built for
+func (c *Client) buildCIDMetaKey() string {
+	return c.buildKey("cid:__meta__")
+}
+
+// cidFingerprint identifies the CID index configuration
+// (caller must hold the lock)
+func (c *Client) cidFingerprint() string {
+	specs := make([]string, len(c.cidFields))
+	for i, field := range c.cidFields {
+		specs[i] = field.Property + ":" + field.PathProperty
+	}
+	sort.Strings(specs)
+	return fmt.Sprintf("v%d:%s", cidIndexVersion, strings.Join(specs, ","))
+}
+
+// cidSourceFields returns every property that feeds the CID index
+// (caller must hold the lock)
+func (c *Client) cidSourceFields() []string {
+	fields := make([]string, 0, 2*len(c.cidFields))
+	for _, field := range c.cidFields {
+		fields = append(fields, field.Property, field.PathProperty)
+	}
+	return fields
+}
+
+// cidPaths returns the path of each CID a file's metadata references
+// A set of CIDs pairs with a set of paths element by element, or shares a
+// single path. (caller must hold the lock)
+func (c *Client) cidPaths(metadata map[string]string) map[string]string {
+	paths := make(map[string]string)
+	for _, field := range c.cidFields {
+		cids := SplitSet(metadata[field.Property])
+		filePaths := SplitSet(metadata[field.PathProperty])
+		for i, cid := range cids {
+			path := ""
+			if len(filePaths) == 1 {
+				path = filePaths[0]
+			} else if i < len(filePaths) {
+				path = filePaths[i]
+			}
+			if cid != "" && path != "" {
+				paths[cid] = path
+			}
+		}
+	}
+	return paths
+}
+
+// queueCIDChange queues the CID index updates for a file whose metadata goes
+// from before to after (caller must hold the lock)
+func (c *Client) queueCIDChange(ctx context.Context, pipe redis.Pipeliner, hashID string, before, after map[string]string) {
+	oldPaths := c.cidPaths(before)
+	newPaths := c.cidPaths(after)
+	for cid := range oldPaths {
+		if _, ok := newPaths[cid]; !ok {
+			pipe.HDel(ctx, c.buildCIDKey(cid), hashID)
+		}
+	}
+	for cid, path := range newPaths {
+		if oldPaths[cid] != path {
+			pipe.HSet(ctx, c.buildCIDKey(cid), hashID, path)
+		}
+	}
+}
+
+// cidIndexCurrent returns true if the CID index was built for the current
+// CID fields (caller must hold the lock)
+func (c *Client) cidIndexCurrent(ctx context.Context) (bool, error) {
+	stored, err := c.reader().Get(ctx, c.buildCIDMetaKey()).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get cid index meta failed: %w", err)
+	}
+	return stored == c.cidFingerprint(), nil
+}
+
+// CIDIndexCurrent returns true if the CID index was built for the configured
+// CID fields
+func (c *Client) CIDIndexCurrent() (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return false, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return c.cidIndexCurrent(ctx)
+}
+
+// LookupPathByCID returns the path of the file a CID identifies, "" if no
+// file's metadata references it. Uses the CID index, or scans the CID fields
+// of every file while the index is being built.
+// Uses Redis Hash: HGETALL cid:{cid}
+func (c *Client) LookupPathByCID(cid string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return "", fmt.Errorf("not connected")
+	}
+
+	if cid == "" {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	current, err := c.cidIndexCurrent(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current {
+		references, err := c.reader().HGetAll(ctx, c.buildCIDKey(cid)).Result()
+		if err != nil {
+			return "", fmt.Errorf("hgetall failed: %w", err)
+		}
+		// Files sharing a CID share its content: any path serves it, but
+		// pick the same one every time
+		hashIDs := make([]string, 0, len(references))
+		for hashID := range references {
+			hashIDs = append(hashIDs, hashID)
+		}
+		sort.Strings(hashIDs)
+		if len(hashIDs) == 0 {
+			return "", nil
+		}
+		return references[hashIDs[0]], nil
+	}
+
+	hashIDs, err := c.getAllHashIDsInternal(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var path string
+	err = c.readFieldsMulti(ctx, hashIDs, c.cidSourceFields(), func(hashID string, values map[string]string) bool {
+		path = c.cidPaths(values)[cid]
+		return path == ""
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// RebuildCIDIndex drops the CID index and rebuilds it from the stored
+// metadata. Lookups scan every file until it completes.
+// Returns the number of CIDs indexed.
+func (c *Client) RebuildCIDIndex() (int, error) {
+	c.rebuildMu.Lock()
+	defer c.rebuildMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return 0, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Refuse to rebuild on behalf of a superseded leader
+	if err := c.fenced(ctx, nil, func(tx *redis.Tx) error { return nil }); err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Del(ctx, c.buildCIDMetaKey()).Err(); err != nil {
+		return 0, fmt.Errorf("del cid index meta failed: %w", err)
+	}
+	if err := c.dropKeys(ctx, c.buildKey("cid:*")); err != nil {
+		return 0, err
+	}
+
+	hashIDs, err := c.client.SMembers(ctx, c.buildIndexKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("smembers failed: %w", err)
+	}
+
+	cids := make(map[string]struct{})
+	err = c.rebuildBatches(ctx, hashIDs, c.cidSourceFields(), func(pipe redis.Pipeliner, hashID string, fields map[string]string) {
+		for cid, path := range c.cidPaths(fields) {
+			pipe.HSet(ctx, c.buildCIDKey(cid), hashID, path)
+			cids[cid] = struct{}{}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Set(ctx, c.buildCIDMetaKey(), c.cidFingerprint(), 0).Err(); err != nil {
+		return 0, fmt.Errorf("set cid index meta failed: %w", err)
+	}
+
+	log.Printf("[Storage] Rebuilt CID index with %d CIDs from %d files", len(cids), len(hashIDs))
+	return len(cids), nil
+}
@@ -2,45 +2,115 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// EpochKey is the Redis key holding the current leadership epoch
+const EpochKey = "meta-core:epoch"
+
+// maxTxRetries bounds optimistic transaction retries on concurrent writes
+const maxTxRetries = 5
+
+// ErrStaleEpoch is returned when a write carries an epoch older than the one
+// recorded in Redis, i.e. it comes from a leader that has been superseded
+var ErrStaleEpoch = errors.New("stale leadership epoch")
+
+// ErrConflict is returned when an optimistic transaction keeps losing to
+// concurrent writes to the same keys
+var ErrConflict = errors.New("transaction aborted due to concurrent writes")
+
 // Client wraps Redis operations for metadata storage
+// Writes always go to the leader; reads go to the local replica when one is
+// connected (see ConnectReplica) and to the leader otherwise
 type Client struct {
 	client    *redis.Client
+	replica   *redis.Client
 	prefix    string
 	connected bool
+	epoch     int64
+	username  string
+	password  string
+
+	indexedFields       []string   // Properties with a value index (see index.go)
+	historyLength       int        // Entries kept per file history stream (see history.go)
+	globalHistoryLength int        // Entries kept in the global history stream
+	changeFeedLength    int        // Events kept in the change feed (see changes.go)
+	cidFields           []CIDField // Properties whose CIDs are indexed (see cid.go)
+
+	setEncodingDone atomic.Bool // Set once legacy set values are known migrated (see sets.go)
+
 	mu        sync.RWMutex
+	rebuildMu sync.Mutex // Serializes index rebuilds, which run under the read lock
 }
 
 // NewClient creates a new storage client
 func NewClient(prefix string) *Client {
 	return &Client{
-		prefix: prefix,
+		prefix:              prefix,
+		historyLength:       DefaultHistoryLength,
+		globalHistoryLength: DefaultGlobalHistoryLength,
+		changeFeedLength:    DefaultChangeFeedLength,
+		cidFields:           ParseCIDFields(DefaultCIDFields),
 	}
 }
 
+// SetCredentials sets the credentials used for connections whose URL does
+// not carry them (leader URLs only ever carry the ACL username)
+func (c *Client) SetCredentials(username, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username = username
+	c.password = password
+}
+
+// options builds client options for a Redis URL (redis://[user@]host:port)
+// (caller must hold the lock)
+func (c *Client) options(url string) (*redis.Options, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	if opts.Username == "" {
+		opts.Username = c.username
+	}
+	if opts.Password == "" {
+		opts.Password = c.password
+	}
+
+	opts.DialTimeout = 5 * time.Second
+	opts.ReadTimeout = 30 * time.Second
+	opts.WriteTimeout = 30 * time.Second
+	opts.PoolSize = 10
+	return opts, nil
+}
+
 // Connect connects to Redis at the given URL
 func (c *Client) Connect(url string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Parse Redis URL (redis://host:port)
-	addr := strings.TrimPrefix(url, "redis://")
+	opts, err := c.options(url)
+	if err != nil {
+		return err
+	}
+	addr := opts.Addr
 
-	c.client = redis.NewClient(&redis.Options{
-		Addr:         addr,
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		PoolSize:     10,
-	})
+	// Drop any previous connection (e.g. to a leader that has gone away)
+	if c.client != nil {
+		c.client.Close()
+		c.connected = false
+	}
+
+	c.client = redis.NewClient(opts)
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -55,11 +125,66 @@ func (c *Client) Connect(url string) error {
 	return nil
 }
 
+// ConnectReplica routes reads to a local read replica at the given URL
+// An empty URL disconnects the replica and sends reads back to the leader
+func (c *Client) ConnectReplica(url string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replica != nil {
+		c.replica.Close()
+		c.replica = nil
+	}
+
+	if url == "" {
+		return nil
+	}
+
+	opts, err := c.options(url)
+	if err != nil {
+		return err
+	}
+	replica := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := replica.Ping(ctx).Err(); err != nil {
+		replica.Close()
+		return fmt.Errorf("failed to connect to replica: %w", err)
+	}
+
+	c.replica = replica
+	log.Printf("[Storage] Reading from replica at %s", opts.Addr)
+	return nil
+}
+
+// HasReplica returns true if reads are served by a local replica
+func (c *Client) HasReplica() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.replica != nil
+}
+
+// reader returns the client to use for read operations
+// (caller must hold the lock)
+func (c *Client) reader() *redis.Client {
+	if c.replica != nil {
+		return c.replica
+	}
+	return c.client
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.replica != nil {
+		c.replica.Close()
+		c.replica = nil
+	}
+
 	if c.client != nil {
 		c.connected = false
 		return c.client.Close()
@@ -67,6 +192,21 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// SetEpoch sets the leadership epoch carried by all writes
+// An epoch of 0 disables fencing
+func (c *Client) SetEpoch(epoch int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch = epoch
+}
+
+// Epoch returns the leadership epoch carried by writes
+func (c *Client) Epoch() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.epoch
+}
+
 // IsConnected returns true if connected to Redis
 func (c *Client) IsConnected() bool {
 	c.mu.RLock()
@@ -107,6 +247,36 @@ func (c *Client) buildIndexKey() string {
 	return c.buildKey("file:__index__")
 }
 
+// fenced runs fn inside an optimistic transaction that watches the epoch key
+// and the given keys. The write is rejected with ErrStaleEpoch if Redis has
+// seen a newer leadership epoch than the one carried by this client.
+// (caller must hold the lock)
+func (c *Client) fenced(ctx context.Context, keys []string, fn func(tx *redis.Tx) error) error {
+	watchKeys := append([]string{EpochKey}, keys...)
+
+	for attempt := 0; attempt < maxTxRetries; attempt++ {
+		err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+			if c.epoch > 0 {
+				stored, err := tx.Get(ctx, EpochKey).Int64()
+				if err != nil && err != redis.Nil {
+					return fmt.Errorf("get epoch failed: %w", err)
+				}
+				if stored > c.epoch {
+					return fmt.Errorf("%w: write carries epoch %d, current is %d", ErrStaleEpoch, c.epoch, stored)
+				}
+			}
+			return fn(tx)
+		}, watchKeys...)
+
+		// fn may wrap the error of its transaction
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w (%d retries)", ErrConflict, maxTxRetries)
+}
+
 // GetMetadataFlat retrieves all metadata for a file as a flat map
 // Uses Redis Hash: HGETALL file:{hashId}
 func (c *Client) GetMetadataFlat(hashID string) (map[string]string, error) {
@@ -121,7 +291,7 @@ func (c *Client) GetMetadataFlat(hashID string) (map[string]string, error) {
 	defer cancel()
 
 	hashKey := c.buildHashKey(hashID)
-	result, err := c.client.HGetAll(ctx, hashKey).Result()
+	result, err := c.reader().HGetAll(ctx, hashKey).Result()
 	if err != nil {
 		return nil, fmt.Errorf("hgetall failed: %w", err)
 	}
@@ -136,33 +306,7 @@ func (c *Client) GetMetadataFlat(hashID string) (map[string]string, error) {
 // SetMetadataFlat stores metadata for a file using Redis Hash
 // Uses Redis Hash: HMSET file:{hashId} prop1 val1 prop2 val2...
 func (c *Client) SetMetadataFlat(hashID string, metadata map[string]string) error {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	if len(metadata) == 0 {
-		return nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Use HMSET to set all fields at once
-	if err := c.client.HMSet(ctx, hashKey, metadata).Err(); err != nil {
-		return fmt.Errorf("hmset failed: %w", err)
-	}
-
-	// Add to index set
-	if err := c.client.SAdd(ctx, c.buildIndexKey(), hashID).Err(); err != nil {
-		return fmt.Errorf("sadd index failed: %w", err)
-	}
-
-	return nil
+	return c.WithSource("").SetMetadataFlat(hashID, metadata)
 }
 
 // GetAllHashIDs returns all unique file hash IDs stored
@@ -179,7 +323,7 @@ func (c *Client) GetAllHashIDs() ([]string, error) {
 	defer cancel()
 
 	indexKey := c.buildIndexKey()
-	result, err := c.client.SMembers(ctx, indexKey).Result()
+	result, err := c.reader().SMembers(ctx, indexKey).Result()
 	if err != nil {
 		return nil, fmt.Errorf("smembers failed: %w", err)
 	}
@@ -201,7 +345,7 @@ func (c *Client) GetProperty(hashID, property string) (string, error) {
 	defer cancel()
 
 	hashKey := c.buildHashKey(hashID)
-	result, err := c.client.HGet(ctx, hashKey, property).Result()
+	result, err := c.reader().HGet(ctx, hashKey, property).Result()
 	if err == redis.Nil {
 		return "", nil
 	}
@@ -211,63 +355,13 @@ func (c *Client) GetProperty(hashID, property string) (string, error) {
 // SetProperty sets a single property value
 // Uses Redis Hash: HSET file:{hashId} {property} {value}
 func (c *Client) SetProperty(hashID, property, value string) error {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Use HSET to set the field
-	if err := c.client.HSet(ctx, hashKey, property, value).Err(); err != nil {
-		return fmt.Errorf("hset failed: %w", err)
-	}
-
-	// Add to index set
-	if err := c.client.SAdd(ctx, c.buildIndexKey(), hashID).Err(); err != nil {
-		return fmt.Errorf("sadd index failed: %w", err)
-	}
-
-	return nil
+	return c.WithSource("").SetProperty(hashID, property, value)
 }
 
 // DeleteMetadata deletes all metadata for a file
 // Uses Redis Hash: DEL file:{hashId}
 func (c *Client) DeleteMetadata(hashID string) (int64, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return 0, fmt.Errorf("not connected")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Get field count before deletion
-	fieldCount, err := c.client.HLen(ctx, hashKey).Result()
-	if err != nil {
-		return 0, fmt.Errorf("hlen failed: %w", err)
-	}
-
-	// Delete the hash
-	if err := c.client.Del(ctx, hashKey).Err(); err != nil {
-		return 0, fmt.Errorf("del failed: %w", err)
-	}
-
-	// Remove from index set
-	if err := c.client.SRem(ctx, c.buildIndexKey(), hashID).Err(); err != nil {
-		return fieldCount, fmt.Errorf("srem index failed: %w", err)
-	}
-
-	return fieldCount, nil
+	return c.WithSource("").DeleteMetadata(hashID)
 }
 
 // CountFiles returns the number of unique files stored
@@ -279,60 +373,11 @@ func (c *Client) CountFiles() (int, error) {
 	return len(hashIDs), nil
 }
 
-// LookupPathByCID searches all file metadata for a matching CID
-// Returns the file path if found in poster/posterPath or backdrop/backdropPath
-func (c *Client) LookupPathByCID(cid string) (string, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return "", fmt.Errorf("not connected")
-	}
-
-	if cid == "" {
-		return "", nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	// Get all hash IDs first
-	hashIDs, err := c.getAllHashIDsInternal(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	// For each hash, check poster and backdrop CIDs using Hash operations
-	for _, hashID := range hashIDs {
-		hashKey := c.buildHashKey(hashID)
-
-		// Check poster
-		posterCID, err := c.client.HGet(ctx, hashKey, "poster").Result()
-		if err == nil && posterCID == cid {
-			posterPath, err := c.client.HGet(ctx, hashKey, "posterPath").Result()
-			if err == nil && posterPath != "" {
-				return posterPath, nil
-			}
-		}
-
-		// Check backdrop
-		backdropCID, err := c.client.HGet(ctx, hashKey, "backdrop").Result()
-		if err == nil && backdropCID == cid {
-			backdropPath, err := c.client.HGet(ctx, hashKey, "backdropPath").Result()
-			if err == nil && backdropPath != "" {
-				return backdropPath, nil
-			}
-		}
-	}
-
-	return "", nil
-}
-
 // getAllHashIDsInternal is an internal version that doesn't acquire locks
 // (caller must hold the lock)
 func (c *Client) getAllHashIDsInternal(ctx context.Context) ([]string, error) {
 	indexKey := c.buildIndexKey()
-	result, err := c.client.SMembers(ctx, indexKey).Result()
+	result, err := c.reader().SMembers(ctx, indexKey).Result()
 	if err != nil {
 		return nil, fmt.Errorf("smembers failed: %w", err)
 	}
@@ -343,152 +388,25 @@ func (c *Client) getAllHashIDsInternal(ctx context.Context) ([]string, error) {
 // New keys are added, existing keys are updated, missing keys are NOT deleted
 // Uses Redis Hash: HMSET file:{hashId}
 func (c *Client) MergeMetadataFlat(hashID string, metadata map[string]string) (int, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return 0, fmt.Errorf("not connected")
-	}
-
-	if len(metadata) == 0 {
-		return 0, nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Use HMSET to merge fields
-	if err := c.client.HMSet(ctx, hashKey, metadata).Err(); err != nil {
-		return 0, fmt.Errorf("hmset failed: %w", err)
-	}
-
-	// Add to index set
-	if err := c.client.SAdd(ctx, c.buildIndexKey(), hashID).Err(); err != nil {
-		return len(metadata), fmt.Errorf("sadd index failed: %w", err)
-	}
-
-	return len(metadata), nil
+	return c.WithSource("").MergeMetadataFlat(hashID, metadata)
 }
 
 // DeleteProperty deletes a single property
 // Uses Redis Hash: HDEL file:{hashId} {property}
 func (c *Client) DeleteProperty(hashID, property string) error {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	if c.client == nil {
-		return fmt.Errorf("not connected")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-	return c.client.HDel(ctx, hashKey, property).Err()
+	return c.WithSource("").DeleteProperty(hashID, property)
 }
 
 // AddToSet adds a value to a set-type field (stored as pipe-delimited string in Hash field)
 // Returns true if value was added, false if it already existed
 func (c *Client) AddToSet(hashID, property, value string) (bool, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.client == nil {
-		return false, fmt.Errorf("not connected")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Get current value
-	current, err := c.client.HGet(ctx, hashKey, property).Result()
-	if err != nil && err != redis.Nil {
-		return false, err
-	}
-
-	// Parse existing values (pipe-delimited)
-	var values []string
-	if current != "" {
-		values = strings.Split(current, "|")
-	}
-
-	// Check if value already exists
-	for _, v := range values {
-		if v == value {
-			return false, nil // Already exists
-		}
-	}
-
-	// Add new value
-	values = append(values, value)
-	newValue := strings.Join(values, "|")
-
-	// Save back using HSET
-	if err := c.client.HSet(ctx, hashKey, property, newValue).Err(); err != nil {
-		return false, err
-	}
-
-	// Add to index set
-	if err := c.client.SAdd(ctx, c.buildIndexKey(), hashID).Err(); err != nil {
-		return true, fmt.Errorf("sadd index failed: %w", err)
-	}
-
-	return true, nil
+	return c.WithSource("").AddToSet(hashID, property, value)
 }
 
 // RemoveFromSet removes a value from a set-type field (stored in Hash)
 // Returns true if value was removed, false if it didn't exist
 func (c *Client) RemoveFromSet(hashID, property, value string) (bool, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.client == nil {
-		return false, fmt.Errorf("not connected")
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	hashKey := c.buildHashKey(hashID)
-
-	// Get current value
-	current, err := c.client.HGet(ctx, hashKey, property).Result()
-	if err == redis.Nil {
-		return false, nil // Field doesn't exist
-	}
-	if err != nil {
-		return false, err
-	}
-
-	// Parse existing values
-	values := strings.Split(current, "|")
-
-	// Find and remove value
-	found := false
-	newValues := make([]string, 0, len(values))
-	for _, v := range values {
-		if v == value {
-			found = true
-		} else {
-			newValues = append(newValues, v)
-		}
-	}
-
-	if !found {
-		return false, nil
-	}
-
-	// Save back (or delete field if empty)
-	if len(newValues) == 0 {
-		return true, c.client.HDel(ctx, hashKey, property).Err()
-	}
-
-	newValue := strings.Join(newValues, "|")
-	return true, c.client.HSet(ctx, hashKey, property, newValue).Err()
+	return c.WithSource("").RemoveFromSet(hashID, property, value)
 }
 
 // GetMemoryInfo returns Redis memory usage information
@@ -521,6 +439,15 @@ func (c *Client) GetMemoryInfo() (string, error) {
 // ClearAllMetadata deletes all file metadata and index
 // Returns the number of files deleted
 func (c *Client) ClearAllMetadata() (int64, error) {
+	return c.WithSource("").ClearAllMetadata()
+}
+
+// ClearAllMetadata deletes all file metadata and index, recording the clear
+// in the global history. It stops at the first batch that fails, returning
+// the number of files deleted so far and the error; the indexes are only
+// dropped once every file is deleted.
+func (w *sourcedClient) ClearAllMetadata() (int64, error) {
+	c := w.Client
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -531,6 +458,11 @@ func (c *Client) ClearAllMetadata() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
 
+	// Refuse to clear on behalf of a superseded leader
+	if err := c.fenced(ctx, nil, func(tx *redis.Tx) error { return nil }); err != nil {
+		return 0, err
+	}
+
 	// Get all hash IDs from index
 	indexKey := c.buildIndexKey()
 	hashIDs, err := c.client.SMembers(ctx, indexKey).Result()
@@ -540,20 +472,50 @@ func (c *Client) ClearAllMetadata() (int64, error) {
 
 	var deletedCount int64
 
-	// Delete each file's hash
-	for _, hashID := range hashIDs {
-		hashKey := c.buildHashKey(hashID)
-		if err := c.client.Del(ctx, hashKey).Err(); err != nil {
-			log.Printf("[Storage] Warning: failed to delete %s: %v", hashKey, err)
-			continue
+	// Delete the files in batches like single-file deletes, so each moves
+	// to a new revision with its history recording what it held and can be
+	// reverted
+	err = forBatches(hashIDs, func(batch []string) error {
+		ops := make([]BatchOp, len(batch))
+		for i, hashID := range batch {
+			ops[i] = BatchOp{HashID: hashID, Delete: true}
+		}
+		if _, err := c.applyOps(ctx, "clear", w.source, ops); err != nil {
+			return err
 		}
-		deletedCount++
+		deletedCount += int64(len(batch))
+		return nil
+	})
+	if err != nil {
+		// The indexes are left alone: they still reach the files not deleted
+		log.Printf("[Storage] Clear stopped after %d of %d files: %v", deletedCount, len(hashIDs), err)
+		return deletedCount, fmt.Errorf("clear stopped after %d of %d files: %w", deletedCount, len(hashIDs), err)
 	}
 
-	// Delete the index set
+	// Delete the index set and the secondary, CID and path indexes, which are
+	// now empty
 	if err := c.client.Del(ctx, indexKey).Err(); err != nil {
 		log.Printf("[Storage] Warning: failed to delete index: %v", err)
 	}
+	if err := c.dropIndexes(ctx); err != nil {
+		log.Printf("[Storage] Warning: failed to delete secondary indexes: %v", err)
+	} else if err := c.client.Set(ctx, c.buildIndexMetaKey(), c.indexFingerprint(), 0).Err(); err != nil {
+		log.Printf("[Storage] Warning: failed to mark indexes current: %v", err)
+	}
+	if err := c.dropKeys(ctx, c.buildKey("cid:*")); err != nil {
+		log.Printf("[Storage] Warning: failed to delete CID index: %v", err)
+	} else if err := c.client.Set(ctx, c.buildCIDMetaKey(), c.cidFingerprint(), 0).Err(); err != nil {
+		log.Printf("[Storage] Warning: failed to mark CID index current: %v", err)
+	}
+	if err := c.client.Del(ctx, c.buildOrphansKey()).Err(); err != nil {
+		log.Printf("[Storage] Warning: failed to delete orphan set: %v", err)
+	} else if err := c.dropKeys(ctx, c.buildKey("path:*")); err != nil {
+		log.Printf("[Storage] Warning: failed to delete path index: %v", err)
+	} else if err := c.client.Set(ctx, c.buildPathMetaKey(), pathIndexVersion, 0).Err(); err != nil {
+		log.Printf("[Storage] Warning: failed to mark path index current: %v", err)
+	}
+
+	c.recordClear(ctx, w.source, deletedCount)
 
 	log.Printf("[Storage] Cleared %d file metadata entries", deletedCount)
 	return deletedCount, nil
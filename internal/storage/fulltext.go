@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/metazla/meta-core/internal/fulltext"
+	"github.com/redis/go-redis/v9"
+)
+
+// fuzzyPenalty scales the score of a term matched with typos, per edit
+const fuzzyPenalty = 0.5
+
+// FullTextHit is a file matching a full-text query
+type FullTextHit struct {
+	HashID string
+	Score  float64
+	Terms  []string // Index terms that matched, for highlighting
+}
+
+// termMatch is an index term a query term resolved to
+type termMatch struct {
+	queryTerm string
+	term      string
+	factor    float64 // 1 for exact matches, lower for fuzzy ones
+}
+
+// FullTextSearch scores the files matching a query, best first
+// Query words are folded and stemmed like indexed text. Words not in the
+// index match terms within a few typos (see fulltext.MaxEdits) at a reduced
+// score. A file's score is the sum of tf-idf weights of its matched terms,
+// scaled by the fraction of query words it matches.
+// Uses Redis Hashes: HGETALL idx:fts:{term}
+func (c *Client) FullTextSearch(query string) ([]FullTextHit, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	current, err := c.indexesCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !current {
+		return nil, fmt.Errorf("%w: indexes are being rebuilt", ErrNotIndexed)
+	}
+
+	queryTerms := fulltext.Terms(query)
+	if len(queryTerms) == 0 {
+		return []FullTextHit{}, nil
+	}
+
+	matches, err := c.resolveTerms(ctx, queryTerms)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return []FullTextHit{}, nil
+	}
+
+	reader := c.reader()
+	fileCount, err := reader.SCard(ctx, c.buildIndexKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("scard failed: %w", err)
+	}
+
+	postings := make([]*redis.MapStringStringCmd, len(matches))
+	_, err = reader.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, match := range matches {
+			postings[i] = pipe.HGetAll(ctx, c.buildFullTextKey(match.term))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hgetall failed: %w", err)
+	}
+
+	type scored struct {
+		score   float64
+		terms   []string
+		matched map[string]bool // Query terms matched
+	}
+	files := make(map[string]*scored)
+
+	for i, match := range matches {
+		posting := postings[i].Val()
+		if len(posting) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(fileCount)/float64(len(posting)))
+
+		for hashID, value := range posting {
+			weight, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			file, ok := files[hashID]
+			if !ok {
+				file = &scored{matched: make(map[string]bool)}
+				files[hashID] = file
+			}
+			file.score += weight * idf * match.factor
+			file.terms = append(file.terms, match.term)
+			file.matched[match.queryTerm] = true
+		}
+	}
+
+	hits := make([]FullTextHit, 0, len(files))
+	for hashID, file := range files {
+		coverage := float64(len(file.matched)) / float64(len(queryTerms))
+		hits = append(hits, FullTextHit{
+			HashID: hashID,
+			Score:  file.score * coverage,
+			Terms:  file.terms,
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].HashID < hits[j].HashID
+	})
+	return hits, nil
+}
+
+// resolveTerms maps query terms to index terms: the term itself if indexed,
+// otherwise the indexed terms within its typo tolerance, read from the
+// vocabularies of the lengths that tolerance can reach
+// (caller must hold the lock)
+func (c *Client) resolveTerms(ctx context.Context, queryTerms []string) ([]termMatch, error) {
+	reader := c.reader()
+
+	exists := make([]*redis.IntCmd, len(queryTerms))
+	_, err := reader.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, term := range queryTerms {
+			exists[i] = pipe.Exists(ctx, c.buildFullTextKey(term))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("exists failed: %w", err)
+	}
+
+	var matches []termMatch
+	vocabulary := make(map[int][]string) // Terms by length, loaded as needed
+	for i, queryTerm := range queryTerms {
+		if exists[i].Val() > 0 {
+			matches = append(matches, termMatch{queryTerm: queryTerm, term: queryTerm, factor: 1})
+			continue
+		}
+
+		maxEdits := fulltext.MaxEdits(queryTerm)
+		if maxEdits == 0 {
+			continue
+		}
+		length := utf8.RuneCountInString(queryTerm)
+		if err := c.loadVocabulary(ctx, vocabulary, length-maxEdits, length+maxEdits); err != nil {
+			return nil, err
+		}
+		for n := length - maxEdits; n <= length+maxEdits; n++ {
+			for _, term := range vocabulary[n] {
+				if distance := fulltext.Distance(queryTerm, term, maxEdits); distance <= maxEdits {
+					matches = append(matches, termMatch{
+						queryTerm: queryTerm,
+						term:      term,
+						factor:    math.Pow(fuzzyPenalty, float64(distance)),
+					})
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+// loadVocabulary reads the full-text terms of the lengths from shortest to
+// longest that vocabulary does not hold yet (caller must hold the lock)
+func (c *Client) loadVocabulary(ctx context.Context, vocabulary map[int][]string, shortest, longest int) error {
+	reads := make(map[int]*redis.StringSliceCmd)
+	_, err := c.reader().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for n := shortest; n <= longest; n++ {
+			if _, ok := vocabulary[n]; !ok && n > 0 {
+				reads[n] = pipe.ZRangeByLex(ctx, c.buildFullTextVocabKey(n), &redis.ZRangeBy{Min: "-", Max: "+"})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("zrangebylex failed: %w", err)
+	}
+	for n, read := range reads {
+		vocabulary[n] = read.Val()
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Default history lengths (see SetHistoryLimits)
+const (
+	DefaultHistoryLength       = 100
+	DefaultGlobalHistoryLength = 10000
+)
+
+// ErrHistoryTrimmed is returned by RevertToRevision when the history no
+// longer holds every change since the target revision
+var ErrHistoryTrimmed = errors.New("history trimmed")
+
+// HistoryEntry is one recorded write
+// Entries of the per-file history describe one file; the global history also
+// holds "clear" entries (no HashID) for ClearAllMetadata and "restore"
+// entries for RecordRestore.
+type HistoryEntry struct {
+	ID       string // Stream entry ID, the cursor for paging
+	HashID   string
+	Revision int64  // Revision of the file after the write
+	Op       string // set, merge, delete, unset, add, remove, batch, revert, migrate, clear or restore
+	Source   string // Service that made the write, empty if unknown
+	Time     time.Time
+	Changes  []PropertyChange
+	Files    int64 // Number of files deleted by a clear
+}
+
+// PropertyChange is the change of one property in a write
+// Old is nil when the property was added, New when it was deleted.
+type PropertyChange struct {
+	Property string  `json:"property"`
+	Old      *string `json:"old,omitempty"`
+	New      *string `json:"new,omitempty"`
+}
+
+// SetHistoryLimits sets how many entries the per-file and the global history
+// streams keep (approximately, as Redis trims whole nodes); 0 disables one
+func (c *Client) SetHistoryLimits(perFile, global int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.historyLength = perFile
+	c.globalHistoryLength = global
+}
+
+// buildHistoryKey constructs the key of a file's history stream
+// Like the revision counter, it outlives the file's metadata.
+func (c *Client) buildHistoryKey(hashID string) string {
+	return c.buildKey("history:" + hashID)
+}
+
+// buildGlobalHistoryKey constructs the key of the history stream of all files
+func (c *Client) buildGlobalHistoryKey() string {
+	return c.buildKey("history")
+}
+
+// diffProperties returns the changes from before to after, sorted by property
+func diffProperties(before, after map[string]string) []PropertyChange {
+	var changes []PropertyChange
+	for property, old := range before {
+		old := old
+		if value, ok := after[property]; !ok {
+			changes = append(changes, PropertyChange{Property: property, Old: &old})
+		} else if value != old {
+			value := value
+			changes = append(changes, PropertyChange{Property: property, Old: &old, New: &value})
+		}
+	}
+	for property, value := range after {
+		value := value
+		if _, ok := before[property]; !ok {
+			changes = append(changes, PropertyChange{Property: property, New: &value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Property < changes[j].Property })
+	return changes
+}
+
+// queueHistory queues the XADDs recording a write in the file's history and,
+// if global, the global history (caller must hold the lock)
+func (c *Client) queueHistory(ctx context.Context, pipe redis.Pipeliner, entry HistoryEntry, global bool) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		// Unreachable: changes are plain strings
+		log.Printf("[Storage] Warning: failed to encode history of %s: %v", entry.HashID, err)
+		return
+	}
+	values := []interface{}{
+		"hashId", entry.HashID,
+		"revision", entry.Revision,
+		"op", entry.Op,
+		"source", entry.Source,
+		"changes", string(changes),
+	}
+
+	if c.historyLength > 0 {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: c.buildHistoryKey(entry.HashID),
+			MaxLen: int64(c.historyLength),
+			Approx: true,
+			Values: values,
+		})
+	}
+	if global && c.globalHistoryLength > 0 {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: c.buildGlobalHistoryKey(),
+			MaxLen: int64(c.globalHistoryLength),
+			Approx: true,
+			Values: values,
+		})
+	}
+}
+
+// recordClear records a ClearAllMetadata in the global history and the
+// change feed. A failure is only logged, as the metadata is already gone.
+// (caller must hold the lock)
+func (c *Client) recordClear(ctx context.Context, source string, files int64) {
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if c.globalHistoryLength > 0 {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: c.buildGlobalHistoryKey(),
+				MaxLen: int64(c.globalHistoryLength),
+				Approx: true,
+				Values: []interface{}{"op", "clear", "source", source, "files", files},
+			})
+		}
+		c.queueChange(ctx, pipe, ChangeEvent{Op: "clear"})
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Storage] Warning: failed to record clear in history: %v", err)
+	}
+}
+
+// RecordRestore records a restore of Redis from a backup in the global
+// history and the change feed. The restore rolled both back to the backup;
+// the "restore" event tells feed consumers, whose cursors may be past
+// anything the feed now holds, that every file may have changed.
+func (c *Client) RecordRestore() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if c.globalHistoryLength > 0 {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: c.buildGlobalHistoryKey(),
+				MaxLen: int64(c.globalHistoryLength),
+				Approx: true,
+				Values: []interface{}{"op", "restore"},
+			})
+		}
+		c.queueChange(ctx, pipe, ChangeEvent{Op: "restore"})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("record restore failed: %w", err)
+	}
+	return nil
+}
+
+// History returns up to count history entries of a file, newest first,
+// starting after the entry ID before ("" for the newest). An empty hashID
+// reads the global history. Also returns the cursor of the next page, empty
+// on the last page.
+// Uses Redis Stream: XREVRANGE history:{hashId} (before - COUNT count+1
+func (c *Client) History(hashID, before string, count int) ([]HistoryEntry, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, "", fmt.Errorf("not connected")
+	}
+
+	if count <= 0 {
+		return []HistoryEntry{}, "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	key := c.buildGlobalHistoryKey()
+	if hashID != "" {
+		key = c.buildHistoryKey(hashID)
+	}
+	end := "+"
+	if before != "" {
+		end = "(" + before
+	}
+
+	messages, err := c.reader().XRevRangeN(ctx, key, end, "-", int64(count)+1).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("xrevrange failed: %w", err)
+	}
+
+	next := ""
+	if len(messages) > count {
+		messages = messages[:count]
+		next = messages[count-1].ID
+	}
+
+	entries := make([]HistoryEntry, 0, len(messages))
+	for _, message := range messages {
+		entry, err := parseHistoryEntry(message)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, nil
+}
+
+// parseHistoryEntry decodes a history stream entry
+func parseHistoryEntry(message redis.XMessage) (HistoryEntry, error) {
+	value := func(field string) string {
+		s, _ := message.Values[field].(string)
+		return s
+	}
+
+	entry := HistoryEntry{
+		ID:     message.ID,
+		HashID: value("hashId"),
+		Op:     value("op"),
+		Source: value("source"),
+		Time:   streamIDTime(message.ID),
+	}
+	if revision := value("revision"); revision != "" {
+		entry.Revision, _ = strconv.ParseInt(revision, 10, 64)
+	}
+	if files := value("files"); files != "" {
+		entry.Files, _ = strconv.ParseInt(files, 10, 64)
+	}
+	if changes := value("changes"); changes != "" {
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return HistoryEntry{}, fmt.Errorf("invalid history entry %s: %w", message.ID, err)
+		}
+	}
+	return entry, nil
+}
+
+// RevertToRevision restores the metadata a file had at a revision by undoing
+// the recorded changes since, as a new write. The history must hold every
+// write since the revision, otherwise ErrHistoryTrimmed is returned. Fails
+// with ErrRevisionMismatch if the file is changed while reverting or the
+// revision is newer than the file's.
+// Returns the revision after the revert.
+func (c *Client) RevertToRevision(hashID string, revision int64) (int64, error) {
+	return c.WithSource("").RevertToRevision(hashID, revision)
+}
+
+// RevertToRevision restores the metadata a file had at a revision, recording
+// the revert as made by the client's source
+func (w *sourcedClient) RevertToRevision(hashID string, revision int64) (int64, error) {
+	current, currentRevision, err := w.GetMetadataRevision(hashID)
+	if err != nil {
+		return 0, err
+	}
+	if revision > currentRevision || revision < 0 {
+		return 0, fmt.Errorf("%w: %s is at revision %d, cannot revert to %d",
+			ErrRevisionMismatch, hashID, currentRevision, revision)
+	}
+	if revision == currentRevision {
+		return currentRevision, nil
+	}
+
+	entries, _, err := w.History(hashID, "", int(currentRevision-revision))
+	if err != nil {
+		return 0, err
+	}
+
+	// Undo the writes newest first; each must be the next older revision
+	target := make(map[string]string, len(current))
+	for property, value := range current {
+		target[property] = value
+	}
+	expected := currentRevision
+	for _, entry := range entries {
+		if entry.Revision != expected {
+			break
+		}
+		for i := len(entry.Changes) - 1; i >= 0; i-- {
+			change := entry.Changes[i]
+			if change.Old == nil {
+				delete(target, change.Property)
+			} else {
+				target[change.Property] = *change.Old
+			}
+		}
+		expected--
+	}
+	if expected != revision {
+		return 0, fmt.Errorf("%w: no record of revision %d of %s", ErrHistoryTrimmed, expected, hashID)
+	}
+
+	result, err := w.write("revert", w.source, BatchOp{
+		HashID:     hashID,
+		IfRevision: &currentRevision,
+		Delete:     true,
+		Set:        target,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.revisions[hashID], nil
+}
@@ -0,0 +1,702 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/metazla/meta-core/internal/fulltext"
+	"github.com/redis/go-redis/v9"
+)
+
+// indexVersion is bumped when the index layout or the full-text analyzer
+// changes, forcing a rebuild
+const indexVersion = 7
+
+// TextFields are the properties tokenized into the text index
+var TextFields = []string{"title", "originaltitle", "showtitle", "fileName", "filePath"}
+
+// ErrNotIndexed is returned by index lookups when the property has no index
+// or the indexes have not been built for the current configuration
+var ErrNotIndexed = errors.New("not indexed")
+
+// SetIndexedFields sets the properties that get a value index
+// Text fields (TextFields) are always indexed.
+func (c *Client) SetIndexedFields(fields []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexedFields = append([]string(nil), fields...)
+}
+
+// buildValueIndexKey constructs the key of the set of files whose property
+// has the given (normalized) value
+func (c *Client) buildValueIndexKey(property, value string) string {
+	return c.buildKey(fmt.Sprintf("idx:value:%s:%s", property, value))
+}
+
+// buildTokenIndexKey constructs the key of the set of files whose text fields
+// contain the given token
+func (c *Client) buildTokenIndexKey(token string) string {
+	return c.buildKey("idx:token:" + token)
+}
+
+// buildValueVocabKey constructs the key of the sorted set of the normalized
+// values of an indexed property, all with score 0 so that values sharing a
+// prefix are adjacent (ZRANGEBYLEX)
+func (c *Client) buildValueVocabKey(property string) string {
+	return c.buildKey("idx:values:" + property)
+}
+
+// buildTokenVocabKey constructs the key of the sorted set of all tokens of
+// the text fields, all with score 0 so that tokens sharing a prefix are
+// adjacent (ZRANGEBYLEX)
+func (c *Client) buildTokenVocabKey() string {
+	return c.buildKey("idx:tokens")
+}
+
+// buildFullTextKey constructs the key of the hash mapping the files that
+// contain a full-text term to the term's weight in each
+func (c *Client) buildFullTextKey(term string) string {
+	return c.buildKey("idx:fts:" + term)
+}
+
+// buildFullTextVocabKey constructs the key of the sorted set of the
+// full-text terms of a length in runes, all with score 0, so fuzzy matching
+// only reads the lengths within its typo tolerance
+func (c *Client) buildFullTextVocabKey(length int) string {
+	return c.buildKey(fmt.Sprintf("idx:fts-vocab:%d", length))
+}
+
+// fullTextVocabEntry returns the vocabulary entry of a full-text term
+func (c *Client) fullTextVocabEntry(term string) vocabEntry {
+	return vocabEntry{c.buildFullTextVocabKey(utf8.RuneCountInString(term)), term}
+}
+
+// buildFileOrderKey constructs the key of the sorted set of all files, all
+// with score 0 so that they are ordered by hash ID (ZRANGEBYLEX)
+func (c *Client) buildFileOrderKey() string {
+	return c.buildKey("idx:files")
+}
+
+// buildIndexMetaKey constructs the key recording which configuration the
+// indexes were built for
+func (c *Client) buildIndexMetaKey() string {
+	return c.buildKey("idx:__meta__")
+}
+
+// indexFingerprint identifies the index configuration
+// (caller must hold the lock)
+func (c *Client) indexFingerprint() string {
+	fields := append([]string(nil), c.indexedFields...)
+	sort.Strings(fields)
+	return fmt.Sprintf("v%d:%s", indexVersion, strings.Join(fields, ","))
+}
+
+// isIndexed returns true if property has a value index
+// (caller must hold the lock)
+func (c *Client) isIndexed(property string) bool {
+	for _, field := range c.indexedFields {
+		if field == property {
+			return true
+		}
+	}
+	return false
+}
+
+// indexSourceFields returns every property that feeds an index
+// (caller must hold the lock)
+func (c *Client) indexSourceFields() []string {
+	fields := append([]string(nil), c.indexedFields...)
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		seen[field] = true
+	}
+	for _, field := range TextFields {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range fulltext.Fields {
+		if !seen[field.Name] {
+			seen[field.Name] = true
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// vocabEntry is the member standing for an index key in a sorted set of
+// values, tokens or full-text terms, through which prefix and fuzzy searches
+// find the key
+type vocabEntry struct {
+	vocabKey string
+	member   string
+}
+
+// indexKeys returns the index keys a file with the given field values
+// belongs to, with their vocabulary entries (caller must hold the lock)
+func (c *Client) indexKeys(fields map[string]string) map[string]vocabEntry {
+	keys := make(map[string]vocabEntry)
+	for _, property := range c.indexedFields {
+		for _, value := range SplitSet(fields[property]) {
+			if value = normalizeValue(value); value != "" {
+				keys[c.buildValueIndexKey(property, value)] = vocabEntry{c.buildValueVocabKey(property), value}
+			}
+		}
+	}
+	for _, property := range TextFields {
+		for _, token := range Tokenize(fields[property]) {
+			keys[c.buildTokenIndexKey(token)] = vocabEntry{c.buildTokenVocabKey(), token}
+		}
+	}
+	return keys
+}
+
+// indexChange is the set of index keys a write adds a file to and removes
+// it from, and the full-text term weights it changes
+type indexChange struct {
+	add    map[string]vocabEntry
+	remove map[string]vocabEntry
+
+	setTerms  map[string]float64    // Full-text key -> new weight of the file
+	dropTerms map[string]vocabEntry // Full-text keys the file leaves
+	newTerms  []vocabEntry          // Terms to add to the vocabulary
+}
+
+// queue adds the index updates to a transaction pipeline
+func (ic *indexChange) queue(ctx context.Context, pipe redis.Pipeliner, hashID string) {
+	for key := range ic.remove {
+		pipe.SRem(ctx, key, hashID)
+	}
+	for key, entry := range ic.add {
+		pipe.SAdd(ctx, key, hashID)
+		pipe.ZAdd(ctx, entry.vocabKey, redis.Z{Member: entry.member})
+	}
+	for key := range ic.dropTerms {
+		pipe.HDel(ctx, key, hashID)
+	}
+	for key, weight := range ic.setTerms {
+		pipe.HSet(ctx, key, hashID, strconv.FormatFloat(weight, 'g', -1, 64))
+	}
+	for _, entry := range ic.newTerms {
+		pipe.ZAdd(ctx, entry.vocabKey, redis.Z{Member: entry.member})
+	}
+}
+
+// pruneVocabulary removes the vocabulary entries of index keys that a write
+// left empty. The keys are watched, so an entry stays if a concurrent write
+// adds a file back; an entry left behind by a failed attempt matches no
+// files and goes with the next write that empties its key or the next
+// rebuild. (caller must hold the read lock)
+func (c *Client) pruneVocabulary(ctx context.Context, entries map[string]vocabEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+
+	err := c.fenced(ctx, keys, func(tx *redis.Tx) error {
+		exists := make([]*redis.IntCmd, len(keys))
+		_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				exists[i] = pipe.Exists(ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("exists failed: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				if exists[i].Val() == 0 {
+					entry := entries[key]
+					pipe.ZRem(ctx, entry.vocabKey, entry.member)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("[Storage] Warning: failed to prune index vocabulary: %v", err)
+	}
+}
+
+// fieldValues maps HMGET results to their fields, skipping missing ones
+func fieldValues(fields []string, values []interface{}) map[string]string {
+	result := make(map[string]string, len(fields))
+	for i, field := range fields {
+		if value, ok := values[i].(string); ok {
+			result[field] = value
+		}
+	}
+	return result
+}
+
+// diffIndexes returns the index changes for a file whose indexed fields go
+// from before to before with update applied (caller must hold the lock)
+func (c *Client) diffIndexes(before map[string]string, update func(fields map[string]string)) *indexChange {
+	after := make(map[string]string, len(before))
+	for field, value := range before {
+		after[field] = value
+	}
+	update(after)
+
+	oldKeys := c.indexKeys(before)
+	newKeys := c.indexKeys(after)
+
+	change := &indexChange{
+		add:       make(map[string]vocabEntry),
+		remove:    make(map[string]vocabEntry),
+		setTerms:  make(map[string]float64),
+		dropTerms: make(map[string]vocabEntry),
+	}
+	for key, entry := range oldKeys {
+		if _, ok := newKeys[key]; !ok {
+			change.remove[key] = entry
+		}
+	}
+	for key, entry := range newKeys {
+		if _, ok := oldKeys[key]; !ok {
+			change.add[key] = entry
+		}
+	}
+
+	oldWeights := fulltext.Weights(before)
+	newWeights := fulltext.Weights(after)
+	for term := range oldWeights {
+		if _, ok := newWeights[term]; !ok {
+			change.dropTerms[c.buildFullTextKey(term)] = c.fullTextVocabEntry(term)
+		}
+	}
+	for term, weight := range newWeights {
+		old, ok := oldWeights[term]
+		if !ok {
+			change.newTerms = append(change.newTerms, c.fullTextVocabEntry(term))
+		}
+		if !ok || old != weight {
+			change.setTerms[c.buildFullTextKey(term)] = weight
+		}
+	}
+	return change
+}
+
+// indexesCurrent returns true if the indexes were built for the current
+// configuration (caller must hold the lock)
+func (c *Client) indexesCurrent(ctx context.Context) (bool, error) {
+	stored, err := c.reader().Get(ctx, c.buildIndexMetaKey()).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get index meta failed: %w", err)
+	}
+	return stored == c.indexFingerprint(), nil
+}
+
+// IndexesCurrent returns true if the indexes were built for the configured fields
+func (c *Client) IndexesCurrent() (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return false, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return c.indexesCurrent(ctx)
+}
+
+// FindByProperty returns the files whose indexed property has the given value
+// Values are compared case-insensitively; each element of a pipe-delimited
+// set field is indexed separately.
+// Uses Redis Set: SMEMBERS idx:value:{property}:{value}
+func (c *Client) FindByProperty(property, value string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	if !c.isIndexed(property) {
+		return nil, fmt.Errorf("%w: %s", ErrNotIndexed, property)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := c.checkIndexesCurrent(ctx); err != nil {
+		return nil, err
+	}
+
+	result, err := c.reader().SMembers(ctx, c.buildValueIndexKey(property, normalizeValue(value))).Result()
+	if err != nil {
+		return nil, fmt.Errorf("smembers failed: %w", err)
+	}
+	return result, nil
+}
+
+// FindByPropertyPrefix returns the files whose indexed property has a value
+// starting with prefix, compared case-insensitively like FindByProperty
+// Uses Redis: ZRANGEBYLEX idx:values:{property}, SUNION idx:value:{property}:{value}...
+func (c *Client) FindByPropertyPrefix(property, prefix string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	if !c.isIndexed(property) {
+		return nil, fmt.Errorf("%w: %s", ErrNotIndexed, property)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := c.checkIndexesCurrent(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.findByPrefix(ctx, c.buildValueVocabKey(property), normalizeValue(prefix), func(value string) string {
+		return c.buildValueIndexKey(property, value)
+	})
+}
+
+// SearchText returns the files whose text fields contain, for every token of
+// query, a word starting with it: "matr rel" finds "The Matrix Reloaded"
+// Uses Redis: ZRANGEBYLEX idx:tokens, SUNION idx:token:{token}...
+func (c *Client) SearchText(query string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := c.checkIndexesCurrent(ctx); err != nil {
+		return nil, err
+	}
+
+	var matches map[string]struct{}
+	for _, token := range Tokenize(query) {
+		hashIDs, err := c.findByPrefix(ctx, c.buildTokenVocabKey(), token, c.buildTokenIndexKey)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(map[string]struct{}, len(hashIDs))
+		for _, hashID := range hashIDs {
+			if _, ok := matches[hashID]; matches == nil || ok {
+				next[hashID] = struct{}{}
+			}
+		}
+		matches = next
+		if len(matches) == 0 {
+			break
+		}
+	}
+
+	result := make([]string, 0, len(matches))
+	for hashID := range matches {
+		result = append(result, hashID)
+	}
+	return result, nil
+}
+
+// FindHashIDsByPrefix returns the files whose hash ID starts with prefix
+// Uses Redis Sorted Set: ZRANGEBYLEX idx:files [{prefix} [{prefix}\xff
+func (c *Client) FindHashIDsByPrefix(prefix string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := c.checkIndexesCurrent(ctx); err != nil {
+		return nil, err
+	}
+
+	result, err := c.reader().ZRangeByLex(ctx, c.buildFileOrderKey(), prefixRange(prefix)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("zrangebylex failed: %w", err)
+	}
+	return result, nil
+}
+
+// checkIndexesCurrent returns ErrNotIndexed if the indexes are not built for
+// the current configuration (caller must hold the lock)
+func (c *Client) checkIndexesCurrent(ctx context.Context) error {
+	current, err := c.indexesCurrent(ctx)
+	if err != nil {
+		return err
+	}
+	if !current {
+		return fmt.Errorf("%w: indexes are being rebuilt", ErrNotIndexed)
+	}
+	return nil
+}
+
+// findByPrefix returns the files in the index sets of the members of a
+// vocabulary that start with prefix (caller must hold the lock)
+func (c *Client) findByPrefix(ctx context.Context, vocabKey, prefix string, indexKey func(member string) string) ([]string, error) {
+	if prefix == "" {
+		return []string{}, nil
+	}
+
+	members, err := c.reader().ZRangeByLex(ctx, vocabKey, prefixRange(prefix)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("zrangebylex failed: %w", err)
+	}
+	if len(members) == 0 {
+		return []string{}, nil
+	}
+
+	keys := make([]string, len(members))
+	for i, member := range members {
+		keys[i] = indexKey(member)
+	}
+	result, err := c.reader().SUnion(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("sunion failed: %w", err)
+	}
+	return result, nil
+}
+
+// prefixRange is the ZRANGEBYLEX range of the members starting with prefix:
+// 0xff never occurs in UTF-8, so it sorts after every continuation
+func prefixRange(prefix string) *redis.ZRangeBy {
+	return &redis.ZRangeBy{Min: "[" + prefix, Max: "[" + prefix + "\xff"}
+}
+
+// ListHashIDs returns up to limit files whose hash ID sorts after the given
+// one, in hash ID order, and the cursor of the next page ("" on the last
+// page). Files added or removed between calls do not shift later pages.
+// Uses Redis Sorted Set: ZRANGEBYLEX idx:files (after +
+func (c *Client) ListHashIDs(after string, limit int) ([]string, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, "", fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	current, err := c.indexesCurrent(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var page []string
+	if current {
+		from := "-"
+		if after != "" {
+			from = "(" + after
+		}
+		// One extra to know whether there is a next page
+		page, err = c.reader().ZRangeByLex(ctx, c.buildFileOrderKey(), &redis.ZRangeBy{
+			Min:   from,
+			Max:   "+",
+			Count: int64(limit) + 1,
+		}).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("zrangebylex failed: %w", err)
+		}
+	} else {
+		// Sorted index not built yet: sort the whole file set
+		hashIDs, err := c.getAllHashIDsInternal(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		sort.Strings(hashIDs)
+		start := sort.Search(len(hashIDs), func(i int) bool { return hashIDs[i] > after })
+		page = hashIDs[start:]
+		if len(page) > limit+1 {
+			page = page[:limit+1]
+		}
+	}
+
+	if len(page) <= limit {
+		return page, "", nil
+	}
+	page = page[:limit]
+	return page, page[limit-1], nil
+}
+
+// RebuildIndexes drops all secondary indexes and rebuilds them from the
+// stored metadata. Reads and writes go on meanwhile: searches fall back to
+// full scans until it completes, and writes keep updating the indexes (see
+// rebuildBatches). Returns the number of files indexed.
+func (c *Client) RebuildIndexes() (int, error) {
+	c.rebuildMu.Lock()
+	defer c.rebuildMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return 0, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Refuse to rebuild on behalf of a superseded leader
+	if err := c.fenced(ctx, nil, func(tx *redis.Tx) error { return nil }); err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Del(ctx, c.buildIndexMetaKey()).Err(); err != nil {
+		return 0, fmt.Errorf("del index meta failed: %w", err)
+	}
+	if err := c.dropIndexes(ctx); err != nil {
+		return 0, err
+	}
+
+	hashIDs, err := c.client.SMembers(ctx, c.buildIndexKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("smembers failed: %w", err)
+	}
+
+	err = c.rebuildBatches(ctx, hashIDs, c.indexSourceFields(), func(pipe redis.Pipeliner, hashID string, fields map[string]string) {
+		pipe.ZAdd(ctx, c.buildFileOrderKey(), redis.Z{Member: hashID})
+		for key, entry := range c.indexKeys(fields) {
+			pipe.SAdd(ctx, key, hashID)
+			pipe.ZAdd(ctx, entry.vocabKey, redis.Z{Member: entry.member})
+		}
+		for term, weight := range fulltext.Weights(fields) {
+			pipe.HSet(ctx, c.buildFullTextKey(term), hashID, strconv.FormatFloat(weight, 'g', -1, 64))
+			entry := c.fullTextVocabEntry(term)
+			pipe.ZAdd(ctx, entry.vocabKey, redis.Z{Member: entry.member})
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Set(ctx, c.buildIndexMetaKey(), c.indexFingerprint(), 0).Err(); err != nil {
+		return 0, fmt.Errorf("set index meta failed: %w", err)
+	}
+
+	log.Printf("[Storage] Rebuilt indexes for %d files", len(hashIDs))
+	return len(hashIDs), nil
+}
+
+// rebuildBatches reads the given fields of the files in batches and queues
+// fn's index writes for each file that still exists. Each batch is a
+// transaction watching its files: a write landing between the read and the
+// index update retries the batch, and later writes update the rebuilt
+// entries like any other, so rebuilds need not block writes.
+// (caller must hold the read lock and rebuildMu)
+func (c *Client) rebuildBatches(ctx context.Context, hashIDs, fields []string, fn func(pipe redis.Pipeliner, hashID string, values map[string]string)) error {
+	return forBatches(hashIDs, func(batch []string) error {
+		keys := make([]string, len(batch))
+		for i, hashID := range batch {
+			keys[i] = c.buildHashKey(hashID)
+		}
+
+		return c.fenced(ctx, keys, func(tx *redis.Tx) error {
+			exists := make([]*redis.IntCmd, len(batch))
+			reads := make([]*redis.SliceCmd, len(batch))
+			_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i := range batch {
+					exists[i] = pipe.Exists(ctx, keys[i])
+					reads[i] = pipe.HMGet(ctx, keys[i], fields...)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("hmget failed: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				for i, hashID := range batch {
+					if exists[i].Val() > 0 {
+						fn(pipe, hashID, fieldValues(fields, reads[i].Val()))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("index write failed: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// dropIndexes deletes every index key (caller must hold the read lock)
+func (c *Client) dropIndexes(ctx context.Context) error {
+	return c.dropKeys(ctx, c.buildKey("idx:*"))
+}
+
+// dropKeys deletes every key matching pattern (caller must hold the read lock)
+func (c *Client) dropKeys(ctx context.Context, pattern string) error {
+	iter := c.client.Scan(ctx, 0, pattern, 1000).Iterator()
+
+	batch := make([]string, 0, 1000)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := c.client.Del(ctx, batch...).Err(); err != nil {
+				return fmt.Errorf("del keys failed: %w", err)
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("scan keys failed: %w", err)
+	}
+	if len(batch) > 0 {
+		if err := c.client.Del(ctx, batch...).Err(); err != nil {
+			return fmt.Errorf("del keys failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// normalizeValue normalizes a property value for the value index
+func normalizeValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// Tokenize splits text into lowercase word tokens for the text index
+// Words are runs of letters and digits; everything else separates them.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		if _, ok := seen[word]; !ok {
+			seen[word] = struct{}{}
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pathIndexVersion is bumped when the path index layout changes, forcing a
+// rebuild
+const pathIndexVersion = "1"
+
+// Properties describing where a file is
+const (
+	FilePathProperty     = "filePath"     // Path relative to FILES_PATH
+	PartialHashProperty  = "partialHash"  // Hash of the first 64KB, see watcher
+	StatusProperty       = "status"       // StatusMissing once the file is deleted
+	MissingSinceProperty = "missingSince" // Unix ms the file went missing
+)
+
+// StatusMissing is the status of orphaned metadata, whose file is gone
+const StatusMissing = "missing"
+
+// Orphan is metadata whose file is missing
+type Orphan struct {
+	HashID       string
+	Path         string
+	PartialHash  string
+	MissingSince time.Time
+}
+
+// NormalizePath returns the form of a path relative to FILES_PATH used as
+// the key of the path index: slash-separated, clean and without a leading
+// slash
+func NormalizePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/")
+}
+
+// buildPathKey constructs the key of the set of files at a path
+func (c *Client) buildPathKey(relPath string) string {
+	return c.buildKey("path:" + NormalizePath(relPath))
+}
+
+// buildPathMetaKey constructs the key recording the path index version
+func (c *Client) buildPathMetaKey() string {
+	return c.buildKey("meta:path-index")
+}
+
+// buildOrphansKey constructs the key of the set of orphaned files
+func (c *Client) buildOrphansKey() string {
+	return c.buildKey("orphans")
+}
+
+// isOrphan returns true if metadata is marked missing
+func isOrphan(metadata map[string]string) bool {
+	return metadata[StatusProperty] == StatusMissing
+}
+
+// queuePathChange queues the path index and orphan set updates for a file
+// whose metadata goes from before to after
+func (c *Client) queuePathChange(ctx context.Context, pipe redis.Pipeliner, hashID string, before, after map[string]string) {
+	oldPath := NormalizePath(before[FilePathProperty])
+	newPath := NormalizePath(after[FilePathProperty])
+	if oldPath != newPath {
+		if oldPath != "" {
+			pipe.SRem(ctx, c.buildPathKey(oldPath), hashID)
+		}
+		if newPath != "" {
+			pipe.SAdd(ctx, c.buildPathKey(newPath), hashID)
+		}
+	}
+
+	switch wasOrphan, orphan := isOrphan(before), isOrphan(after); {
+	case orphan && !wasOrphan:
+		pipe.SAdd(ctx, c.buildOrphansKey(), hashID)
+	case wasOrphan && !orphan:
+		pipe.SRem(ctx, c.buildOrphansKey(), hashID)
+	}
+}
+
+// pathIndexCurrent returns true if the path index is built
+// (caller must hold the lock)
+func (c *Client) pathIndexCurrent(ctx context.Context) (bool, error) {
+	stored, err := c.reader().Get(ctx, c.buildPathMetaKey()).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get path index meta failed: %w", err)
+	}
+	return stored == pathIndexVersion, nil
+}
+
+// PathIndexCurrent returns true if the path index and orphan set are built
+func (c *Client) PathIndexCurrent() (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return false, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return c.pathIndexCurrent(ctx)
+}
+
+// LookupHashesByPath returns the sorted hash IDs of the files whose filePath
+// is relPath. Uses the path index, or scans every file while the index is
+// being built.
+// Uses Redis Set: SMEMBERS path:{relPath}
+func (c *Client) LookupHashesByPath(relPath string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	relPath = NormalizePath(relPath)
+	if relPath == "" {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	current, err := c.pathIndexCurrent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashIDs []string
+	if current {
+		hashIDs, err = c.reader().SMembers(ctx, c.buildPathKey(relPath)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("smembers failed: %w", err)
+		}
+	} else {
+		all, err := c.getAllHashIDsInternal(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = c.readFieldsMulti(ctx, all, []string{FilePathProperty}, func(hashID string, values map[string]string) bool {
+			if NormalizePath(values[FilePathProperty]) == relPath {
+				hashIDs = append(hashIDs, hashID)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(hashIDs)
+	return hashIDs, nil
+}
+
+// Orphans returns the files whose metadata is marked missing, the longest
+// missing first
+func (c *Client) Orphans() ([]Orphan, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	hashIDs, err := c.reader().SMembers(ctx, c.buildOrphansKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("smembers failed: %w", err)
+	}
+
+	fields := []string{FilePathProperty, PartialHashProperty, StatusProperty, MissingSinceProperty}
+	orphans := make([]Orphan, 0, len(hashIDs))
+	err = c.readFieldsMulti(ctx, hashIDs, fields, func(hashID string, values map[string]string) bool {
+		if !isOrphan(values) {
+			return true
+		}
+		orphan := Orphan{
+			HashID:      hashID,
+			Path:        values[FilePathProperty],
+			PartialHash: values[PartialHashProperty],
+		}
+		if ms, err := strconv.ParseInt(values[MissingSinceProperty], 10, 64); err == nil {
+			orphan.MissingSince = time.UnixMilli(ms)
+		}
+		orphans = append(orphans, orphan)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		if !orphans[i].MissingSince.Equal(orphans[j].MissingSince) {
+			return orphans[i].MissingSince.Before(orphans[j].MissingSince)
+		}
+		return orphans[i].HashID < orphans[j].HashID
+	})
+	return orphans, nil
+}
+
+// RebuildPathIndex drops the path index and orphan set and rebuilds them
+// from the stored metadata. Lookups scan every file until it completes.
+// Returns the number of paths indexed.
+func (c *Client) RebuildPathIndex() (int, error) {
+	c.rebuildMu.Lock()
+	defer c.rebuildMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return 0, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Refuse to rebuild on behalf of a superseded leader
+	if err := c.fenced(ctx, nil, func(tx *redis.Tx) error { return nil }); err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Del(ctx, c.buildPathMetaKey(), c.buildOrphansKey()).Err(); err != nil {
+		return 0, fmt.Errorf("del path index meta failed: %w", err)
+	}
+	if err := c.dropKeys(ctx, c.buildKey("path:*")); err != nil {
+		return 0, err
+	}
+
+	hashIDs, err := c.client.SMembers(ctx, c.buildIndexKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("smembers failed: %w", err)
+	}
+
+	paths := make(map[string]struct{})
+	err = c.rebuildBatches(ctx, hashIDs, []string{FilePathProperty, StatusProperty}, func(pipe redis.Pipeliner, hashID string, fields map[string]string) {
+		c.queuePathChange(ctx, pipe, hashID, nil, fields)
+		if relPath := NormalizePath(fields[FilePathProperty]); relPath != "" {
+			paths[relPath] = struct{}{}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.client.Set(ctx, c.buildPathMetaKey(), pathIndexVersion, 0).Err(); err != nil {
+		return 0, fmt.Errorf("set path index meta failed: %w", err)
+	}
+
+	log.Printf("[Storage] Rebuilt path index with %d paths from %d files", len(paths), len(hashIDs))
+	return len(paths), nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRevisionMismatch is returned by conditional writes when the file has
+// been changed since the expected revision
+var ErrRevisionMismatch = errors.New("revision mismatch")
+
+// buildRevisionKey constructs the key of a file's revision counter
+// Every write to the file increments it. It outlives the file's metadata so
+// that a deleted and recreated file never reuses a revision.
+func (c *Client) buildRevisionKey(hashID string) string {
+	return c.buildKey("rev:" + hashID)
+}
+
+// GetMetadataRevision retrieves all metadata for a file with its revision,
+// read together in one transaction. Files written before revisions existed
+// are at revision 0 until their next write.
+// Uses Redis: MULTI, HGETALL file:{hashId}, GET rev:{hashId}, EXEC
+func (c *Client) GetMetadataRevision(hashID string) (map[string]string, int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, 0, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var metadata *redis.MapStringStringCmd
+	var revision *redis.StringCmd
+	_, err := c.reader().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		metadata = pipe.HGetAll(ctx, c.buildHashKey(hashID))
+		revision = pipe.Get(ctx, c.buildRevisionKey(hashID))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, 0, fmt.Errorf("hgetall failed: %w", err)
+	}
+
+	rev, err := parseRevision(revision)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(metadata.Val()) == 0 {
+		return nil, rev, nil
+	}
+	return metadata.Val(), rev, nil
+}
+
+// parseRevision reads a revision counter, 0 if it does not exist
+func parseRevision(cmd *redis.StringCmd) (int64, error) {
+	rev, err := cmd.Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get revision failed: %w", err)
+	}
+	return rev, nil
+}
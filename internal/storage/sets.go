@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// setEncodingVersion is the version of the set value encoding recorded once
+// legacy values have been migrated (see MigrateSetEncoding)
+const setEncodingVersion = "1"
+
+// SplitSet returns the elements of a set-type property value
+// Elements are separated by "|"; a "|" or "\" inside an element is escaped
+// with a backslash. Any other backslash is taken literally, so plain values
+// written before escaping existed read the same.
+func SplitSet(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var elements []string
+	var element strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch ch := value[i]; {
+		case ch == '\\' && i+1 < len(value) && (value[i+1] == '|' || value[i+1] == '\\'):
+			element.WriteByte(value[i+1])
+			i++
+		case ch == '|':
+			elements = append(elements, element.String())
+			element.Reset()
+		default:
+			element.WriteByte(ch)
+		}
+	}
+	return append(elements, element.String())
+}
+
+// JoinSet returns the value of a set-type property with the given elements
+// (see SplitSet)
+func JoinSet(elements []string) string {
+	escaped := make([]string, len(elements))
+	for i, element := range elements {
+		element = strings.ReplaceAll(element, `\`, `\\`)
+		escaped[i] = strings.ReplaceAll(element, "|", `\|`)
+	}
+	return strings.Join(escaped, "|")
+}
+
+// buildSetEncodingKey constructs the key recording the set encoding version
+func (c *Client) buildSetEncodingKey() string {
+	return c.buildKey("meta:set-encoding")
+}
+
+// buildSetMigratedKey constructs the key of the set of files whose values
+// are already in the escaped encoding while the migration is pending
+func (c *Client) buildSetMigratedKey() string {
+	return c.buildKey("meta:set-encoding:migrated")
+}
+
+// setFields returns the properties read as sets: the indexed fields and the
+// CID fields with their paths (caller must hold the lock)
+func (c *Client) setFields() []string {
+	return append(append([]string(nil), c.indexedFields...), c.cidSourceFields()...)
+}
+
+// legacySetValues returns the escaped value of each set property of a file
+// whose value was written before escaping and would read differently now.
+// Only multi-valued values are taken as legacy sets, so single values such
+// as UNC paths are left alone. (caller must hold the lock)
+func (c *Client) legacySetValues(metadata map[string]string) map[string]string {
+	values := make(map[string]string)
+	for _, property := range c.setFields() {
+		value := metadata[property]
+		if !strings.Contains(value, "|") || !strings.Contains(value, `\`) {
+			continue
+		}
+		if legacy := strings.Split(value, "|"); !equalElements(SplitSet(value), legacy) {
+			values[property] = JoinSet(legacy)
+		}
+	}
+	return values
+}
+
+// setEncodingPending returns true if the set values of files not yet marked
+// migrated may be in the legacy encoding (caller must hold the lock)
+func (c *Client) setEncodingPending(version *redis.StringCmd) bool {
+	if version == nil {
+		return false
+	}
+	if version.Val() == setEncodingVersion {
+		c.setEncodingDone.Store(true)
+		return false
+	}
+	return true
+}
+
+// MigrateSetEncoding rewrites the multi-valued set properties stored before
+// elements were escaped, whose backslashes would now read as escapes, so
+// that they keep their elements. Until it completes every write escapes the
+// legacy values of the files it touches and marks them migrated, and the
+// migration skips marked files, so values are never escaped twice: not by a
+// rerun after a failure, nor by two runs at once. Each file is written at
+// the revision it was read at, so concurrent writes are never overwritten.
+// Later calls return immediately. Returns the number of files rewritten.
+func (c *Client) MigrateSetEncoding() (int, error) {
+	c.mu.RLock()
+	if c.client == nil {
+		c.mu.RUnlock()
+		return 0, fmt.Errorf("not connected")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	version, err := c.client.Get(ctx, c.buildSetEncodingKey()).Result()
+	cancel()
+	c.mu.RUnlock()
+	if err == nil && version == setEncodingVersion {
+		c.setEncodingDone.Store(true)
+		return 0, nil
+	}
+
+	hashIDs, err := c.GetAllHashIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	err = forBatches(hashIDs, func(batch []string) error {
+		metadata, err := c.GetMetadataFlatMulti(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, hashID := range batch {
+			c.mu.RLock()
+			legacy := len(c.legacySetValues(metadata[hashID])) > 0
+			c.mu.RUnlock()
+			if !legacy {
+				continue
+			}
+
+			rewritten, err := c.migrateSetValues(hashID)
+			if err != nil {
+				return err
+			}
+			if rewritten {
+				migrated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return migrated, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.buildSetEncodingKey(), setEncodingVersion, 0)
+		pipe.Del(ctx, c.buildSetMigratedKey())
+		return nil
+	})
+	if err != nil {
+		return migrated, fmt.Errorf("set failed: %w", err)
+	}
+	c.setEncodingDone.Store(true)
+
+	if migrated > 0 {
+		log.Printf("[Storage] Migrated set values of %d files", migrated)
+	}
+	return migrated, nil
+}
+
+// migrateSetValues escapes the legacy set values of a file unless it is
+// marked migrated, at the revision it was read at, reading it again if it
+// changed in between. Returns true if the file was rewritten.
+func (c *Client) migrateSetValues(hashID string) (bool, error) {
+	for attempt := 0; attempt < maxTxRetries; attempt++ {
+		metadata, revision, err := c.GetMetadataRevision(hashID)
+		if err != nil {
+			return false, err
+		}
+
+		c.mu.RLock()
+		if c.client == nil {
+			c.mu.RUnlock()
+			return false, fmt.Errorf("not connected")
+		}
+		// Read together: a run that completes drops the marks as it records
+		// the version
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var marked *redis.BoolCmd
+		var version *redis.StringCmd
+		_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			marked = pipe.SIsMember(ctx, c.buildSetMigratedKey(), hashID)
+			version = pipe.Get(ctx, c.buildSetEncodingKey())
+			return nil
+		})
+		cancel()
+		values := c.legacySetValues(metadata)
+		c.mu.RUnlock()
+		if err != nil && err != redis.Nil {
+			return false, fmt.Errorf("sismember failed: %w", err)
+		}
+		if marked.Val() || version.Val() == setEncodingVersion || len(values) == 0 {
+			return false, nil
+		}
+
+		_, err = c.write("migrate", "", BatchOp{HashID: hashID, IfRevision: &revision, Set: values})
+		if errors.Is(err, ErrRevisionMismatch) {
+			continue
+		}
+		return err == nil, err
+	}
+	return false, fmt.Errorf("%w: %s (%d retries)", ErrConflict, hashID, maxTxRetries)
+}
+
+// equalElements returns true if both sets have the same elements in order
+func equalElements(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
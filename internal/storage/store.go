@@ -0,0 +1,60 @@
+package storage
+
+// Store is the metadata storage used by the HTTP API
+// Client implements it against Redis, either an external redis-server or
+// the in-process server of embedded mode (see internal/embedded).
+type Store interface {
+	IsConnected() bool
+	Health() bool
+
+	GetMetadataFlat(hashID string) (map[string]string, error)
+	GetMetadataRevision(hashID string) (map[string]string, int64, error)
+	GetMetadataFlatMulti(hashIDs []string) (map[string]map[string]string, error)
+	SetMetadataFlat(hashID string, metadata map[string]string) error
+	SetMetadataFlatMulti(items map[string]map[string]string) error
+	MergeMetadataFlat(hashID string, metadata map[string]string) (int, error)
+	DeleteMetadata(hashID string) (int64, error)
+	ClearAllMetadata() (int64, error)
+	ApplyBatch(ops []BatchOp) (map[string]int64, error)
+	WithSource(source string) Store
+
+	GetAllHashIDs() ([]string, error)
+	ListHashIDs(after string, limit int) ([]string, string, error)
+	CountFiles() (int, error)
+	LookupPathByCID(cid string) (string, error)
+	LookupHashesByPath(relPath string) ([]string, error)
+	Orphans() ([]Orphan, error)
+
+	GetProperty(hashID, property string) (string, error)
+	GetPropertyMulti(hashIDs []string, property string) (map[string]string, error)
+	SetProperty(hashID, property, value string) error
+	DeleteProperty(hashID, property string) error
+	AddToSet(hashID, property, value string) (bool, error)
+	RemoveFromSet(hashID, property, value string) (bool, error)
+
+	FindByProperty(property, value string) ([]string, error)
+	FindByPropertyPrefix(property, prefix string) ([]string, error)
+	SearchText(query string) ([]string, error)
+	FindHashIDsByPrefix(prefix string) ([]string, error)
+	FullTextSearch(query string) ([]FullTextHit, error)
+	IndexesCurrent() (bool, error)
+	RebuildIndexes() (int, error)
+	MigrateSetEncoding() (int, error)
+	CIDIndexCurrent() (bool, error)
+	RebuildCIDIndex() (int, error)
+	PathIndexCurrent() (bool, error)
+	RebuildPathIndex() (int, error)
+
+	History(hashID, before string, count int) ([]HistoryEntry, string, error)
+	RevertToRevision(hashID string, revision int64) (int64, error)
+	RecordRestore() error
+	LatestChangeID() (string, error)
+	Changes(since string, count int) ([]ChangeEvent, error)
+
+	GetMemoryInfo() (string, error)
+}
+
+var (
+	_ Store = (*Client)(nil)
+	_ Store = (*sourcedClient)(nil)
+)
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// sourcedClient is a Client whose writes are attributed to a source (e.g.
+// the service that sent the request) in the history
+type sourcedClient struct {
+	*Client
+	source string
+}
+
+// WithSource returns a Store whose writes are recorded in the history as
+// made by source
+func (c *Client) WithSource(source string) Store {
+	return &sourcedClient{Client: c, source: source}
+}
+
+// WithSource returns a Store writing on behalf of another source
+func (w *sourcedClient) WithSource(source string) Store {
+	return w.Client.WithSource(source)
+}
+
+// writeResult is the state of the files a write touched
+type writeResult struct {
+	before    map[string]map[string]string // Metadata before the write (nil if absent)
+	after     map[string]map[string]string // Metadata after the write (empty if deleted)
+	revisions map[string]int64             // Revisions after the write
+}
+
+// changed returns true if the write changed the property of the file
+func (r *writeResult) changed(hashID, property string) bool {
+	old, hadOld := r.before[hashID][property]
+	current, hasCurrent := r.after[hashID][property]
+	return hadOld != hasCurrent || old != current
+}
+
+// SetMetadataFlat stores metadata for a file using Redis Hash
+// Uses Redis Hash: HMSET file:{hashId} prop1 val1 prop2 val2...
+func (w *sourcedClient) SetMetadataFlat(hashID string, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return w.checkConnected()
+	}
+	_, err := w.write("set", w.source, BatchOp{HashID: hashID, Set: metadata})
+	return err
+}
+
+// MergeMetadataFlat merges new metadata into existing (PATCH semantics)
+// New keys are added, existing keys are updated, missing keys are NOT deleted
+// Uses Redis Hash: HMSET file:{hashId}
+func (w *sourcedClient) MergeMetadataFlat(hashID string, metadata map[string]string) (int, error) {
+	if len(metadata) == 0 {
+		return 0, w.checkConnected()
+	}
+	if _, err := w.write("merge", w.source, BatchOp{HashID: hashID, Set: metadata}); err != nil {
+		return 0, err
+	}
+	return len(metadata), nil
+}
+
+// DeleteMetadata deletes all metadata for a file
+// Returns the number of properties deleted
+// Uses Redis Hash: DEL file:{hashId}
+func (w *sourcedClient) DeleteMetadata(hashID string) (int64, error) {
+	result, err := w.write("delete", w.source, BatchOp{HashID: hashID, Delete: true})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(result.before[hashID])), nil
+}
+
+// SetProperty sets a single property value
+// Uses Redis Hash: HSET file:{hashId} {property} {value}
+func (w *sourcedClient) SetProperty(hashID, property, value string) error {
+	_, err := w.write("set", w.source, BatchOp{HashID: hashID, Set: map[string]string{property: value}})
+	return err
+}
+
+// DeleteProperty deletes a single property
+// Uses Redis Hash: HDEL file:{hashId} {property}
+func (w *sourcedClient) DeleteProperty(hashID, property string) error {
+	_, err := w.write("unset", w.source, BatchOp{HashID: hashID, Unset: []string{property}})
+	return err
+}
+
+// AddToSet adds a value to a set-type field (stored as pipe-delimited string in Hash field)
+// Returns true if value was added, false if it already existed
+func (w *sourcedClient) AddToSet(hashID, property, value string) (bool, error) {
+	result, err := w.write("add", w.source, BatchOp{HashID: hashID, AddToSet: map[string][]string{property: {value}}})
+	if err != nil {
+		return false, err
+	}
+	return result.changed(hashID, property), nil
+}
+
+// RemoveFromSet removes a value from a set-type field (stored in Hash)
+// Returns true if value was removed, false if it didn't exist
+func (w *sourcedClient) RemoveFromSet(hashID, property, value string) (bool, error) {
+	result, err := w.write("remove", w.source, BatchOp{HashID: hashID, RemoveFromSet: map[string][]string{property: {value}}})
+	if err != nil {
+		return false, err
+	}
+	return result.changed(hashID, property), nil
+}
+
+// ApplyBatch applies all operations in one fenced transaction that watches
+// every file they touch: either the whole batch is written or nothing is.
+// Returns the revision of every file after the batch, ErrRevisionMismatch if
+// a file is not at its expected revision and ErrConflict if the files keep
+// changing concurrently.
+// Uses Redis: WATCH file:{hashId}... MULTI ... EXEC
+func (w *sourcedClient) ApplyBatch(ops []BatchOp) (map[string]int64, error) {
+	result, err := w.write("batch", w.source, ops...)
+	if err != nil {
+		return nil, err
+	}
+	return result.revisions, nil
+}
+
+// checkConnected returns an error if the client is not connected
+func (c *Client) checkConnected() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return fmt.Errorf("not connected")
+	}
+	return nil
+}
+
+// write applies ops as one transaction (see applyOps)
+func (c *Client) write(op, source string, ops ...BatchOp) (*writeResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	return c.applyOps(ctx, op, source, ops)
+}
+
+// applyOps applies the operations in one fenced transaction that watches
+// every file they touch. Each file that changes gets its indexes updated,
+// its revision incremented, an entry in the history, recorded as op made by
+// source, and an event in the change feed. (caller must hold the lock)
+func (c *Client) applyOps(ctx context.Context, op, source string, ops []BatchOp) (*writeResult, error) {
+	var hashIDs []string
+	seen := make(map[string]bool)
+	for i, batchOp := range ops {
+		if batchOp.HashID == "" {
+			return nil, fmt.Errorf("operation %d: missing hash ID", i)
+		}
+		if !seen[batchOp.HashID] {
+			seen[batchOp.HashID] = true
+			hashIDs = append(hashIDs, batchOp.HashID)
+		}
+	}
+
+	result := &writeResult{
+		before:    make(map[string]map[string]string, len(hashIDs)),
+		after:     make(map[string]map[string]string, len(hashIDs)),
+		revisions: make(map[string]int64, len(hashIDs)),
+	}
+	if len(hashIDs) == 0 {
+		return result, nil
+	}
+
+	hashKeys := make([]string, len(hashIDs))
+	watchKeys := make([]string, 0, 2*len(hashIDs))
+	for i, hashID := range hashIDs {
+		hashKeys[i] = c.buildHashKey(hashID)
+		watchKeys = append(watchKeys, hashKeys[i], c.buildRevisionKey(hashID))
+	}
+	checkSetEncoding := !c.setEncodingDone.Load()
+	if checkSetEncoding {
+		watchKeys = append(watchKeys, c.buildSetEncodingKey())
+	}
+
+	var emptied map[string]vocabEntry // Index keys the write may have emptied
+	err := c.fenced(ctx, watchKeys, func(tx *redis.Tx) error {
+		reads := make([]*redis.MapStringStringCmd, len(hashIDs))
+		revReads := make([]*redis.StringCmd, len(hashIDs))
+		var versionRead *redis.StringCmd
+		markedReads := make([]*redis.BoolCmd, len(hashIDs))
+		_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, hashID := range hashIDs {
+				reads[i] = pipe.HGetAll(ctx, hashKeys[i])
+				revReads[i] = pipe.Get(ctx, c.buildRevisionKey(hashID))
+				if checkSetEncoding {
+					markedReads[i] = pipe.SIsMember(ctx, c.buildSetMigratedKey(), hashID)
+				}
+			}
+			if checkSetEncoding {
+				versionRead = pipe.Get(ctx, c.buildSetEncodingKey())
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("hgetall failed: %w", err)
+		}
+
+		revisions := make(map[string]int64, len(hashIDs))
+		for i, hashID := range hashIDs {
+			if revisions[hashID], err = parseRevision(revReads[i]); err != nil {
+				return err
+			}
+		}
+		for _, batchOp := range ops {
+			if batchOp.IfRevision != nil && *batchOp.IfRevision != revisions[batchOp.HashID] {
+				return fmt.Errorf("%w: %s is at revision %d, expected %d",
+					ErrRevisionMismatch, batchOp.HashID, revisions[batchOp.HashID], *batchOp.IfRevision)
+			}
+		}
+
+		// Apply the operations in memory, then write the differences
+		before := make(map[string]map[string]string, len(hashIDs))
+		after := make(map[string]map[string]string, len(hashIDs))
+		for i, hashID := range hashIDs {
+			if metadata := reads[i].Val(); len(metadata) > 0 {
+				before[hashID] = metadata
+			}
+			after[hashID] = make(map[string]string, len(before[hashID]))
+			for property, value := range before[hashID] {
+				after[hashID][property] = value
+			}
+		}
+		// Until the set encoding migration completes, legacy set values are
+		// escaped before the operations read them, and the files marked
+		migrating := c.setEncodingPending(versionRead)
+		if migrating {
+			for i, hashID := range hashIDs {
+				if !markedReads[i].Val() {
+					for property, value := range c.legacySetValues(after[hashID]) {
+						after[hashID][property] = value
+					}
+				}
+			}
+		}
+		for _, batchOp := range ops {
+			after[batchOp.HashID] = applyBatchOp(after[batchOp.HashID], batchOp)
+		}
+
+		changes := make([]*indexChange, len(hashIDs))
+		for i, hashID := range hashIDs {
+			final := after[hashID]
+			changes[i] = c.diffIndexes(before[hashID], func(fields map[string]string) {
+				for property := range fields {
+					delete(fields, property)
+				}
+				for property, value := range final {
+					fields[property] = value
+				}
+			})
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, hashID := range hashIDs {
+				old, final := before[hashID], after[hashID]
+				diff := diffProperties(old, final)
+				if len(diff) == 0 {
+					continue
+				}
+
+				if len(final) == 0 {
+					pipe.Del(ctx, hashKeys[i])
+					pipe.SRem(ctx, c.buildIndexKey(), hashID)
+					pipe.ZRem(ctx, c.buildFileOrderKey(), hashID)
+				} else {
+					var removed []string
+					changed := make(map[string]string)
+					for _, change := range diff {
+						if change.New == nil {
+							removed = append(removed, change.Property)
+						} else {
+							changed[change.Property] = *change.New
+						}
+					}
+					if len(removed) > 0 {
+						pipe.HDel(ctx, hashKeys[i], removed...)
+					}
+					if len(changed) > 0 {
+						pipe.HMSet(ctx, hashKeys[i], changed)
+					}
+					pipe.SAdd(ctx, c.buildIndexKey(), hashID)
+					pipe.ZAdd(ctx, c.buildFileOrderKey(), redis.Z{Member: hashID})
+				}
+				changes[i].queue(ctx, pipe, hashID)
+				if migrating {
+					pipe.SAdd(ctx, c.buildSetMigratedKey(), hashID)
+				}
+				c.queueCIDChange(ctx, pipe, hashID, old, final)
+				c.queuePathChange(ctx, pipe, hashID, old, final)
+
+				// The revision key is watched, so the increment lands on the
+				// value read above
+				revisions[hashID]++
+				pipe.Incr(ctx, c.buildRevisionKey(hashID))
+
+				// A clear is recorded once in the global history and the
+				// change feed (see recordClear), and per file only here
+				cleared := op == "clear"
+				c.queueHistory(ctx, pipe, HistoryEntry{
+					HashID:   hashID,
+					Revision: revisions[hashID],
+					Op:       op,
+					Source:   source,
+					Changes:  diff,
+				}, !cleared)
+				if !cleared {
+					c.queueChange(ctx, pipe, ChangeEvent{
+						HashID:   hashID,
+						Revision: revisions[hashID],
+						Op:       op,
+						Keys:     changedKeys(diff),
+					})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", op, err)
+		}
+
+		result.before, result.after, result.revisions = before, after, revisions
+		emptied = make(map[string]vocabEntry)
+		for _, change := range changes {
+			for key, entry := range change.remove {
+				emptied[key] = entry
+			}
+			for key, entry := range change.dropTerms {
+				emptied[key] = entry
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.pruneVocabulary(ctx, emptied)
+	return result, nil
+}
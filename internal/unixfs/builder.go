@@ -0,0 +1,199 @@
+package unixfs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// DefaultChunkSize is the size of the leaves of `ipfs add`'s default
+	// chunker (size-262144)
+	DefaultChunkSize = 256 << 10
+	// DefaultMaxLinks is the number of children of a node in `ipfs add`'s
+	// balanced layout
+	DefaultMaxLinks = 174
+)
+
+// unixfsTypeFile is the UnixFS Data type of file nodes
+const unixfsTypeFile = 2
+
+// ErrFinished is returned when writing to a finished builder
+var ErrFinished = errors.New("builder already finished")
+
+// Block is a block of a UnixFS DAG
+type Block struct {
+	CID  CID
+	Data []byte
+}
+
+// link is a reference from a node to a child
+type link struct {
+	cid      CID
+	tsize    uint64 // Size of the child's blocks and all their descendants
+	fileSize uint64 // Bytes of file data under the child
+}
+
+// Builder builds the UnixFS DAG of a file written to it, the way
+// `ipfs add --cid-version 1` does: the file is cut into DefaultChunkSize raw
+// leaves, which a balanced tree of dag-pb nodes with up to DefaultMaxLinks
+// children each joins together. A file of a single chunk is its own leaf.
+// Blocks are passed to emit, children before their parents, as soon as
+// they are built, so a file of any size is hashed in constant memory.
+type Builder struct {
+	emit     func(Block) error
+	chunk    []byte
+	levels   [][]link // Links waiting for a parent, by height above the leaves
+	leaves   int
+	finished bool
+}
+
+// NewBuilder creates a builder passing each block to emit, which may be nil
+// when only the root CID is needed
+func NewBuilder(emit func(Block) error) *Builder {
+	return &Builder{
+		emit:  emit,
+		chunk: make([]byte, 0, DefaultChunkSize),
+	}
+}
+
+// Write adds file data to the DAG
+func (b *Builder) Write(p []byte) (int, error) {
+	if b.finished {
+		return 0, ErrFinished
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(b.chunk[len(b.chunk):cap(b.chunk)], p)
+		b.chunk = b.chunk[:len(b.chunk)+n]
+		p = p[n:]
+		written += n
+		if len(b.chunk) == cap(b.chunk) {
+			if err := b.flushChunk(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Finish builds the remaining nodes and returns the root CID
+func (b *Builder) Finish() (CID, error) {
+	if b.finished {
+		return nil, ErrFinished
+	}
+	b.finished = true
+
+	// An empty file is a single empty leaf
+	if len(b.chunk) > 0 || b.leaves == 0 {
+		if err := b.flushChunk(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Join what is left on each level, up to a single root
+	for height := 0; ; height++ {
+		links := b.levels[height]
+		if height == len(b.levels)-1 && len(links) == 1 {
+			return links[0].cid, nil
+		}
+		if len(links) == 0 {
+			continue
+		}
+		if err := b.flushLevel(height); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// flushChunk turns the buffered data into a raw leaf
+func (b *Builder) flushChunk() error {
+	data := b.chunk
+	leaf := Block{CID: NewCID(CodecRaw, data), Data: data}
+	if err := b.emitBlock(leaf); err != nil {
+		return err
+	}
+	b.chunk = make([]byte, 0, DefaultChunkSize)
+	b.leaves++
+	return b.addLink(0, link{cid: leaf.CID, tsize: uint64(len(data)), fileSize: uint64(len(data))})
+}
+
+// addLink adds a link waiting for a parent at a height, building the parent
+// once it is full
+func (b *Builder) addLink(height int, l link) error {
+	if height == len(b.levels) {
+		b.levels = append(b.levels, nil)
+	}
+	b.levels[height] = append(b.levels[height], l)
+	if len(b.levels[height]) == DefaultMaxLinks {
+		return b.flushLevel(height)
+	}
+	return nil
+}
+
+// flushLevel builds the parent of the links waiting at a height
+func (b *Builder) flushLevel(height int) error {
+	links := b.levels[height]
+	b.levels[height] = nil
+
+	data := encodeFileNode(links)
+	node := Block{CID: NewCID(CodecDagPB, data), Data: data}
+	if err := b.emitBlock(node); err != nil {
+		return err
+	}
+
+	parent := link{cid: node.CID, tsize: uint64(len(data))}
+	for _, l := range links {
+		parent.tsize += l.tsize
+		parent.fileSize += l.fileSize
+	}
+	return b.addLink(height+1, parent)
+}
+
+// emitBlock passes a block to emit, if set
+func (b *Builder) emitBlock(block Block) error {
+	if b.emit == nil {
+		return nil
+	}
+	return b.emit(block)
+}
+
+// encodeFileNode returns the dag-pb encoding of a UnixFS file node with the
+// given children. Fields are written in the order go-merkledag writes them,
+// which the CID depends on: links before data, and every link with its
+// (empty) name.
+func encodeFileNode(links []link) []byte {
+	// UnixFS Data: Type, filesize, then blocksizes unpacked (proto2)
+	var fileSize uint64
+	for _, l := range links {
+		fileSize += l.fileSize
+	}
+	unixfsData := appendVarintField(nil, 1, unixfsTypeFile)
+	unixfsData = appendVarintField(unixfsData, 3, fileSize)
+	for _, l := range links {
+		unixfsData = appendVarintField(unixfsData, 4, l.fileSize)
+	}
+
+	var node []byte
+	for _, l := range links {
+		var pbLink []byte
+		pbLink = appendBytesField(pbLink, 1, l.cid)    // Hash
+		pbLink = appendBytesField(pbLink, 2, nil)      // Name
+		pbLink = appendVarintField(pbLink, 3, l.tsize) // Tsize
+		node = appendBytesField(node, 2, pbLink)
+	}
+	return appendBytesField(node, 1, unixfsData)
+}
+
+// appendVarintField appends a protobuf varint field
+func appendVarintField(buf []byte, field int, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3)
+	return binary.AppendUvarint(buf, value)
+}
+
+// appendBytesField appends a protobuf length-delimited field
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
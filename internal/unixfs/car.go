@@ -0,0 +1,89 @@
+package unixfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrRootMismatch is returned when the exported data does not build the
+// expected root, e.g. because the file changed since its CID was computed
+var ErrRootMismatch = errors.New("data does not match the root CID")
+
+// WriteCAR writes the UnixFS DAG of the data read from r as a CARv1 with the
+// given root. The root is needed up front for the header, so compute it
+// first (e.g. with a Builder without emit); blocks follow children first.
+func WriteCAR(w io.Writer, root CID, r io.Reader) error {
+	out := bufio.NewWriter(w)
+	if err := writeCARHeader(out, root); err != nil {
+		return err
+	}
+
+	builder := NewBuilder(func(block Block) error {
+		return writeCARBlock(out, block)
+	})
+	if _, err := io.Copy(builder, r); err != nil {
+		return err
+	}
+	built, err := builder.Finish()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(built, root) {
+		return ErrRootMismatch
+	}
+	return out.Flush()
+}
+
+// writeCARHeader writes the CARv1 header: the dag-cbor map
+// {"roots": [root], "version": 1}, with its keys in canonical order
+func writeCARHeader(w io.Writer, root CID) error {
+	var header []byte
+	header = append(header, 0xa2) // map(2)
+	header = appendCBORText(header, "roots")
+	header = append(header, 0x81)                   // array(1)
+	header = append(header, 0xd8, 0x2a)             // tag(42): CID
+	header = appendCBORHead(header, 2, len(root)+1) // bytes
+	header = append(header, 0x00)                   // identity multibase prefix
+	header = append(header, root...)
+	header = appendCBORText(header, "version")
+	header = append(header, 0x01) // 1
+
+	return writeSection(w, header)
+}
+
+// writeCARBlock writes a block section: its CID followed by its data
+func writeCARBlock(w io.Writer, block Block) error {
+	section := make([]byte, 0, len(block.CID)+len(block.Data))
+	section = append(section, block.CID...)
+	return writeSection(w, append(section, block.Data...))
+}
+
+// writeSection writes data prefixed with its varint length
+func writeSection(w io.Writer, data []byte) error {
+	if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(data)))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// appendCBORText appends a CBOR text string
+func appendCBORText(buf []byte, s string) []byte {
+	return append(appendCBORHead(buf, 3, len(s)), s...)
+}
+
+// appendCBORHead appends the head of a CBOR item of a major type with the
+// given length
+func appendCBORHead(buf []byte, major byte, length int) []byte {
+	switch {
+	case length < 24:
+		return append(buf, major<<5|byte(length))
+	case length < 1<<8:
+		return append(buf, major<<5|24, byte(length))
+	default:
+		return append(buf, major<<5|25, byte(length>>8), byte(length))
+	}
+}
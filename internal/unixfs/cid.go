@@ -0,0 +1,83 @@
+// Package unixfs builds the IPFS content addresses of files without an IPFS
+// node: the UnixFS DAG `ipfs add --cid-version 1` builds (balanced layout,
+// 256KiB chunks, raw leaves) and CARv1 exports of it.
+package unixfs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Multicodec codes of the blocks in a UnixFS DAG
+const (
+	CodecRaw    = 0x55
+	CodecDagPB  = 0x70
+	sha256Code  = 0x12
+	cidVersion1 = 0x01
+)
+
+// ErrInvalidCID is returned when a CID cannot be parsed
+var ErrInvalidCID = errors.New("invalid CID")
+
+// base32Lower is the multibase "b" encoding used for CIDv1 strings
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// CID is a binary CIDv1 with a sha256 multihash
+type CID []byte
+
+// NewCID returns the CID of a block of the given codec
+func NewCID(codec uint64, data []byte) CID {
+	sum := sha256.Sum256(data)
+	return CIDFromDigest(codec, sum[:])
+}
+
+// CIDFromDigest returns the CID of a block of the given codec whose sha256
+// digest is known
+func CIDFromDigest(codec uint64, sha256Sum []byte) CID {
+	cid := make([]byte, 0, 2*binary.MaxVarintLen64+2+len(sha256Sum))
+	cid = binary.AppendUvarint(cid, cidVersion1)
+	cid = binary.AppendUvarint(cid, codec)
+	cid = binary.AppendUvarint(cid, sha256Code)
+	cid = binary.AppendUvarint(cid, uint64(len(sha256Sum)))
+	return append(cid, sha256Sum...)
+}
+
+// ParseCID parses a base32lower CIDv1 string ("b" multibase prefix)
+func ParseCID(s string) (CID, error) {
+	if !strings.HasPrefix(s, "b") {
+		return nil, ErrInvalidCID
+	}
+	cid, err := base32Lower.DecodeString(s[1:])
+	if err != nil {
+		return nil, ErrInvalidCID
+	}
+
+	rest := cid
+	for i := 0; i < 3; i++ { // version, codec, hash code
+		_, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return nil, ErrInvalidCID
+		}
+		rest = rest[n:]
+	}
+	length, n := binary.Uvarint(rest)
+	if n <= 0 || cid[0] != cidVersion1 || uint64(len(rest[n:])) != length {
+		return nil, ErrInvalidCID
+	}
+	return CID(cid), nil
+}
+
+// Codec returns the multicodec code of the block the CID identifies
+func (c CID) Codec() uint64 {
+	_, n := binary.Uvarint(c)
+	codec, _ := binary.Uvarint(c[n:])
+	return codec
+}
+
+// String returns the CID as base32lower with the "b" multibase prefix
+func (c CID) String() string {
+	return "b" + base32Lower.EncodeToString(c)
+}
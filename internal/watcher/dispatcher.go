@@ -20,10 +20,12 @@ const (
 	MaxFailCount = 10
 )
 
-// Dispatcher sends file events to subscribers
+// Dispatcher sends file events, and other events published through
+// DispatchEvent, to subscribers
 type Dispatcher struct {
 	subscribers map[string]*Subscriber
 	sseClients  map[chan FileEvent]bool
+	listeners   []func(FileEvent)
 	mu          sync.RWMutex
 	httpClient  *http.Client
 }
@@ -92,6 +94,14 @@ func (d *Dispatcher) RemoveSSEClient(ch chan FileEvent) {
 	close(ch)
 }
 
+// Listen registers fn to be called with every file event, in order, from
+// the goroutine dispatching it; fn must not block
+func (d *Dispatcher) Listen(fn func(FileEvent)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.listeners = append(d.listeners, fn)
+}
+
 // Dispatch sends an event to all subscribers
 func (d *Dispatcher) Dispatch(event FileEvent) {
 	// Dispatch to webhooks
@@ -99,10 +109,51 @@ func (d *Dispatcher) Dispatch(event FileEvent) {
 
 	// Dispatch to SSE clients
 	d.dispatchToSSE(event)
+
+	// Dispatch to in-process listeners
+	d.mu.RLock()
+	listeners := d.listeners
+	d.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
+
+// DispatchEvent sends a non-file event to webhook subscribers
+// Only subscribers that list eventType in their EventTypes receive it, so
+// existing subscribers that expect file events are not affected
+func (d *Dispatcher) DispatchEvent(eventType string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[Dispatcher] Failed to marshal %s event: %v", eventType, err)
+		return
+	}
+
+	d.mu.RLock()
+	urls := make([]string, 0, len(d.subscribers))
+	for _, sub := range d.subscribers {
+		for _, et := range sub.EventTypes {
+			if et == eventType {
+				urls = append(urls, sub.URL)
+				break
+			}
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, url := range urls {
+		go d.deliverToWebhook(url, eventType, body)
+	}
 }
 
 // dispatchToWebhooks sends event to webhook subscribers
 func (d *Dispatcher) dispatchToWebhooks(event FileEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[Dispatcher] Failed to marshal event: %v", err)
+		return
+	}
+
 	d.mu.RLock()
 	subscribers := make([]*Subscriber, 0, len(d.subscribers))
 	for _, sub := range d.subscribers {
@@ -125,18 +176,12 @@ func (d *Dispatcher) dispatchToWebhooks(event FileEvent) {
 			}
 		}
 
-		go d.deliverToWebhook(sub.URL, event)
+		go d.deliverToWebhook(sub.URL, string(event.Type), body)
 	}
 }
 
 // deliverToWebhook delivers an event to a webhook with retries
-func (d *Dispatcher) deliverToWebhook(url string, event FileEvent) {
-	body, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("[Dispatcher] Failed to marshal event: %v", err)
-		return
-	}
-
+func (d *Dispatcher) deliverToWebhook(url string, eventType string, body []byte) {
 	var lastErr error
 	for attempt := 0; attempt < MaxRetries; attempt++ {
 		if attempt > 0 {
@@ -150,7 +195,7 @@ func (d *Dispatcher) deliverToWebhook(url string, event FileEvent) {
 		}
 
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Event-Type", string(event.Type))
+		req.Header.Set("X-Event-Type", eventType)
 
 		resp, err := d.httpClient.Do(req)
 		if err != nil {
@@ -16,6 +16,8 @@ type Handlers struct {
 }
 
 // NewHandlers creates new watcher handlers
+// watcher may be nil when file watching is disabled; subscriber management
+// stays available so other events can still be delivered
 func NewHandlers(watcher *Watcher, dispatcher *Dispatcher) *Handlers {
 	return &Handlers{
 		watcher:    watcher,
@@ -100,6 +102,11 @@ func (h *Handlers) handlePoll(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if h.watcher == nil {
+		writeError(w, http.StatusServiceUnavailable, "file watcher not enabled")
+		return
+	}
+
 	events := h.watcher.GetRecentEvents(sinceMS, limit)
 
 	writeJSON(w, http.StatusOK, EventsListResponse{
@@ -166,6 +173,11 @@ func (h *Handlers) handleRemoveSubscriber(w http.ResponseWriter, r *http.Request
 
 // handleTriggerScan handles POST /api/scan/trigger
 func (h *Handlers) handleTriggerScan(w http.ResponseWriter, r *http.Request) {
+	if h.watcher == nil {
+		writeError(w, http.StatusServiceUnavailable, "file watcher not enabled")
+		return
+	}
+
 	go h.watcher.RunScan()
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -176,6 +188,11 @@ func (h *Handlers) handleTriggerScan(w http.ResponseWriter, r *http.Request) {
 
 // handleScanStatus handles GET /api/scan/status
 func (h *Handlers) handleScanStatus(w http.ResponseWriter, r *http.Request) {
+	if h.watcher == nil {
+		writeError(w, http.StatusServiceUnavailable, "file watcher not enabled")
+		return
+	}
+
 	status := h.watcher.GetStatus()
 	writeJSON(w, http.StatusOK, status)
 }
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/metazla/meta-core/internal/midhash"
+)
+
+// identity is the cached partial hash and hash ID of a file, valid while its
+// size and mtime are unchanged
+type identity struct {
+	size        int64
+	modTime     time.Time
+	partialHash string
+	hashID      string
+}
+
+// Identities caches the partial hash and hash ID of files by path, so scans
+// and repeated events only read files that changed: a hash ID reads 1MiB of
+// every file, which adds up on network mounts.
+type Identities struct {
+	mu      sync.Mutex
+	entries map[string]identity
+}
+
+// NewIdentities creates an empty identity cache
+func NewIdentities() *Identities {
+	return &Identities{entries: make(map[string]identity)}
+}
+
+// Identify returns the partial hash and hash ID of a file, reading it only
+// if its size or mtime changed since it was last identified
+func (c *Identities) Identify(path string) (string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.Forget(path)
+		return "", "", err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.partialHash, cached.hashID, nil
+	}
+
+	partialHash, err := computePartialHash(path)
+	if err != nil {
+		return "", "", err
+	}
+	hashID, err := midhash.File(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Keyed by the stat taken before reading, so a write during hashing
+	// changes the mtime and the next call reads the file again
+	c.mu.Lock()
+	c.entries[path] = identity{
+		size:        info.Size(),
+		modTime:     info.ModTime(),
+		partialHash: partialHash,
+		hashID:      hashID,
+	}
+	c.mu.Unlock()
+	return partialHash, hashID, nil
+}
+
+// Forget drops the cached identity of a file
+func (c *Identities) Forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, path)
+}
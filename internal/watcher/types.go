@@ -19,6 +19,7 @@ type FileEvent struct {
 	Size        int64         `json:"size,omitempty"`
 	Timestamp   int64         `json:"timestamp"`
 	PartialHash string        `json:"partialHash,omitempty"` // Hash of first 64KB
+	HashID      string        `json:"hashId,omitempty"`      // midhash256 hash ID
 	OldPath     string        `json:"oldPath,omitempty"`     // For rename events
 }
 
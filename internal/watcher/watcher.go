@@ -26,6 +26,7 @@ type Watcher struct {
 	fsWatcher  *fsnotify.Watcher
 	debouncer  *Debouncer
 	dispatcher *Dispatcher
+	identities *Identities
 	filesPath  string
 	watchPaths []string
 
@@ -52,6 +53,7 @@ func NewWatcher(cfg *config.Config, dispatcher *Dispatcher) (*Watcher, error) {
 		fsWatcher:   fsWatcher,
 		debouncer:   debouncer,
 		dispatcher:  dispatcher,
+		identities:  NewIdentities(),
 		filesPath:   cfg.FilesPath,
 		watchPaths:  cfg.WatchFolderList,
 		stopChan:    make(chan struct{}),
@@ -204,12 +206,13 @@ func (w *Watcher) handleFsEvent(event fsnotify.Event) {
 
 // handleDebouncedEvent processes a debounced event
 func (w *Watcher) handleDebouncedEvent(event FileEvent) {
-	// Compute partial hash for add/change events
-	if event.Type == EventTypeAdd || event.Type == EventTypeChange {
-		fullPath := filepath.Join(w.filesPath, event.Path)
-		if hash, err := computePartialHash(fullPath); err == nil {
-			event.PartialHash = hash
-		}
+	// Compute hashes for add/change events, forget those of removed files
+	path := filepath.Join(w.filesPath, event.Path)
+	switch event.Type {
+	case EventTypeAdd, EventTypeChange:
+		w.identify(&event, path)
+	case EventTypeDelete, EventTypeRename:
+		w.identities.Forget(path)
 	}
 
 	// Add to buffer
@@ -293,10 +296,8 @@ func (w *Watcher) scanDirectory(root string) int {
 			Timestamp: NowMS(),
 		}
 
-		// Compute partial hash
-		if hash, err := computePartialHash(path); err == nil {
-			event.PartialHash = hash
-		}
+		// Compute hashes (unless unchanged since the last scan)
+		w.identify(&event, path)
 
 		// Dispatch directly (skip debouncer for scan)
 		w.dispatcher.Dispatch(event)
@@ -344,6 +345,15 @@ func (w *Watcher) GetStatus() ScanStatusResponse {
 	}
 }
 
+// identify sets the partial hash and hash ID of a file event, leaving them
+// empty if the file cannot be read
+func (w *Watcher) identify(event *FileEvent, path string) {
+	if partialHash, hashID, err := w.identities.Identify(path); err == nil {
+		event.PartialHash = partialHash
+		event.HashID = hashID
+	}
+}
+
 // computePartialHash computes SHA-256 hash of first 64KB of a file
 func computePartialHash(path string) (string, error) {
 	file, err := os.Open(path)
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/metazla/meta-core/internal/embedded"
 )
 
 // MockHealthResponse represents the expected health response structure
@@ -172,3 +173,45 @@ func TestOptionsRequest(t *testing.T) {
 		t.Errorf("OPTIONS request returned status %d, expected 200", rr.Code)
 	}
 }
+
+func TestListMetaPages(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	handler := newAPI(t, client)
+	for _, id := range []string{"c", "a", "b"} {
+		client.SetMetadataFlat(id, map[string]string{"title": id})
+	}
+
+	list := func(query string) map[string]interface{} {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/meta"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /meta%s: expected 200, got %d", query, rr.Code)
+		}
+		var response map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	// Without paging parameters every hash ID is returned
+	all := list("")
+	if all["count"] != float64(3) || all["nextCursor"] != nil {
+		t.Errorf("Expected all 3 hash IDs without a cursor, got %v", all)
+	}
+
+	page := list("?limit=2")
+	if page["count"] != float64(2) || page["nextCursor"] != "b" {
+		t.Errorf("Expected a page of 2 with cursor b, got %v", page)
+	}
+	page = list("?cursor=b")
+	if page["count"] != float64(1) || page["nextCursor"] != nil {
+		t.Errorf("Expected the last page of 1, got %v", page)
+	}
+}
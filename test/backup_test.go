@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/backup"
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestBackupListAndLookup(t *testing.T) {
+	cfg := &config.Config{
+		MetaCorePath: t.TempDir(),
+	}
+
+	manager, err := backup.NewManager(cfg, leader.NewElection(cfg), nil)
+	if err != nil {
+		t.Fatalf("Failed to create backup manager: %v", err)
+	}
+
+	files := map[string]string{
+		"20260101-120000.000-scheduled.rdb": "older",
+		"20260102-120000.000-manual.rdb":    "newer",
+		"not-a-backup.rdb":                  "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cfg.BackupsDir(), name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	backups, err := manager.List()
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %d", len(backups))
+	}
+
+	if backups[0].ID != "20260102-120000.000-manual" || backups[0].Reason != backup.ReasonManual {
+		t.Errorf("Expected newest manual backup first, got %+v", backups[0])
+	}
+
+	if backups[1].Size != int64(len("older")) {
+		t.Errorf("Expected size %d, got %d", len("older"), backups[1].Size)
+	}
+
+	if _, err := manager.Get("../locks/kv-leader"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for invalid ID, got %v", err)
+	}
+
+	// Followers cannot take or restore backups
+	if _, err := manager.Create(context.Background(), backup.ReasonManual); !errors.Is(err, leader.ErrNotLeader) {
+		t.Errorf("Expected ErrNotLeader, got %v", err)
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	cfg := &config.Config{
+		MetaCorePath:          t.TempDir(),
+		RedisMode:             leader.RedisModeEmbedded,
+		RedisBind:             "127.0.0.1",
+		RedisPort:             freePort(t),
+		LockBackend:           leader.LockBackendFlock,
+		HealthCheckIntervalMS: 100,
+		BackupRetention:       2,
+		PreRestoreRetention:   1,
+	}
+
+	election := leader.NewElection(cfg)
+	if err := election.Start(); err != nil {
+		t.Fatalf("Failed to start election: %v", err)
+	}
+	defer election.Stop()
+	if !election.IsLeader() {
+		t.Fatal("Expected to become leader")
+	}
+
+	manager, err := backup.NewManager(cfg, election, nil)
+	if err != nil {
+		t.Fatalf("Failed to create backup manager: %v", err)
+	}
+
+	ctx := context.Background()
+	create := func() *backup.Backup {
+		t.Helper()
+		time.Sleep(2 * time.Millisecond) // Backup IDs have millisecond precision
+		created, err := manager.Create(ctx, backup.ReasonScheduled)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return created
+	}
+	restore := func(id string) string {
+		t.Helper()
+		time.Sleep(2 * time.Millisecond)
+		result, err := manager.Restore(ctx, id)
+		if err != nil {
+			t.Fatalf("Restore failed: %v", err)
+		}
+		return result.PreRestore.ID
+	}
+	expectBackups := func(want ...string) {
+		t.Helper()
+		backups, err := manager.List()
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		var got []string
+		for _, b := range backups {
+			got = append(got, b.ID)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(want)))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected backups %v, got %v", want, got)
+		}
+	}
+
+	first := create()
+	undo := restore(first.ID)
+
+	// Scheduled backups do not push out the pre-restore one
+	create()
+	second, third := create(), create()
+	expectBackups(second.ID, third.ID, undo)
+
+	// Pre-restore backups have their own limit
+	undo = restore(second.ID)
+	fourth := create()
+	expectBackups(third.ID, fourth.ID, undo)
+}
+
+func TestRestoreResetsChangeFeed(t *testing.T) {
+	cfg := &config.Config{
+		MetaCorePath:          t.TempDir(),
+		RedisMode:             leader.RedisModeEmbedded,
+		RedisBind:             "127.0.0.1",
+		RedisPort:             freePort(t),
+		LockBackend:           leader.LockBackendFlock,
+		HealthCheckIntervalMS: 100,
+	}
+
+	election := leader.NewElection(cfg)
+	store := storage.NewClient("")
+	election.SetStorageConnector(store)
+	if err := election.Start(); err != nil {
+		t.Fatalf("Failed to start election: %v", err)
+	}
+	defer election.Stop()
+	if !election.IsLeader() {
+		t.Fatal("Expected to become leader")
+	}
+
+	manager, err := backup.NewManager(cfg, election, store)
+	if err != nil {
+		t.Fatalf("Failed to create backup manager: %v", err)
+	}
+
+	ctx := context.Background()
+	store.SetProperty("a", "title", "Before")
+	saved, err := manager.Create(ctx, backup.ReasonManual)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	store.SetProperty("a", "title", "After")
+	cursor, _ := store.LatestChangeID()
+
+	if _, err := manager.Restore(ctx, saved.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if title, _ := store.GetProperty("a", "title"); title != "Before" {
+		t.Errorf("Expected the restored title, got %q", title)
+	}
+
+	// The feed no longer holds the cursor's event; the restore event tells
+	// consumers past it to resynchronize
+	events, err := store.Changes(cursor, 100)
+	if err != nil || len(events) != 1 || events[0].Op != "restore" {
+		t.Fatalf("Expected a restore event after the old cursor, got %+v (%v)", events, err)
+	}
+	if global, _, _ := store.History("", "", 1); len(global) != 1 || global[0].Op != "restore" {
+		t.Errorf("Expected the restore in the global history, got %+v", global)
+	}
+
+	// SSE clients get it as a reset
+	reqCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/metadata/changes?since="+cursor, nil).WithContext(reqCtx)
+	rr := httptest.NewRecorder()
+	newAPI(t, store).ServeHTTP(rr, req)
+	if want := "event: reset\ndata: {\"reason\":\"restore\",\"since\":\"" + events[0].ID + "\"}"; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("Expected %q in the SSE stream, got %q", want, rr.Body.String())
+	}
+}
@@ -0,0 +1,160 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestBulkOperations(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	// More files than one pipeline batch
+	const files = 2500
+	items := make(map[string]map[string]string, files)
+	hashIDs := make([]string, 0, files+1)
+	for i := 0; i < files; i++ {
+		hashID := fmt.Sprintf("h%04d", i)
+		items[hashID] = map[string]string{
+			"title":    fmt.Sprintf("File %d", i),
+			"type":     []string{"movie", "episode"}[i%2],
+			"sizeByte": strconv.Itoa(i),
+		}
+		hashIDs = append(hashIDs, hashID)
+	}
+	items["h2499"]["poster"] = "bafkposter"
+	items["h2499"]["posterPath"] = "/files/poster.jpg"
+
+	if err := client.SetMetadataFlatMulti(items); err != nil {
+		t.Fatalf("SetMetadataFlatMulti failed: %v", err)
+	}
+
+	hashIDs = append(hashIDs, "missing")
+	metadata, err := client.GetMetadataFlatMulti(hashIDs)
+	if err != nil {
+		t.Fatalf("GetMetadataFlatMulti failed: %v", err)
+	}
+	if len(metadata) != files {
+		t.Errorf("Expected %d files, got %d", files, len(metadata))
+	}
+	if metadata["h1234"]["title"] != "File 1234" {
+		t.Errorf("Unexpected metadata for h1234: %v", metadata["h1234"])
+	}
+	if _, ok := metadata["missing"]; ok {
+		t.Error("Expected missing file to be left out")
+	}
+
+	sizes, err := client.GetPropertyMulti(hashIDs, "sizeByte")
+	if err != nil {
+		t.Fatalf("GetPropertyMulti failed: %v", err)
+	}
+	if len(sizes) != files || sizes["h0042"] != "42" {
+		t.Errorf("Unexpected sizes: %d entries, h0042=%q", len(sizes), sizes["h0042"])
+	}
+
+	// Bulk writes maintain the indexes
+	movies, err := client.FindByProperty("type", "movie")
+	if err != nil {
+		t.Fatalf("FindByProperty failed: %v", err)
+	}
+	if len(movies) != files/2 {
+		t.Errorf("Expected %d movies, got %d", files/2, len(movies))
+	}
+	ids, err := client.SearchText("file 2498")
+	expectIDs(t, "text file 2498", ids, err, "h2498")
+
+	path, err := client.LookupPathByCID("bafkposter")
+	if err != nil {
+		t.Fatalf("LookupPathByCID failed: %v", err)
+	}
+	if path != "/files/poster.jpg" {
+		t.Errorf("Expected poster path, got %q", path)
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+	if err := client.SetMetadataFlat("a", map[string]string{"title": "Old", "genre": "Drama|Comedy", "year": "1999"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if err := client.SetMetadataFlat("b", map[string]string{"title": "Gone", "type": "movie"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+
+	_, err := client.ApplyBatch([]storage.BatchOp{
+		{HashID: "a", Set: map[string]string{"title": "New"}, Unset: []string{"year"}},
+		{HashID: "a", AddToSet: map[string][]string{"genre": {"Sci-Fi", "Drama"}}, RemoveFromSet: map[string][]string{"genre": {"Comedy"}}},
+		{HashID: "b", Delete: true},
+		{HashID: "c", Delete: true, Set: map[string]string{"title": "Fresh", "type": "movie"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+
+	expectMetadata := func(hashID string, want map[string]string) {
+		t.Helper()
+		got, err := client.GetMetadataFlat(hashID)
+		if err != nil {
+			t.Fatalf("GetMetadataFlat failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", hashID, want, got)
+		}
+	}
+	expectMetadata("a", map[string]string{"title": "New", "genre": "Drama|Sci-Fi"})
+	expectMetadata("b", nil)
+	expectMetadata("c", map[string]string{"title": "Fresh", "type": "movie"})
+
+	ids, err := client.FindByProperty("type", "movie")
+	expectIDs(t, "type=movie", ids, err, "c")
+	ids, err = client.FindByProperty("genre", "comedy")
+	expectIDs(t, "genre=comedy", ids, err)
+	ids, err = client.SearchText("new")
+	expectIDs(t, "text new", ids, err, "a")
+	ids, _, err = client.ListHashIDs("", 10)
+	expectIDs(t, "files", ids, err, "a", "c")
+
+	// An invalid operation rejects the whole batch
+	_, err = client.ApplyBatch([]storage.BatchOp{
+		{HashID: "a", Set: map[string]string{"title": "Partial"}},
+		{Set: map[string]string{"title": "No hash"}},
+	})
+	if err == nil {
+		t.Error("Expected batch with a missing hash ID to fail")
+	}
+	expectMetadata("a", map[string]string{"title": "New", "genre": "Drama|Sci-Fi"})
+
+	// So does a superseded leader
+	if err := client.GetRedisClient().Set(context.Background(), storage.EpochKey, 5, 0).Err(); err != nil {
+		t.Fatalf("Failed to set epoch: %v", err)
+	}
+	client.SetEpoch(4)
+	_, err = client.ApplyBatch([]storage.BatchOp{{HashID: "a", Delete: true}, {HashID: "d", Set: map[string]string{"title": "D"}}})
+	if !errors.Is(err, storage.ErrStaleEpoch) {
+		t.Errorf("Expected ErrStaleEpoch, got %v", err)
+	}
+	expectMetadata("a", map[string]string{"title": "New", "genre": "Drama|Sci-Fi"})
+	expectMetadata("d", nil)
+}
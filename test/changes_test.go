@@ -0,0 +1,83 @@
+package test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestChangeFeed(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	start, err := client.LatestChangeID()
+	if err != nil || start != "0-0" {
+		t.Fatalf("Expected an empty feed to start at 0-0, got %q (%v)", start, err)
+	}
+
+	if err := client.SetMetadataFlat("a", map[string]string{"title": "Movie", "year": "1999"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if err := client.SetProperty("a", "year", "1999"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	if _, err := client.AddToSet("b", "genre", "Drama"); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+	if _, err := client.DeleteMetadata("a"); err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+
+	events, err := client.Changes(start, 100)
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	// The unchanged year is not an event
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	if events[0].HashID != "a" || events[0].Op != "set" || events[0].Revision != 1 ||
+		!reflect.DeepEqual(events[0].Keys, []string{"title", "year"}) {
+		t.Errorf("Unexpected set event: %+v", events[0])
+	}
+	if events[1].HashID != "b" || events[1].Op != "add" || !reflect.DeepEqual(events[1].Keys, []string{"genre"}) {
+		t.Errorf("Unexpected add event: %+v", events[1])
+	}
+	if events[2].HashID != "a" || events[2].Op != "delete" || events[2].Revision != 2 {
+		t.Errorf("Unexpected delete event: %+v", events[2])
+	}
+
+	// Resuming after an event returns only the later ones
+	rest, err := client.Changes(events[0].ID, 100)
+	if err != nil || len(rest) != 2 || rest[0].ID != events[1].ID {
+		t.Errorf("Expected to resume after the first event, got %+v (%v)", rest, err)
+	}
+	if latest, _ := client.LatestChangeID(); latest != events[2].ID {
+		t.Errorf("Expected latest change %s, got %s", events[2].ID, latest)
+	}
+
+	if _, err := client.ClearAllMetadata(); err != nil {
+		t.Fatalf("ClearAllMetadata failed: %v", err)
+	}
+	cleared, err := client.Changes(events[2].ID, 100)
+	if err != nil || len(cleared) != 1 || cleared[0].Op != "clear" || cleared[0].HashID != "" {
+		t.Errorf("Expected a clear event, got %+v (%v)", cleared, err)
+	}
+
+	// A cursor the feed has been trimmed past must resynchronize
+	client.SetChangeFeedLength(2)
+	for _, title := range []string{"one", "two", "three"} {
+		if err := client.SetProperty("c", "title", title); err != nil {
+			t.Fatalf("SetProperty failed: %v", err)
+		}
+	}
+	if _, err := client.Changes(events[2].ID, 100); !errors.Is(err, storage.ErrChangesTrimmed) {
+		t.Errorf("Expected ErrChangesTrimmed, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestParseCIDFields(t *testing.T) {
+	got := storage.ParseCIDFields([]string{"poster", " subtitles:subtitleFiles ", ""})
+	want := []storage.CIDField{
+		{Property: "poster", PathProperty: "posterPath"},
+		{Property: "subtitles", PathProperty: "subtitleFiles"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCIDFields = %+v, want %+v", got, want)
+	}
+}
+
+func TestCIDIndex(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	expectPath := func(cid, want string) {
+		t.Helper()
+		path, err := client.LookupPathByCID(cid)
+		if err != nil {
+			t.Fatalf("LookupPathByCID failed: %v", err)
+		}
+		if path != want {
+			t.Errorf("LookupPathByCID(%s) = %q, want %q", cid, path, want)
+		}
+	}
+
+	// Written before the index exists: lookups scan
+	if err := client.SetMetadataFlat("a", map[string]string{"poster": "bafkposter", "posterPath": "a/poster.jpg"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	expectPath("bafkposter", "a/poster.jpg")
+
+	if current, _ := client.CIDIndexCurrent(); current {
+		t.Fatal("Expected the CID index not to be current before a rebuild")
+	}
+	indexed, err := client.RebuildCIDIndex()
+	if err != nil || indexed != 1 {
+		t.Fatalf("Expected 1 CID indexed, got %d (%v)", indexed, err)
+	}
+	expectPath("bafkposter", "a/poster.jpg")
+
+	// Writes keep the index current; sets of CIDs pair with sets of paths
+	subtitles := map[string]string{
+		"subtitles":     storage.JoinSet([]string{"bafken", "bafkfr"}),
+		"subtitlesPath": storage.JoinSet([]string{"b/movie.en.srt", "b/movie.fr.srt"}),
+		"trailer":       "bafktrailer",
+		"trailerPath":   "b/trailer.mp4",
+	}
+	if err := client.SetMetadataFlat("b", subtitles); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	expectPath("bafkfr", "b/movie.fr.srt")
+	expectPath("bafktrailer", "b/trailer.mp4")
+
+	if err := client.SetProperty("a", "posterPath", "a/folder.jpg"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	expectPath("bafkposter", "a/folder.jpg")
+
+	if err := client.DeleteProperty("b", "trailer"); err != nil {
+		t.Fatalf("DeleteProperty failed: %v", err)
+	}
+	expectPath("bafktrailer", "")
+
+	if _, err := client.DeleteMetadata("b"); err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+	expectPath("bafken", "")
+
+	// Only configured fields are indexed, and a new configuration needs a rebuild
+	client.SetCIDFields(storage.ParseCIDFields([]string{"nfo"}))
+	if current, _ := client.CIDIndexCurrent(); current {
+		t.Error("Expected a CID field change to outdate the index")
+	}
+	if err := client.SetMetadataFlat("c", map[string]string{"nfo": "bafknfo", "nfoPath": "c/movie.nfo"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if _, err := client.RebuildCIDIndex(); err != nil {
+		t.Fatalf("RebuildCIDIndex failed: %v", err)
+	}
+	expectPath("bafknfo", "c/movie.nfo")
+	expectPath("bafkposter", "")
+}
@@ -89,3 +89,88 @@ func TestConfigPaths(t *testing.T) {
 		t.Errorf("Unexpected ServicesDir: %s", cfg.ServicesDir())
 	}
 }
+
+func TestConfigFileWithEnvOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+	configJSON := `{
+		"redis": {
+			"password": "from-file",
+			"username": "meta",
+			"maxmemory": "256mb",
+			"aclUsers": ["reader on >secret ~* +@read"]
+		}
+	}`
+	if err := os.WriteFile(tmpDir+"/config.json", []byte(configJSON), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	os.Setenv("META_CORE_PATH", tmpDir)
+	os.Setenv("REDIS_PASSWORD", "from-env")
+	defer os.Clearenv()
+
+	cfg := config.Load()
+
+	if cfg.RedisPassword != "from-env" {
+		t.Errorf("Expected env to override file password, got '%s'", cfg.RedisPassword)
+	}
+
+	if cfg.RedisUsername != "meta" {
+		t.Errorf("Expected RedisUsername 'meta', got '%s'", cfg.RedisUsername)
+	}
+
+	if cfg.RedisMaxMemory != "256mb" {
+		t.Errorf("Expected RedisMaxMemory '256mb', got '%s'", cfg.RedisMaxMemory)
+	}
+
+	if len(cfg.RedisACLUsers) != 1 || cfg.RedisACLUsers[0] != "reader on >secret ~* +@read" {
+		t.Errorf("Unexpected RedisACLUsers: %v", cfg.RedisACLUsers)
+	}
+
+	if cfg.RedisMaxMemoryPolicy != "noeviction" {
+		t.Errorf("Expected default RedisMaxMemoryPolicy 'noeviction', got '%s'", cfg.RedisMaxMemoryPolicy)
+	}
+}
+
+func TestEnsureRedisPassword(t *testing.T) {
+	dir := t.TempDir()
+
+	loopback := &config.Config{MetaCorePath: dir, RedisBind: "127.0.0.1 -::1"}
+	if err := loopback.EnsureRedisPassword(); err != nil {
+		t.Fatalf("EnsureRedisPassword failed: %v", err)
+	}
+	if loopback.RedisPassword != "" {
+		t.Error("Expected no password for a loopback bind")
+	}
+
+	first := &config.Config{MetaCorePath: dir, RedisBind: "0.0.0.0"}
+	if err := first.EnsureRedisPassword(); err != nil {
+		t.Fatalf("EnsureRedisPassword failed: %v", err)
+	}
+	if len(first.RedisPassword) < 32 {
+		t.Errorf("Expected a generated password, got %q", first.RedisPassword)
+	}
+	info, err := os.Stat(first.RedisPasswordFilePath())
+	if err != nil {
+		t.Fatalf("Expected a published password file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// Every other node picks up the published password
+	second := &config.Config{MetaCorePath: dir, RedisBind: "10.0.0.5"}
+	if err := second.EnsureRedisPassword(); err != nil {
+		t.Fatalf("EnsureRedisPassword failed: %v", err)
+	}
+	if second.RedisPassword != first.RedisPassword {
+		t.Error("Expected the second node to share the published password")
+	}
+
+	configured := &config.Config{MetaCorePath: dir, RedisBind: "0.0.0.0", RedisPassword: "secret"}
+	if err := configured.EnsureRedisPassword(); err != nil {
+		t.Fatalf("EnsureRedisPassword failed: %v", err)
+	}
+	if configured.RedisPassword != "secret" {
+		t.Errorf("Expected the configured password to win, got %q", configured.RedisPassword)
+	}
+}
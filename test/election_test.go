@@ -1,11 +1,18 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/metazla/meta-core/internal/config"
 	"github.com/metazla/meta-core/internal/leader"
 )
 
@@ -17,6 +24,7 @@ func TestLeaderLockInfoJSON(t *testing.T) {
 		BaseURL:   "http://localhost:8180",
 		Timestamp: 1704067200000,
 		PID:       12345,
+		Epoch:     7,
 	}
 
 	// Marshal to JSON
@@ -56,6 +64,10 @@ func TestLeaderLockInfoJSON(t *testing.T) {
 	if _, ok := parsed["pid"].(float64); !ok {
 		t.Errorf("Expected pid to be a number, got %T", parsed["pid"])
 	}
+
+	if parsed["epoch"] != float64(7) {
+		t.Errorf("Expected epoch 7, got '%v'", parsed["epoch"])
+	}
 }
 
 func TestLeaderLockInfoJSONOmitEmpty(t *testing.T) {
@@ -142,3 +154,225 @@ func TestLeaderInfoFileFormat(t *testing.T) {
 		t.Errorf("PID mismatch: expected %d, got %d", info.PID, parsed.PID)
 	}
 }
+
+func TestFollowerTakesOverWhenLeaderDies(t *testing.T) {
+	if _, err := exec.LookPath("redis-server"); err != nil {
+		t.Skip("redis-server not found in PATH")
+	}
+
+	for _, backend := range []string{leader.LockBackendFlock, leader.LockBackendLease} {
+		t.Run(backend, func(t *testing.T) {
+			testFollowerTakeover(t, backend)
+		})
+	}
+}
+
+func testFollowerTakeover(t *testing.T, backend string) {
+	tmpDir, err := os.MkdirTemp("", "meta-core-election")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			MetaCorePath:           tmpDir,
+			RedisBind:              "127.0.0.1",
+			RedisPort:              freePort(t),
+			APIPort:                8180,
+			LockBackend:            backend,
+			LockLeaseTTLMS:         1000,
+			HealthCheckIntervalMS:  100,
+			LeaderStaleThresholdMS: 1000,
+		}
+	}
+
+	first := leader.NewElection(newConfig())
+	if err := first.Start(); err != nil {
+		t.Fatalf("Failed to start first election: %v", err)
+	}
+	if !first.IsLeader() {
+		first.Stop()
+		t.Fatal("Expected first instance to become leader")
+	}
+
+	secondCfg := newConfig()
+	second := leader.NewElection(secondCfg)
+	if err := second.Start(); err != nil {
+		first.Stop()
+		t.Fatalf("Failed to start second election: %v", err)
+	}
+	defer second.Stop()
+
+	if second.Role() != leader.RoleFollower {
+		first.Stop()
+		t.Fatalf("Expected second instance to be follower, got %s", second.Role())
+	}
+
+	events := make(chan leader.LeadershipEvent, 16)
+	second.Subscribe(func(event leader.LeadershipEvent) {
+		events <- event
+	})
+
+	// Kill the leader: its lock is released and Redis goes away
+	if err := first.Stop(); err != nil {
+		t.Fatalf("Failed to stop leader: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !second.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("Follower did not take over leadership in time")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	info := second.LeaderInfo()
+	if info == nil {
+		t.Fatal("Expected leader info after takeover")
+	}
+
+	if !strings.HasSuffix(info.API, ":"+strconv.Itoa(secondCfg.RedisPort)) {
+		t.Errorf("Expected leader API to use port %d, got %s", secondCfg.RedisPort, info.API)
+	}
+
+	// The takeover is published as a leadership event
+	for {
+		select {
+		case event := <-events:
+			if event.Type != leader.EventBecameLeader {
+				continue
+			}
+			if event.OldLeader == nil || event.OldLeader.Epoch >= event.Epoch {
+				t.Errorf("Expected old leader with a lower epoch, got %+v", event.OldLeader)
+			}
+			if event.NewLeader == nil || event.Epoch != info.Epoch {
+				t.Errorf("Expected new leader with epoch %d, got %+v", info.Epoch, event.NewLeader)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected a became-leader event")
+		}
+	}
+}
+
+// freePort returns a TCP port that is currently free on localhost
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestStepDownHandsOverLeadership(t *testing.T) {
+	if _, err := exec.LookPath("redis-server"); err != nil {
+		t.Skip("redis-server not found in PATH")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "meta-core-stepdown")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			MetaCorePath:           tmpDir,
+			RedisBind:              "127.0.0.1",
+			RedisPort:              freePort(t),
+			APIPort:                8180,
+			HealthCheckIntervalMS:  100,
+			LeaderStaleThresholdMS: 1000,
+		}
+	}
+
+	first := leader.NewElection(newConfig())
+	if err := first.Start(); err != nil {
+		t.Fatalf("Failed to start first election: %v", err)
+	}
+	defer first.Stop()
+
+	second := leader.NewElection(newConfig())
+	if err := second.Start(); err != nil {
+		t.Fatalf("Failed to start second election: %v", err)
+	}
+	defer second.Stop()
+
+	oldEpoch := first.LeaderInfo().Epoch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := first.StepDown(ctx)
+	if err != nil {
+		t.Fatalf("StepDown failed: %v", err)
+	}
+
+	if info.Epoch <= oldEpoch {
+		t.Errorf("Expected new epoch greater than %d, got %d", oldEpoch, info.Epoch)
+	}
+
+	if !second.IsLeader() {
+		t.Error("Expected second instance to be leader after step-down")
+	}
+
+	if first.IsLeader() {
+		t.Error("Expected first instance to no longer be leader")
+	}
+
+	// Stepping down again is not allowed from a follower
+	if _, err := first.StepDown(ctx); err != leader.ErrNotLeader {
+		t.Errorf("Expected ErrNotLeader, got %v", err)
+	}
+}
+
+func TestLeaderStepsDownWhenRedisCrashLoops(t *testing.T) {
+	if _, err := exec.LookPath("redis-server"); err != nil {
+		t.Skip("redis-server not found in PATH")
+	}
+
+	cfg := &config.Config{
+		MetaCorePath:             t.TempDir(),
+		RedisBind:                "127.0.0.1",
+		RedisPort:                freePort(t),
+		APIPort:                  8180,
+		HealthCheckIntervalMS:    50,
+		LeaderStaleThresholdMS:   1000,
+		RedisRestartBackoffMS:    50,
+		RedisRestartBackoffMaxMS: 5000,
+		RedisCrashThreshold:      2,
+		RedisCrashWindowMS:       60000,
+	}
+
+	election := leader.NewElection(cfg)
+	if err := election.Start(); err != nil {
+		t.Fatalf("Failed to start election: %v", err)
+	}
+	defer election.Stop()
+
+	// Kill redis-server until the crash threshold is reached
+	deadline := time.Now().Add(10 * time.Second)
+	for election.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("Leader did not step down after repeated Redis crashes")
+		}
+		if status := election.RedisStatus(); status.Running && status.PID > 0 {
+			if process, err := os.FindProcess(status.PID); err == nil {
+				process.Kill()
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	status := election.RedisStatus()
+	if status.TotalCrashes < 2 {
+		t.Errorf("Expected at least 2 crashes, got %d", status.TotalCrashes)
+	}
+
+	if status.LastExit == nil || !strings.Contains(status.LastExit.Error, "killed") {
+		t.Errorf("Expected last exit to report the kill, got %+v", status.LastExit)
+	}
+}
@@ -0,0 +1,289 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// startEmbedded starts an embedded server on a random local port
+func startEmbedded(t *testing.T, opts embedded.Options) *embedded.Server {
+	t.Helper()
+
+	opts.Addr = "127.0.0.1:0"
+	server := embedded.NewServer(opts)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start embedded server: %v", err)
+	}
+	return server
+}
+
+func TestEmbeddedStorage(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := storage.NewClient("")
+	if err := client.Connect("redis://" + server.Addr()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	var store storage.Store = client
+
+	if err := store.SetMetadataFlat("midhash256:abc", map[string]string{"title": "Movie", "year": "2024"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if _, err := store.MergeMetadataFlat("midhash256:abc", map[string]string{"year": "2025"}); err != nil {
+		t.Fatalf("MergeMetadataFlat failed: %v", err)
+	}
+
+	metadata, err := store.GetMetadataFlat("midhash256:abc")
+	if err != nil {
+		t.Fatalf("GetMetadataFlat failed: %v", err)
+	}
+	if metadata["title"] != "Movie" || metadata["year"] != "2025" {
+		t.Errorf("Unexpected metadata: %v", metadata)
+	}
+
+	for _, genre := range []string{"drama", "comedy", "drama"} {
+		if _, err := store.AddToSet("midhash256:abc", "genres", genre); err != nil {
+			t.Fatalf("AddToSet failed: %v", err)
+		}
+	}
+	if genres, _ := store.GetProperty("midhash256:abc", "genres"); genres != "drama|comedy" {
+		t.Errorf("Expected genres 'drama|comedy', got '%s'", genres)
+	}
+
+	if count, _ := store.CountFiles(); count != 1 {
+		t.Errorf("Expected 1 file, got %d", count)
+	}
+
+	deleted, err := store.DeleteMetadata("midhash256:abc")
+	if err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted fields, got %d", deleted)
+	}
+	if count, _ := store.CountFiles(); count != 0 {
+		t.Errorf("Expected 0 files after delete, got %d", count)
+	}
+}
+
+func TestEmbeddedEpochFencing(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	stale := storage.NewClient("")
+	if err := stale.Connect("redis://" + server.Addr()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer stale.Close()
+
+	if err := stale.GetRedisClient().Set(context.Background(), storage.EpochKey, 5, 0).Err(); err != nil {
+		t.Fatalf("Failed to set epoch: %v", err)
+	}
+
+	stale.SetEpoch(4)
+	if err := stale.SetProperty("midhash256:abc", "title", "Movie"); err == nil {
+		t.Error("Expected write with stale epoch to be rejected")
+	}
+
+	stale.SetEpoch(5)
+	if err := stale.SetProperty("midhash256:abc", "title", "Movie"); err != nil {
+		t.Errorf("Expected write with current epoch to succeed, got %v", err)
+	}
+}
+
+func TestEmbeddedPersistence(t *testing.T) {
+	opts := embedded.Options{
+		Password:     "secret",
+		SnapshotPath: filepath.Join(t.TempDir(), "embedded.snapshot"),
+	}
+
+	server := startEmbedded(t, opts)
+	client := storage.NewClient("")
+	client.SetCredentials("", "secret")
+	if err := client.Connect("redis://" + server.Addr()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if err := client.SetProperty("midhash256:abc", "title", "Movie"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	client.Close()
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Failed to close server: %v", err)
+	}
+
+	// A restarted server loads the snapshot written on close
+	server = startEmbedded(t, opts)
+	defer server.Close()
+
+	unauthenticated := storage.NewClient("")
+	if err := unauthenticated.Connect("redis://" + server.Addr()); err == nil {
+		t.Error("Expected connection without password to fail")
+	}
+	unauthenticated.Close()
+
+	client = storage.NewClient("")
+	client.SetCredentials("", "secret")
+	if err := client.Connect("redis://" + server.Addr()); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer client.Close()
+
+	if title, _ := client.GetProperty("midhash256:abc", "title"); title != "Movie" {
+		t.Errorf("Expected title 'Movie' after restart, got '%s'", title)
+	}
+	if hashIDs, _ := client.GetAllHashIDs(); len(hashIDs) != 1 {
+		t.Errorf("Expected 1 file after restart, got %v", hashIDs)
+	}
+}
+
+func TestEmbeddedLeaderTakeover(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			MetaCorePath:           tmpDir,
+			RedisMode:              leader.RedisModeEmbedded,
+			RedisBind:              "127.0.0.1",
+			RedisPort:              freePort(t),
+			APIPort:                8180,
+			LockBackend:            leader.LockBackendFlock,
+			HealthCheckIntervalMS:  100,
+			LeaderStaleThresholdMS: 1000,
+		}
+	}
+
+	first := leader.NewElection(newConfig())
+	firstStore := storage.NewClient("")
+	first.SetStorageConnector(firstStore)
+	if err := first.Start(); err != nil {
+		t.Fatalf("Failed to start first election: %v", err)
+	}
+	if !first.IsLeader() {
+		first.Stop()
+		t.Fatal("Expected first instance to become leader")
+	}
+	if status := first.RedisStatus(); status.Mode != "embedded" {
+		t.Errorf("Expected embedded Redis mode, got '%s'", status.Mode)
+	}
+
+	if err := firstStore.SetProperty("midhash256:abc", "title", "Movie"); err != nil {
+		first.Stop()
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+
+	second := leader.NewElection(newConfig())
+	secondStore := storage.NewClient("")
+	second.SetStorageConnector(secondStore)
+	if err := second.Start(); err != nil {
+		first.Stop()
+		t.Fatalf("Failed to start second election: %v", err)
+	}
+	defer second.Stop()
+
+	// The leader snapshots its keyspace to the shared volume on stop
+	if err := first.Stop(); err != nil {
+		t.Fatalf("Failed to stop leader: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !second.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatal("Follower did not take over leadership in time")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if title, err := secondStore.GetProperty("midhash256:abc", "title"); err != nil || title != "Movie" {
+		t.Errorf("Expected title 'Movie' after takeover, got '%s' (%v)", title, err)
+	}
+}
+
+func TestEmbeddedStepDownHandsOverLeadership(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func() *config.Config {
+		return &config.Config{
+			MetaCorePath:           tmpDir,
+			RedisMode:              leader.RedisModeEmbedded,
+			RedisBind:              "127.0.0.1",
+			RedisPort:              freePort(t),
+			APIPort:                8180,
+			LockBackend:            leader.LockBackendFlock,
+			HealthCheckIntervalMS:  100,
+			LeaderStaleThresholdMS: 1000,
+		}
+	}
+
+	first := leader.NewElection(newConfig())
+	firstStore := storage.NewClient("")
+	first.SetStorageConnector(firstStore)
+	if err := first.Start(); err != nil {
+		t.Fatalf("Failed to start first election: %v", err)
+	}
+	defer first.Stop()
+
+	if err := firstStore.SetProperty("midhash256:abc", "title", "Movie"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+
+	second := leader.NewElection(newConfig())
+	secondStore := storage.NewClient("")
+	second.SetStorageConnector(secondStore)
+	if err := second.Start(); err != nil {
+		t.Fatalf("Failed to start second election: %v", err)
+	}
+	defer second.Stop()
+
+	oldEpoch := first.LeaderInfo().Epoch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := first.StepDown(ctx)
+	if err != nil {
+		t.Fatalf("StepDown failed: %v", err)
+	}
+	if info.Epoch <= oldEpoch {
+		t.Errorf("Expected new epoch greater than %d, got %d", oldEpoch, info.Epoch)
+	}
+	if !second.IsLeader() {
+		t.Error("Expected second instance to be leader after step-down")
+	}
+	if first.IsLeader() {
+		t.Error("Expected first instance to no longer be leader")
+	}
+
+	// The new leader serves the keyspace the old one snapshotted, to both
+	if title, err := secondStore.GetProperty("midhash256:abc", "title"); err != nil || title != "Movie" {
+		t.Errorf("Expected title 'Movie' on the new leader, got '%s' (%v)", title, err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		title, err := firstStore.GetProperty("midhash256:abc", "title")
+		if err == nil && title == "Movie" && firstStore.SetProperty("midhash256:abc", "year", "1999") == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Old leader's store did not follow the new leader (%q, %v)", title, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if year, _ := secondStore.GetProperty("midhash256:abc", "year"); year != "1999" {
+		t.Errorf("Expected a write through the old leader to reach the new one, got %q", year)
+	}
+
+	if _, err := first.StepDown(ctx); err != leader.ErrNotLeader {
+		t.Errorf("Expected ErrNotLeader, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/api"
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+// newAPI returns the router of an API server backed by client
+func newAPI(t *testing.T, client *storage.Client) http.Handler {
+	t.Helper()
+
+	cfg := &config.Config{
+		MetaCorePath: t.TempDir(),
+		MountsDir:    t.TempDir(),
+		FilesPath:    t.TempDir(),
+	}
+	return api.NewServer(cfg, leader.NewElection(cfg), nil, client).Handler()
+}
+
+func TestIfMatchPropertyRoutes(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	handler := newAPI(t, client)
+
+	routes := []struct {
+		method, path, body string
+		property, want     string // Value of property after the write
+	}{
+		{"PUT", "/meta/a/title", "New Title", "title", "New Title"},
+		{"DELETE", "/meta/a/title", "", "title", ""},
+		{"POST", "/meta/a/_add/genre", "Comedy", "genre", "Drama|Comedy"},
+		{"POST", "/meta/a/_remove/genre", "Drama", "genre", ""},
+		{"PUT", "/api/metadata/a/property", `{"property":"year","value":"2024"}`, "year", "2024"},
+	}
+
+	for _, route := range routes {
+		client.SetMetadataFlat("a", map[string]string{"title": "Movie", "genre": "Drama", "year": "1999"})
+		_, revision, err := client.GetMetadataRevision("a")
+		if err != nil {
+			t.Fatalf("GetMetadataRevision failed: %v", err)
+		}
+		before, _ := client.GetProperty("a", route.property)
+
+		send := func(ifMatch string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+			req.Header.Set("If-Match", ifMatch)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// A stale ETag is refused and leaves the value alone
+		rr := send(`"0"`)
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s %s with a stale ETag: expected 412, got %d", route.method, route.path, rr.Code)
+		}
+		if got := rr.Header().Get("ETag"); got != formatRevision(revision) {
+			t.Errorf("%s %s: expected the current ETag %s on 412, got %s", route.method, route.path, formatRevision(revision), got)
+		}
+		if value, _ := client.GetProperty("a", route.property); value != before {
+			t.Errorf("%s %s: expected a refused write to keep %q, got %q", route.method, route.path, before, value)
+		}
+
+		// The current ETag lets the write through and returns the new one
+		rr = send(formatRevision(revision))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s %s with the current ETag: expected 200, got %d (%s)", route.method, route.path, rr.Code, rr.Body)
+		}
+		if got := rr.Header().Get("ETag"); got != formatRevision(revision+1) {
+			t.Errorf("%s %s: expected ETag %s, got %s", route.method, route.path, formatRevision(revision+1), got)
+		}
+		if value, _ := client.GetProperty("a", route.property); value != route.want {
+			t.Errorf("%s %s: expected %q, got %q", route.method, route.path, route.want, value)
+		}
+	}
+}
+
+// formatRevision returns the ETag of a revision
+func formatRevision(revision int64) string {
+	return `"` + strconv.FormatInt(revision, 10) + `"`
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/fulltext"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFullTextAnalyzer(t *testing.T) {
+	terms := fulltext.Terms("The Amélie Chronicles: Running with Wolves")
+	want := []string{"ameli", "chronicl", "run", "wolv"}
+	if len(terms) != len(want) {
+		t.Fatalf("Expected terms %v, got %v", want, terms)
+	}
+	for i := range want {
+		if terms[i] != want[i] {
+			t.Errorf("Term %d: expected %s, got %s", i, want[i], terms[i])
+		}
+	}
+
+	if d := fulltext.Distance("matrix", "matirx", 2); d != 2 {
+		t.Errorf("Expected distance 2, got %d", d)
+	}
+	if d := fulltext.Distance("matrix", "reloaded", 2); d != 3 {
+		t.Errorf("Expected distance beyond limit (3), got %d", d)
+	}
+
+	highlighted, ok := fulltext.Highlight("Amélie & the <Cities>", map[string]bool{"ameli": true, "citi": true})
+	if !ok || highlighted != "<mark>Amélie</mark> &amp; the &lt;<mark>Cities</mark>&gt;" {
+		t.Errorf("Unexpected highlight: %q", highlighted)
+	}
+}
+
+func TestStemPlurals(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"movies", "movie"},
+		{"series", "series"},
+		{"news", "news"},
+		{"boxes", "box"},
+		{"buses", "bus"},
+		{"heroes", "hero"},
+		{"stories", "story"},
+		{"classes", "class"},
+		{"games", "game"},
+		{"cities", "city"},
+		{"days", "day"},
+		{"ties", "tie"},
+		{"waitresses", "waitress"},
+	} {
+		plural, singular := fulltext.Stem(pair[0]), fulltext.Stem(pair[1])
+		if plural != singular {
+			t.Errorf("Stem(%q) = %q, Stem(%q) = %q", pair[0], plural, pair[1], singular)
+		}
+	}
+
+	// Words ending in s that are not plurals keep it
+	for _, word := range []string{"news", "series", "bus", "gas", "this", "analysis"} {
+		if stem := fulltext.Stem(word); stem != word {
+			t.Errorf("Stem(%q) = %q, want it unchanged", word, stem)
+		}
+	}
+}
+
+func TestFullTextSearch(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	files := map[string]map[string]string{
+		"a": {"title": "The Matrix", "plot": "A hacker learns the truth about reality."},
+		"b": {"title": "Matrix Reloaded", "plot": "Neo and the rebels fight the machines."},
+		"c": {"title": "Le Fabuleux Destin d'Amélie Poulain", "plot": "A shy waitress decides to change lives."},
+		"d": {"title": "Hackers", "plot": "Teenage hackers uncover a matrix of fraud."},
+		"e": {"title": "Short Movies", "plot": "Heroes on buses."},
+	}
+	for hashID, metadata := range files {
+		if err := client.SetMetadataFlat(hashID, metadata); err != nil {
+			t.Fatalf("SetMetadataFlat failed: %v", err)
+		}
+	}
+
+	hits, err := client.FullTextSearch("matrix")
+	if err != nil {
+		t.Fatalf("FullTextSearch failed: %v", err)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("Expected 3 hits, got %+v", hits)
+	}
+	// A title match outranks a plot match
+	if hits[2].HashID != "d" {
+		t.Errorf("Expected plot-only match last, got %+v", hits)
+	}
+
+	// Accents are folded, plurals are stemmed and typos are tolerated
+	for query, want := range map[string]string{
+		"amelie":          "c",
+		"hacker":          "d",
+		"movie":           "e",
+		"hero bus":        "e",
+		"waitresses":      "c",
+		"reloded":         "b",
+		"matrix reloaded": "b",
+	} {
+		hits, err := client.FullTextSearch(query)
+		if err != nil {
+			t.Fatalf("FullTextSearch(%q) failed: %v", query, err)
+		}
+		if len(hits) == 0 || hits[0].HashID != want {
+			t.Errorf("%q: expected %s first, got %+v", query, want, hits)
+		}
+	}
+
+	// Updates replace the file's terms
+	if err := client.SetProperty("c", "title", "Amelie"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	if hits, _ := client.FullTextSearch("poulain"); len(hits) != 0 {
+		t.Errorf("Expected no hits for a removed word, got %+v", hits)
+	}
+
+	// Terms no file has left leave the vocabulary of their length
+	raw := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer raw.Close()
+	terms, err := raw.ZRangeByLex(context.Background(), "idx:fts-vocab:7", &redis.ZRangeBy{Min: "-", Max: "+"}).Result()
+	expectIDs(t, "7-letter terms", terms, err, "realiti", "uncover")
+	if hits, _ := client.FullTextSearch("poulin"); len(hits) != 0 {
+		t.Errorf("Expected no fuzzy hits for a removed word, got %+v", hits)
+	}
+}
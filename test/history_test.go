@@ -0,0 +1,194 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestHistory(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	sorter := client.WithSource("meta-sort")
+	if err := sorter.SetMetadataFlat("a", map[string]string{"title": "Movie", "year": "1999"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if err := client.SetProperty("a", "title", "Edited"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	if err := sorter.DeleteProperty("a", "year"); err != nil {
+		t.Fatalf("DeleteProperty failed: %v", err)
+	}
+	// Writes that change nothing are not recorded
+	if err := sorter.SetProperty("a", "title", "Edited"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+
+	entries, next, err := client.History("a", "", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 3 || next != "" {
+		t.Fatalf("Expected 3 entries on one page, got %d (next %q)", len(entries), next)
+	}
+
+	// Newest first, with the source and old and new values
+	latest := entries[0]
+	if latest.Op != "unset" || latest.Revision != 3 || latest.Source != "meta-sort" {
+		t.Errorf("Unexpected latest entry: %+v", latest)
+	}
+	if len(latest.Changes) != 1 || latest.Changes[0].Property != "year" ||
+		latest.Changes[0].Old == nil || *latest.Changes[0].Old != "1999" || latest.Changes[0].New != nil {
+		t.Errorf("Unexpected changes of unset: %+v", latest.Changes)
+	}
+	edit := entries[1]
+	if edit.Source != "" || len(edit.Changes) != 1 || *edit.Changes[0].Old != "Movie" || *edit.Changes[0].New != "Edited" {
+		t.Errorf("Unexpected edit entry: %+v", edit)
+	}
+	if entries[2].Time.IsZero() {
+		t.Error("Expected entries to carry their time")
+	}
+
+	// Paging continues after the cursor
+	page, next, err := client.History("a", "", 2)
+	if err != nil || len(page) != 2 || next != page[1].ID {
+		t.Fatalf("Expected a first page of 2, got %d (next %q, %v)", len(page), next, err)
+	}
+	page, next, err = client.History("a", next, 2)
+	if err != nil || len(page) != 1 || page[0].Revision != 1 || next != "" {
+		t.Fatalf("Expected the last page to hold revision 1, got %+v (next %q, %v)", page, next, err)
+	}
+
+	// Revert restores the metadata as a new revision
+	revision, err := sorter.RevertToRevision("a", 1)
+	if err != nil {
+		t.Fatalf("RevertToRevision failed: %v", err)
+	}
+	metadata, current, err := client.GetMetadataRevision("a")
+	if err != nil {
+		t.Fatalf("GetMetadataRevision failed: %v", err)
+	}
+	if revision != 4 || current != 4 || metadata["title"] != "Movie" || metadata["year"] != "1999" {
+		t.Errorf("Expected revision 4 with the original metadata, got %d/%d %v", revision, current, metadata)
+	}
+	if ids, _ := client.FindByProperty("year", "1999"); len(ids) != 1 {
+		t.Errorf("Expected revert to restore the index, got %v", ids)
+	}
+	if entries, _, _ := client.History("a", "", 1); entries[0].Op != "revert" || entries[0].Source != "meta-sort" {
+		t.Errorf("Expected revert to be recorded, got %+v", entries[0])
+	}
+
+	if _, err := client.RevertToRevision("a", 9); !errors.Is(err, storage.ErrRevisionMismatch) {
+		t.Errorf("Expected ErrRevisionMismatch for a future revision, got %v", err)
+	}
+
+	// The global history holds every file and clears
+	if err := client.SetProperty("b", "title", "Other"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	if _, err := client.ClearAllMetadata(); err != nil {
+		t.Fatalf("ClearAllMetadata failed: %v", err)
+	}
+	global, _, err := client.History("", "", 100)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(global) != 6 || global[0].Op != "clear" || global[0].Files != 2 || global[1].HashID != "b" {
+		t.Errorf("Unexpected global history: %+v", global)
+	}
+
+	// A clear is recorded per file too, so it can be reverted
+	if entries, _, _ := client.History("a", "", 1); len(entries) != 1 || entries[0].Op != "clear" || entries[0].Revision != 5 {
+		t.Fatalf("Expected the clear in the history of a, got %+v", entries)
+	}
+	revision, err = client.RevertToRevision("a", 4)
+	if err != nil {
+		t.Fatalf("RevertToRevision across a clear failed: %v", err)
+	}
+	metadata, _ = client.GetMetadataFlat("a")
+	if revision != 6 || metadata["title"] != "Movie" || metadata["year"] != "1999" {
+		t.Errorf("Expected revision 6 with the metadata before the clear, got %d %v", revision, metadata)
+	}
+	if ids, _ := client.FindByProperty("year", "1999"); len(ids) != 1 {
+		t.Errorf("Expected revert across a clear to restore the index, got %v", ids)
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	client.SetHistoryLimits(3, 0)
+
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		if err := client.SetProperty("a", "title", title); err != nil {
+			t.Fatalf("SetProperty failed: %v", err)
+		}
+	}
+
+	entries, _, err := client.History("a", "", 10)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 3 || entries[2].Revision != 3 {
+		t.Errorf("Expected the 3 newest entries, got %+v", entries)
+	}
+	if global, _, _ := client.History("", "", 10); len(global) != 0 {
+		t.Errorf("Expected no global history when disabled, got %d entries", len(global))
+	}
+
+	// Revisions still in the history can be restored, older ones cannot
+	if _, err := client.RevertToRevision("a", 2); err != nil {
+		t.Errorf("RevertToRevision failed: %v", err)
+	}
+	if title, _ := client.GetProperty("a", "title"); title != "two" {
+		t.Errorf("Expected title two after revert, got %q", title)
+	}
+	if _, err := client.RevertToRevision("a", 1); !errors.Is(err, storage.ErrHistoryTrimmed) {
+		t.Errorf("Expected ErrHistoryTrimmed, got %v", err)
+	}
+}
+
+func TestClearStopsOnFailure(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	client.SetMetadataFlat("a", map[string]string{"title": "Movie", "year": "1999"})
+	client.SetMetadataFlat("b", map[string]string{"title": "Other", "year": "1999"})
+
+	// A file key of the wrong type fails its batch
+	ctx := context.Background()
+	client.GetRedisClient().Set(ctx, "file:broken", "not a hash", 0)
+	client.GetRedisClient().SAdd(ctx, "file:__index__", "broken")
+
+	if _, err := client.ClearAllMetadata(); err == nil {
+		t.Fatal("Expected ClearAllMetadata to fail")
+	}
+
+	// Files not deleted stay reachable through every index
+	ids, err := client.GetAllHashIDs()
+	expectIDs(t, "GetAllHashIDs", ids, err, "a", "b", "broken")
+	ids, err = client.FindByProperty("year", "1999")
+	expectIDs(t, "FindByProperty", ids, err, "a", "b")
+	if global, _, _ := client.History("", "", 1); len(global) == 1 && global[0].Op == "clear" {
+		t.Error("Expected a failed clear not to be recorded as a clear")
+	}
+}
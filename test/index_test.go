@@ -0,0 +1,268 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// connectIndexed connects a storage client with type, year and genre indexes
+func connectIndexed(t *testing.T, server *embedded.Server) *storage.Client {
+	t.Helper()
+
+	client := storage.NewClient("")
+	client.SetIndexedFields([]string{"type", "year", "genre"})
+	if err := client.Connect("redis://" + server.Addr()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return client
+}
+
+func expectIDs(t *testing.T, what string, got []string, err error, want ...string) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s failed: %v", what, err)
+	}
+	sort.Strings(got)
+	if want == nil {
+		want = []string{}
+	}
+	if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+		t.Errorf("%s: expected %v, got %v", what, want, got)
+	}
+}
+
+func TestSecondaryIndexes(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	// Data written before the indexes exist is only searchable after a rebuild
+	if err := client.SetMetadataFlat("a", map[string]string{"type": "Movie", "year": "2024", "title": "The Matrix"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if _, err := client.FindByProperty("type", "movie"); !errors.Is(err, storage.ErrNotIndexed) {
+		t.Fatalf("Expected ErrNotIndexed before rebuild, got %v", err)
+	}
+
+	indexed, err := client.RebuildIndexes()
+	if err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+	if indexed != 1 {
+		t.Errorf("Expected 1 indexed file, got %d", indexed)
+	}
+
+	if err := client.SetMetadataFlat("b", map[string]string{"type": "episode", "year": "2024", "title": "Matrix Reloaded: Making Of"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	if _, err := client.AddToSet("b", "genre", "Documentary"); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+	if _, err := client.AddToSet("b", "genre", "Sci-Fi"); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+
+	ids, err := client.FindByProperty("type", "MOVIE")
+	expectIDs(t, "type=movie", ids, err, "a")
+	ids, err = client.FindByProperty("year", "2024")
+	expectIDs(t, "year=2024", ids, err, "a", "b")
+	ids, err = client.FindByProperty("genre", "sci-fi")
+	expectIDs(t, "genre=sci-fi", ids, err, "b")
+	ids, err = client.SearchText("matrix")
+	expectIDs(t, "text matrix", ids, err, "a", "b")
+	ids, err = client.SearchText("MATRIX reloaded")
+	expectIDs(t, "text matrix reloaded", ids, err, "b")
+
+	if _, err := client.FindByProperty("fileName", "x"); !errors.Is(err, storage.ErrNotIndexed) {
+		t.Errorf("Expected ErrNotIndexed for unindexed property, got %v", err)
+	}
+
+	// Updates move files between index entries
+	if err := client.SetProperty("a", "year", "1999"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	ids, err = client.FindByProperty("year", "2024")
+	expectIDs(t, "year=2024 after update", ids, err, "b")
+	ids, err = client.FindByProperty("year", "1999")
+	expectIDs(t, "year=1999 after update", ids, err, "a")
+
+	if _, err := client.RemoveFromSet("b", "genre", "Sci-Fi"); err != nil {
+		t.Fatalf("RemoveFromSet failed: %v", err)
+	}
+	ids, err = client.FindByProperty("genre", "sci-fi")
+	expectIDs(t, "genre=sci-fi after remove", ids, err)
+
+	if err := client.DeleteProperty("a", "title"); err != nil {
+		t.Fatalf("DeleteProperty failed: %v", err)
+	}
+	ids, err = client.SearchText("matrix")
+	expectIDs(t, "text matrix after delete property", ids, err, "b")
+
+	if _, err := client.DeleteMetadata("b"); err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+	ids, err = client.SearchText("matrix")
+	expectIDs(t, "text matrix after delete", ids, err)
+	ids, err = client.FindByProperty("genre", "documentary")
+	expectIDs(t, "genre=documentary after delete", ids, err)
+}
+
+func TestPrefixSearch(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	client.SetMetadataFlat("midhash256:ab12", map[string]string{"title": "The Matrix Reloaded", "genre": "Sci-Fi|Documentary"})
+	client.SetMetadataFlat("midhash256:cd34", map[string]string{"title": "Matrimony", "genre": "Drama"})
+
+	// Every query word is matched as the start of a word
+	ids, err := client.SearchText("matr")
+	expectIDs(t, "text matr", ids, err, "midhash256:ab12", "midhash256:cd34")
+	ids, err = client.SearchText("MATRI")
+	expectIDs(t, "text matri", ids, err, "midhash256:ab12", "midhash256:cd34")
+	ids, err = client.SearchText("matrix rel")
+	expectIDs(t, "text matrix rel", ids, err, "midhash256:ab12")
+	ids, err = client.SearchText("atrix")
+	expectIDs(t, "text atrix", ids, err)
+	ids, err = client.SearchText("matrixes")
+	expectIDs(t, "text matrixes", ids, err)
+
+	ids, err = client.FindByPropertyPrefix("genre", "SCI")
+	expectIDs(t, "genre^=sci", ids, err, "midhash256:ab12")
+	ids, err = client.FindByPropertyPrefix("genre", "d")
+	expectIDs(t, "genre^=d", ids, err, "midhash256:ab12", "midhash256:cd34")
+	ids, err = client.FindByProperty("genre", "d")
+	expectIDs(t, "genre=d", ids, err)
+
+	ids, err = client.FindHashIDsByPrefix("midhash256:ab")
+	expectIDs(t, "hash ID prefix", ids, err, "midhash256:ab12")
+
+	// Words a write removes stop matching
+	client.SetProperty("midhash256:cd34", "title", "Marriage")
+	ids, err = client.SearchText("matr")
+	expectIDs(t, "text matr after update", ids, err, "midhash256:ab12")
+	ids, err = client.SearchText("mar")
+	expectIDs(t, "text mar after update", ids, err, "midhash256:cd34")
+
+	// and leave the vocabulary once no file has them
+	raw := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer raw.Close()
+	tokens, err := raw.ZRangeByLex(context.Background(), "idx:tokens", &redis.ZRangeBy{Min: "-", Max: "+"}).Result()
+	expectIDs(t, "token vocabulary", tokens, err, "marriage", "matrix", "reloaded", "the")
+}
+
+func TestRebuildDuringWrites(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	var all, updated []string
+	for i := 0; i < 3000; i++ {
+		id := fmt.Sprintf("f%04d", i)
+		all = append(all, id)
+		if i%10 == 0 {
+			updated = append(updated, id)
+		}
+		if err := client.SetMetadataFlat(id, map[string]string{"title": "original"}); err != nil {
+			t.Fatalf("SetMetadataFlat failed: %v", err)
+		}
+	}
+
+	// Writes and reads go on while the rebuild runs
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := client.RebuildIndexes(); err != nil {
+			t.Errorf("RebuildIndexes failed: %v", err)
+		}
+	}()
+	for _, id := range updated {
+		if err := client.SetProperty(id, "title", "updated"); err != nil {
+			t.Fatalf("SetProperty failed: %v", err)
+		}
+		if _, err := client.GetMetadataFlat(id); err != nil {
+			t.Fatalf("GetMetadataFlat failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	// Every write is reflected, whether it landed before, during or after
+	// the file's batch
+	ids, err := client.SearchText("updated")
+	expectIDs(t, "text updated", ids, err, updated...)
+	ids, err = client.SearchText("original")
+	if err != nil || len(ids) != len(all)-len(updated) {
+		t.Errorf("Expected %d files titled original, got %d (%v)", len(all)-len(updated), len(ids), err)
+	}
+}
+
+func TestListHashIDsCursor(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	for _, id := range []string{"c", "a", "e"} {
+		if err := client.SetMetadataFlat(id, map[string]string{"title": id}); err != nil {
+			t.Fatalf("SetMetadataFlat failed: %v", err)
+		}
+	}
+
+	expectPage := func(what, cursor string, limit int, wantNext string, want ...string) {
+		t.Helper()
+		page, next, err := client.ListHashIDs(cursor, limit)
+		if err != nil {
+			t.Fatalf("%s: ListHashIDs failed: %v", what, err)
+		}
+		if want == nil {
+			want = []string{}
+		}
+		if !reflect.DeepEqual(page, want) || next != wantNext {
+			t.Errorf("%s: expected %v (next %q), got %v (next %q)", what, want, wantNext, page, next)
+		}
+	}
+
+	// Before the sorted index is built, the file set is sorted in memory
+	expectPage("unindexed first page", "", 2, "c", "a", "c")
+
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+	expectPage("first page", "", 2, "c", "a", "c")
+
+	// Files added before the cursor do not shift the next page
+	for _, id := range []string{"b", "d"} {
+		if err := client.SetMetadataFlat(id, map[string]string{"title": id}); err != nil {
+			t.Fatalf("SetMetadataFlat failed: %v", err)
+		}
+	}
+	expectPage("second page", "c", 2, "", "d", "e")
+
+	if _, err := client.DeleteMetadata("d"); err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+	expectPage("after delete", "c", 2, "", "e")
+	expectPage("whole list", "", 10, "", "a", "b", "c", "e")
+	expectPage("past the end", "e", 10, "")
+}
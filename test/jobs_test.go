@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/jobs"
+)
+
+// helloWorldCID is the raw-leaf CID `ipfs add --cid-version 1` gives "hello world"
+const helloWorldCID = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+
+// waitForJob polls a job until it finishes
+func waitForJob(t *testing.T, manager *jobs.Manager, id string) *jobs.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := manager.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.Status == jobs.StatusCompleted || job.Status == jobs.StatusFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return nil
+}
+
+func TestCIDJobs(t *testing.T) {
+	cfg := &config.Config{FilesPath: t.TempDir()}
+	path := filepath.Join(cfg.FilesPath, "movies", "hello.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	manager := jobs.NewManager(cfg)
+	manager.Start()
+	defer manager.Stop()
+
+	job, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movies/hello.txt", Digests: []string{"MD5"}})
+	if err != nil {
+		t.Fatalf("SubmitCID failed: %v", err)
+	}
+	job = waitForJob(t, manager, job.ID)
+	if job.Status != jobs.StatusCompleted || job.Cached {
+		t.Fatalf("Expected a computed job, got %+v", job)
+	}
+	if job.Result.CID != helloWorldCID {
+		t.Errorf("Expected CID %s, got %s", helloWorldCID, job.Result.CID)
+	}
+	if md5 := job.Result.Digests["md5"]; md5 != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Errorf("Expected the md5 digest, got %q", md5)
+	}
+	if job.BytesRead != 11 || job.Progress != 1 {
+		t.Errorf("Expected progress 11 bytes (1), got %d (%v)", job.BytesRead, job.Progress)
+	}
+
+	// Unchanged files are answered from the cache, even synchronously
+	cached, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movies/hello.txt"})
+	if err != nil || cached.Status != jobs.StatusCompleted || !cached.Cached {
+		t.Fatalf("Expected a cached completed job, got %+v (%v)", cached, err)
+	}
+	if result, err := manager.ComputeCID(context.Background(), jobs.CIDJobRequest{Path: "movies/hello.txt", Digests: []string{"md5"}}); err != nil || result.CID != helloWorldCID {
+		t.Errorf("ComputeCID = %+v (%v)", result, err)
+	}
+
+	// A rewritten file is hashed again
+	if err := os.WriteFile(path, []byte("hello, world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	job, err = manager.SubmitCID(jobs.CIDJobRequest{Path: "movies/hello.txt"})
+	if err != nil || job.Cached {
+		t.Fatalf("Expected a new job for the rewritten file, got %+v (%v)", job, err)
+	}
+	if job = waitForJob(t, manager, job.ID); job.Result.CID == helloWorldCID {
+		t.Error("Expected the rewritten file to get a new CID")
+	}
+
+	if _, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "../etc/passwd"}); !errors.Is(err, jobs.ErrInvalidPath) {
+		t.Errorf("Expected ErrInvalidPath, got %v", err)
+	}
+	if _, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movies"}); !errors.Is(err, jobs.ErrIsDirectory) {
+		t.Errorf("Expected ErrIsDirectory, got %v", err)
+	}
+	if _, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movies/hello.txt", Digests: []string{"crc32"}}); !errors.Is(err, jobs.ErrUnsupportedDigest) {
+		t.Errorf("Expected ErrUnsupportedDigest, got %v", err)
+	}
+	if _, err := manager.Get("missing"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/midhash"
+	"github.com/metazla/meta-core/internal/watcher"
+)
+
+// patterned returns size bytes counting modulo 251, so every offset differs
+func patterned(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestMidhash(t *testing.T) {
+	dir := t.TempDir()
+
+	// Known answers, computed outside Go (Python hashlib) from the definition:
+	// SHA-256 of the size as a big-endian uint64 and the middle 1MiB
+	vectors := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "midhash256:af5570f5a1810b7af78caf4bc70a660f0df51e42baf91d4de5b2328de0e83dfc"},
+		{"small", []byte("hello world"), "midhash256:bf5d969ac1b27d9352c04db2872c44a38d1c337b04af56fbc166407ab986fb1e"},
+		{"sample", patterned(midhash.SampleSize), "midhash256:eb8764ac9920fe59b277ed601268b00aed9a9909df8af118722b7a8c38e7d3c1"},
+		{"large", patterned(3*midhash.SampleSize + 1), "midhash256:7e104c25154584b53c2ae22cc18df1f19acca577cad8c60e9f1f9b7a087c5c35"},
+	}
+	for _, vector := range vectors {
+		path := filepath.Join(dir, vector.name)
+		if err := os.WriteFile(path, vector.data, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		hashID, err := midhash.File(path)
+		if err != nil {
+			t.Fatalf("File(%s) failed: %v", vector.name, err)
+		}
+		if hashID != vector.want {
+			t.Errorf("%s: expected %s, got %s", vector.name, vector.want, hashID)
+		}
+	}
+
+	// Bytes outside the sample do not change the hash, the size does
+	large := filepath.Join(dir, "large")
+	data := patterned(3*midhash.SampleSize + 1)
+	data[0]++
+	os.WriteFile(large, data, 0644)
+	hashID := vectors[3].want
+	if ok, err := midhash.Verify(large, hashID); err != nil || !ok {
+		t.Errorf("Expected a change outside the sample to keep the hash, got %v (%v)", ok, err)
+	}
+
+	// Case is ignored in the prefix and the digest alike
+	if ok, err := midhash.Verify(large, strings.ToUpper(hashID)); err != nil || !ok {
+		t.Errorf("Expected an uppercase hash ID to match, got %v (%v)", ok, err)
+	}
+
+	os.WriteFile(large, append(data, 0), 0644)
+	if ok, _ := midhash.Verify(large, hashID); ok {
+		t.Error("Expected a size change to change the hash")
+	}
+
+	for _, invalid := range []string{"", "midhash256:abc123", "sha256:" + strings.Repeat("0", 64), midhash.Prefix + strings.Repeat("z", 64)} {
+		if err := midhash.Validate(invalid); !errors.Is(err, midhash.ErrInvalidHashID) {
+			t.Errorf("Expected ErrInvalidHashID for %q, got %v", invalid, err)
+		}
+	}
+}
+
+// midhashReferenceEnv names a command that prints the hash ID of the file
+// given as its argument, such as the MetaMesh hasher. No reference
+// implementation ships with meta-core, so TestMidhashReference only runs
+// when one is configured.
+const midhashReferenceEnv = "META_CORE_MIDHASH_REFERENCE"
+
+func TestMidhashReference(t *testing.T) {
+	reference := os.Getenv(midhashReferenceEnv)
+	if reference == "" {
+		t.Skip(midhashReferenceEnv + " not set")
+	}
+
+	dir := t.TempDir()
+	sizes := []int{0, 11, midhash.SampleSize - 1, midhash.SampleSize, midhash.SampleSize + 1, 3*midhash.SampleSize + 1}
+	for _, size := range sizes {
+		path := filepath.Join(dir, "file")
+		if err := os.WriteFile(path, patterned(size), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		output, err := exec.Command(reference, path).Output()
+		if err != nil {
+			t.Fatalf("%s failed: %v", reference, err)
+		}
+		want := strings.ToLower(strings.TrimSpace(string(output)))
+		if hashID, err := midhash.File(path); err != nil || hashID != want {
+			t.Errorf("%d bytes: reference says %s, got %s (%v)", size, want, hashID, err)
+		}
+	}
+}
+
+func TestIdentitiesCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	modTime := time.Now().Add(-time.Hour)
+	os.Chtimes(path, modTime, modTime)
+
+	identities := watcher.NewIdentities()
+	_, hashID, err := identities.Identify(path)
+	if err != nil || hashID != "midhash256:bf5d969ac1b27d9352c04db2872c44a38d1c337b04af56fbc166407ab986fb1e" {
+		t.Fatalf("Identify = %s (%v)", hashID, err)
+	}
+
+	// Same size and mtime: the file is not read again
+	os.WriteFile(path, []byte("HELLO WORLD"), 0644)
+	os.Chtimes(path, modTime, modTime)
+	if _, cached, _ := identities.Identify(path); cached != hashID {
+		t.Errorf("Expected the cached hash ID for an unchanged size and mtime, got %s", cached)
+	}
+
+	// A new mtime is read again
+	os.Chtimes(path, time.Now(), time.Now())
+	if _, changed, _ := identities.Identify(path); changed == hashID {
+		t.Error("Expected a changed mtime to recompute the hash ID")
+	}
+}
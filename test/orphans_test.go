@@ -0,0 +1,255 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/orphans"
+	"github.com/metazla/meta-core/internal/storage"
+	"github.com/metazla/meta-core/internal/watcher"
+)
+
+// orphanStore counts orphan list reads and can serve a stale list
+type orphanStore struct {
+	storage.Store
+	reads atomic.Int32
+	stale []storage.Orphan
+}
+
+func (s *orphanStore) WithSource(source string) storage.Store {
+	s.Store = s.Store.WithSource(source)
+	return s
+}
+
+func (s *orphanStore) Orphans() ([]storage.Orphan, error) {
+	s.reads.Add(1)
+	if s.stale != nil {
+		return s.stale, nil
+	}
+	return s.Store.Orphans()
+}
+
+func TestPathIndex(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	// Written before the index exists: lookups scan
+	if err := client.SetMetadataFlat("a", map[string]string{"filePath": "movies/a.mkv"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	got, err := client.LookupHashesByPath("/movies/./a.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err, "a")
+
+	if current, _ := client.PathIndexCurrent(); current {
+		t.Fatal("Expected the path index not to be current before a rebuild")
+	}
+	indexed, err := client.RebuildPathIndex()
+	if err != nil || indexed != 1 {
+		t.Fatalf("Expected 1 path indexed, got %d (%v)", indexed, err)
+	}
+
+	// Writes keep the index current; copies share a path
+	client.SetMetadataFlat("b", map[string]string{"filePath": "movies/a.mkv"})
+	got, err = client.LookupHashesByPath("movies/a.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err, "a", "b")
+
+	client.SetProperty("a", "filePath", "movies/renamed.mkv")
+	got, err = client.LookupHashesByPath("movies/a.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err, "b")
+	got, err = client.LookupHashesByPath("movies/renamed.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err, "a")
+
+	client.DeleteMetadata("b")
+	got, err = client.LookupHashesByPath("movies/a.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err)
+}
+
+func TestOrphans(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildPathIndex(); err != nil {
+		t.Fatalf("RebuildPathIndex failed: %v", err)
+	}
+
+	cfg := &config.Config{FilesPath: t.TempDir(), OrphanRetentionMS: 60000}
+	collector := orphans.NewCollector(cfg, nil, client)
+
+	write := func(relPath string) {
+		t.Helper()
+		full := filepath.Join(cfg.FilesPath, relPath)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(relPath), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	process := func(eventType watcher.FileEventType, relPath, hashID, partialHash string) {
+		t.Helper()
+		event := watcher.FileEvent{Type: eventType, Path: relPath, HashID: hashID, PartialHash: partialHash}
+		if err := collector.Process(event); err != nil {
+			t.Fatalf("Process %s %s failed: %v", eventType, relPath, err)
+		}
+	}
+	expectOrphans := func(want ...string) {
+		t.Helper()
+		list, err := client.Orphans()
+		var got []string
+		for _, orphan := range list {
+			got = append(got, orphan.HashID)
+		}
+		expectIDs(t, "Orphans", got, err, want...)
+	}
+
+	write("movies/a.mkv")
+	write("movies/b.mkv")
+	client.SetMetadataFlat("a", map[string]string{"filePath": "movies/a.mkv", "partialHash": "pa", "title": "A"})
+	client.SetMetadataFlat("b", map[string]string{"filePath": "movies/b.mkv", "partialHash": "pb"})
+
+	// A delete event for a file that still exists is ignored
+	process(watcher.EventTypeDelete, "movies/a.mkv", "", "")
+	expectOrphans()
+
+	// Deleting a file orphans its metadata
+	os.Remove(filepath.Join(cfg.FilesPath, "movies/a.mkv"))
+	os.Remove(filepath.Join(cfg.FilesPath, "movies/b.mkv"))
+	process(watcher.EventTypeDelete, "movies/a.mkv", "", "")
+	process(watcher.EventTypeRename, "movies/b.mkv", "", "")
+	expectOrphans("a", "b")
+	if status, _ := client.GetProperty("a", "status"); status != "missing" {
+		t.Errorf("Expected status missing, got %q", status)
+	}
+
+	// A file with the same partial hash relinks the orphan
+	write("archive/a.mkv")
+	process(watcher.EventTypeAdd, "archive/a.mkv", "", "pa")
+	expectOrphans("b")
+	metadata, _ := client.GetMetadataFlat("a")
+	if metadata["filePath"] != "archive/a.mkv" || metadata["status"] != "" || metadata["missingSince"] != "" || metadata["title"] != "A" {
+		t.Errorf("Expected a relinked to archive/a.mkv, got %v", metadata)
+	}
+	got, err := client.LookupHashesByPath("archive/a.mkv")
+	expectIDs(t, "LookupHashesByPath", got, err, "a")
+
+	// Unknown partial hashes are remembered for the next collection
+	write("archive/b.mkv")
+	process(watcher.EventTypeAdd, "archive/b.mkv", "", "pb2")
+	client.SetProperty("b", "partialHash", "pb2")
+	client.SetMetadataFlat("c", map[string]string{"filePath": "movies/c.mkv", "status": "missing", "missingSince": "1000"})
+	expectOrphans("b", "c")
+
+	result, err := collector.Collect(time.Now())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if result.Relinked != 1 || result.Purged != 1 {
+		t.Errorf("Expected 1 relinked and 1 purged, got %+v", result)
+	}
+	expectOrphans()
+	if path, _ := client.GetProperty("b", "filePath"); path != "archive/b.mkv" {
+		t.Errorf("Expected b relinked to archive/b.mkv, got %q", path)
+	}
+	if metadata, _ := client.GetMetadataFlat("c"); len(metadata) > 0 {
+		t.Error("Expected c to be purged")
+	}
+}
+
+func TestOrphanPurgeRechecks(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	client.SetMetadataFlat("d", map[string]string{"filePath": "movies/d.mkv", "status": "missing", "missingSince": "1000"})
+	client.SetMetadataFlat("e", map[string]string{"filePath": "movies/e.mkv", "status": "missing", "missingSince": "1000"})
+	stale, err := client.Orphans()
+	if err != nil || len(stale) != 2 {
+		t.Fatalf("Expected 2 orphans, got %v (%v)", stale, err)
+	}
+
+	// Relinked, and missing again only recently, after the list was read
+	client.ApplyBatch([]storage.BatchOp{{HashID: "d", Unset: []string{"status", "missingSince"}}})
+	client.SetProperty("e", "missingSince", "9999999999999")
+
+	cfg := &config.Config{FilesPath: t.TempDir(), OrphanRetentionMS: 60000}
+	collector := orphans.NewCollector(cfg, nil, &orphanStore{Store: client, stale: stale})
+	result, err := collector.Collect(time.Now())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if result.Purged != 0 {
+		t.Errorf("Expected nothing purged, got %+v", result)
+	}
+	for _, hashID := range []string{"d", "e"} {
+		if metadata, _ := client.GetMetadataFlat(hashID); metadata["filePath"] == "" {
+			t.Errorf("Expected %s to be kept", hashID)
+		}
+	}
+}
+
+func TestOrphanEventBatch(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildPathIndex(); err != nil {
+		t.Fatalf("RebuildPathIndex failed: %v", err)
+	}
+
+	cfg := &config.Config{FilesPath: t.TempDir(), OrphanRetentionMS: 60000}
+	store := &orphanStore{Store: client}
+	collector := orphans.NewCollector(cfg, nil, store)
+
+	client.SetMetadataFlat("a", map[string]string{"filePath": "movies/a.mkv", "partialHash": "pa"})
+	client.SetMetadataFlat("b", map[string]string{"filePath": "movies/b.mkv", "partialHash": "pb"})
+	for _, relPath := range []string{"archive/a.mkv", "archive/b.mkv", "new/x.mkv", "new/y.mkv"} {
+		full := filepath.Join(cfg.FilesPath, relPath)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		os.WriteFile(full, []byte(relPath), 0644)
+	}
+
+	// Queued before the collector starts, so handled as one batch: the orphan
+	// list is read once and follows the batch's own writes
+	for _, event := range []watcher.FileEvent{
+		{Type: watcher.EventTypeDelete, Path: "movies/a.mkv"},
+		{Type: watcher.EventTypeAdd, Path: "archive/a.mkv", PartialHash: "pa"},
+		{Type: watcher.EventTypeAdd, Path: "new/x.mkv", PartialHash: "px"},
+		{Type: watcher.EventTypeDelete, Path: "movies/b.mkv"},
+		{Type: watcher.EventTypeAdd, Path: "new/y.mkv", PartialHash: "py"},
+		{Type: watcher.EventTypeAdd, Path: "archive/b.mkv", PartialHash: "pb"},
+	} {
+		collector.HandleEvent(event)
+	}
+	collector.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if path, _ := client.GetProperty("b", "filePath"); path == "archive/b.mkv" {
+			break
+		}
+		if time.Now().After(deadline) {
+			collector.Stop()
+			t.Fatal("Timed out waiting for b to be relinked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	collector.Stop()
+
+	if path, _ := client.GetProperty("a", "filePath"); path != "archive/a.mkv" {
+		t.Errorf("Expected a relinked to archive/a.mkv, got %q", path)
+	}
+	if reads := store.reads.Load(); reads != 1 {
+		t.Errorf("Expected the orphan list read once for the batch, got %d", reads)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/metazla/meta-core/internal/api"
+)
+
+func TestFilterMatch(t *testing.T) {
+	movie := map[string]string{
+		"title":    "The Matrix",
+		"type":     "movie",
+		"year":     "1999",
+		"genre":    "Action|Sci-Fi",
+		"sizeByte": "3500000000",
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`type = movie`, true},
+		{`type = MOVIE`, true},
+		{`type != movie`, false},
+		{`genre = sci-fi`, true},
+		{`title ^= "the mat"`, true},
+		{`title ~ matrix`, true},
+		{`year >= 2000`, false},
+		{`year < 2000 AND type = movie`, true},
+		{`year < 2000 type = episode`, false},
+		{`type = episode OR year = 1999`, true},
+		{`NOT (type = episode OR year > 2010)`, true},
+		{`sizeByte < 4GB`, true},
+		{`sizeByte < 3GiB`, false},
+		{`EXISTS genre`, true},
+		{`EXISTS plot`, false},
+		{`NOT EXISTS plot and plot != x`, true},
+		{`title = "The Matrix"`, true},
+	}
+
+	for _, tt := range tests {
+		filter, err := api.ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) failed: %v", tt.filter, err)
+			continue
+		}
+		if got := filter.Match(movie); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.filter, tt.want, got)
+		}
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`type =`,
+		`type movie`,
+		`(type = movie`,
+		`type = movie)`,
+		`title = "unterminated`,
+		`AND type = movie`,
+		`EXISTS`,
+	} {
+		if _, err := api.ParseFilter(input); err == nil {
+			t.Errorf("Expected ParseFilter(%q) to fail", input)
+		}
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []api.MetadataSearchResult{
+		{HashID: "d", Metadata: map[string]string{"title": "b"}},
+		{HashID: "c", Metadata: map[string]string{"year": "999", "title": "a"}},
+		{HashID: "b", Metadata: map[string]string{"year": "2024", "title": "b"}},
+		{HashID: "a", Metadata: map[string]string{"year": "2024", "title": "a"}},
+	}
+
+	keys, err := api.ParseSort("-year, title")
+	if err != nil {
+		t.Fatalf("ParseSort failed: %v", err)
+	}
+	api.SortResults(results, keys)
+
+	// Numeric descending by year, then title, files without a year last
+	want := []string{"a", "b", "c", "d"}
+	for i, result := range results {
+		if result.HashID != want[i] {
+			t.Errorf("Position %d: expected %s, got %s", i, want[i], result.HashID)
+		}
+	}
+
+	if _, err := api.ParseSort("-"); err == nil {
+		t.Error("Expected ParseSort to reject an empty field")
+	}
+}
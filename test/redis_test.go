@@ -0,0 +1,190 @@
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/leader"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedisEnv names the file a stand-in redis-server records its arguments
+// to; when set, the test binary runs as that stand-in (see TestMain)
+const fakeRedisEnv = "META_CORE_TEST_REDIS_ARGS"
+
+func TestMain(m *testing.M) {
+	if argsPath := os.Getenv(fakeRedisEnv); argsPath != "" {
+		os.Exit(fakeRedisServer(argsPath, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeRedisServer serves the embedded server on the --bind and --port of a
+// redis-server command line until it is terminated
+func fakeRedisServer(argsPath string, args []string) int {
+	os.WriteFile(argsPath, []byte(strings.Join(args, " ")), 0644)
+
+	bind, port := "127.0.0.1", "6379"
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--bind":
+			bind = strings.Fields(args[i+1])[0]
+		case "--port":
+			port = args[i+1]
+		}
+	}
+
+	server := embedded.NewServer(embedded.Options{Addr: net.JoinHostPort(bind, port)})
+	if err := server.Start(); err != nil {
+		return 1
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+	server.Close()
+	return 0
+}
+
+// useFakeRedis puts a redis-server that runs fakeRedisServer first in PATH
+// and returns the file it records its arguments to
+func useFakeRedis(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the stand-in redis-server is a shell script")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nexec '" + self + "' \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "redis-server"), []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	argsPath := filepath.Join(dir, "args")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(fakeRedisEnv, argsPath)
+	return argsPath
+}
+
+func TestRedisLocalURL(t *testing.T) {
+	cases := []struct {
+		bind string
+		want string
+	}{
+		{"0.0.0.0", "redis://127.0.0.1:6380"},
+		{"", "redis://127.0.0.1:6380"},
+		{"127.0.0.1", "redis://127.0.0.1:6380"},
+		{"10.0.0.5", "redis://10.0.0.5:6380"},
+		{"10.0.0.5 -::1", "redis://[::1]:6380"},
+		{"::", "redis://[::1]:6380"},
+		{"fd00::5", "redis://[fd00::5]:6380"},
+	}
+	for _, c := range cases {
+		rm := leader.NewRedisManager(&config.Config{RedisBind: c.bind, RedisPort: 6380})
+		if got := rm.LocalURL(); got != c.want {
+			t.Errorf("LocalURL with REDIS_BIND %q: expected %s, got %s", c.bind, c.want, got)
+		}
+	}
+}
+
+func TestRedisRefusesOpenBind(t *testing.T) {
+	for _, mode := range []string{leader.RedisModeEmbedded, "external"} {
+		rm := leader.NewRedisManager(&config.Config{
+			MetaCorePath: t.TempDir(),
+			RedisMode:    mode,
+			RedisBind:    "0.0.0.0",
+			RedisPort:    freePort(t),
+		})
+		if err := rm.Start(); err == nil {
+			rm.Stop()
+			t.Errorf("Expected %s Redis to refuse a network bind without a password", mode)
+		}
+		if err := rm.StartReplica("redis://10.0.0.1:6379"); err == nil {
+			rm.Stop()
+			t.Errorf("Expected %s replica to refuse a network bind without a password", mode)
+		}
+	}
+}
+
+func TestReplicaPromotion(t *testing.T) {
+	argsPath := useFakeRedis(t)
+
+	cfg := &config.Config{
+		MetaCorePath:    t.TempDir(),
+		RedisMode:       "external",
+		RedisPort:       freePort(t),
+		RedisBind:       "127.0.0.1",
+		RedisReplicaDir: t.TempDir(),
+		RedisSave:       "60 1",
+	}
+	rm := leader.NewRedisManager(cfg)
+	defer rm.Stop()
+
+	if err := rm.StartReplica("redis://10.0.0.1:6379"); err != nil {
+		t.Fatalf("StartReplica failed: %v", err)
+	}
+	if err := rm.WaitForReady(10 * time.Second); err != nil {
+		t.Fatalf("WaitForReady failed: %v", err)
+	}
+	if !rm.IsReplica() {
+		t.Fatal("Expected a replica")
+	}
+	args, _ := os.ReadFile(argsPath)
+	for _, want := range []string{"--replicaof 10.0.0.1 6379", "--replica-read-only yes", "--dir " + cfg.RedisReplicaDir} {
+		if !strings.Contains(string(args), want) {
+			t.Errorf("Expected redis-server arguments to contain %q, got %s", want, args)
+		}
+	}
+
+	// Following the same leader again is a no-op
+	if err := rm.StartReplica("redis://10.0.0.1:6379"); err != nil {
+		t.Errorf("StartReplica of the same leader failed: %v", err)
+	}
+
+	opts, _ := redis.ParseURL(rm.LocalURL())
+	client := redis.NewClient(opts)
+	defer client.Close()
+	ctx := context.Background()
+	client.Set(ctx, "replicated", "yes", 0)
+
+	// Promotion keeps the data and switches persistence to the shared volume
+	if err := rm.Promote(); err != nil {
+		t.Fatalf("Promote failed: %v", err)
+	}
+	if rm.IsReplica() || !rm.IsRunning() {
+		t.Errorf("Expected a running primary, got replica=%v running=%v", rm.IsReplica(), rm.IsRunning())
+	}
+	if value, err := client.Get(ctx, "replicated").Result(); err != nil || value != "yes" {
+		t.Errorf("Expected the replicated data to survive promotion, got %q (%v)", value, err)
+	}
+	if _, err := os.Stat(cfg.RedisDataDir()); err != nil {
+		t.Errorf("Expected the shared data directory to be created: %v", err)
+	}
+
+	if err := rm.Promote(); err == nil {
+		t.Error("Expected promoting a primary to fail")
+	}
+	if err := rm.StartReplica("redis://10.0.0.2:6379"); err == nil {
+		t.Error("Expected a running primary to refuse to become a replica")
+	}
+
+	if err := rm.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if rm.IsRunning() {
+		t.Error("Expected Redis to be stopped")
+	}
+}
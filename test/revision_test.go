@@ -0,0 +1,80 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+)
+
+func TestRevisions(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	expectRevision := func(what string, want int64) {
+		t.Helper()
+		_, revision, err := client.GetMetadataRevision("a")
+		if err != nil {
+			t.Fatalf("GetMetadataRevision failed: %v", err)
+		}
+		if revision != want {
+			t.Errorf("%s: expected revision %d, got %d", what, want, revision)
+		}
+	}
+
+	expectRevision("new file", 0)
+
+	if err := client.SetMetadataFlat("a", map[string]string{"title": "Movie"}); err != nil {
+		t.Fatalf("SetMetadataFlat failed: %v", err)
+	}
+	expectRevision("after set", 1)
+
+	if _, err := client.AddToSet("a", "genre", "Drama"); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+	expectRevision("after add", 2)
+
+	// Adding a value that is already there is not a change
+	if _, err := client.AddToSet("a", "genre", "Drama"); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+	expectRevision("after no-op add", 2)
+
+	// Conditional writes succeed at the expected revision only
+	stale := int64(1)
+	_, err := client.ApplyBatch([]storage.BatchOp{{HashID: "a", IfRevision: &stale, Set: map[string]string{"title": "Lost update"}}})
+	if !errors.Is(err, storage.ErrRevisionMismatch) {
+		t.Errorf("Expected ErrRevisionMismatch, got %v", err)
+	}
+	if title, _ := client.GetProperty("a", "title"); title != "Movie" {
+		t.Errorf("Expected rejected write to leave title, got %q", title)
+	}
+
+	current := int64(2)
+	revisions, err := client.ApplyBatch([]storage.BatchOp{{HashID: "a", IfRevision: &current, Set: map[string]string{"title": "Edited"}}})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	if revisions["a"] != 3 {
+		t.Errorf("Expected revision 3 after conditional write, got %d", revisions["a"])
+	}
+
+	// Revisions survive deletes so a recreated file never reuses one
+	if _, err := client.DeleteMetadata("a"); err != nil {
+		t.Fatalf("DeleteMetadata failed: %v", err)
+	}
+	metadata, _, err := client.GetMetadataRevision("a")
+	if err != nil || metadata != nil {
+		t.Errorf("Expected deleted file to have no metadata, got %v (%v)", metadata, err)
+	}
+	expectRevision("after delete", 4)
+
+	if err := client.SetProperty("a", "title", "Again"); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	expectRevision("after recreate", 5)
+}
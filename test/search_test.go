@@ -0,0 +1,74 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/api"
+	"github.com/metazla/meta-core/internal/embedded"
+)
+
+func TestSearchPartialWords(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	handler := newAPI(t, client)
+
+	matrix := "midhash256:ab12" + strings.Repeat("0", 60)
+	amelie := "midhash256:cd34" + strings.Repeat("0", 60)
+	client.SetMetadataFlat(matrix, map[string]string{"title": "The Matrix Reloaded", "genre": "Sci-Fi"})
+	client.SetMetadataFlat(amelie, map[string]string{"title": "Amélie", "genre": "Comedy|Romance"})
+
+	search := func(body string) []string {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/metadata/search", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("search %s: expected 200, got %d (%s)", body, rr.Code, rr.Body)
+		}
+		var response api.MetadataSearchResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		ids := []string{}
+		for _, result := range response.Results {
+			ids = append(ids, result.HashID)
+		}
+		return ids
+	}
+
+	// The same queries match the same files before (scan) and after (index)
+	// a rebuild
+	for _, phase := range []string{"scan", "index"} {
+		if phase == "index" {
+			if _, err := client.RebuildIndexes(); err != nil {
+				t.Fatalf("RebuildIndexes failed: %v", err)
+			}
+		}
+
+		expectIDs(t, phase+" query matr", search(`{"query":"matr"}`), nil, matrix)
+		expectIDs(t, phase+" query MATRIX rel", search(`{"query":"MATRIX rel"}`), nil, matrix)
+		expectIDs(t, phase+" query amél", search(`{"query":"amél"}`), nil, amelie)
+		expectIDs(t, phase+" property genre rom", search(`{"property":"genre","propertyValue":"rom"}`), nil, amelie)
+		expectIDs(t, phase+" hash ID", search(`{"query":"`+matrix+`"}`), nil, matrix)
+		expectIDs(t, phase+" hash ID start", search(`{"query":"midhash256:cd3"}`), nil, amelie)
+		expectIDs(t, phase+" hex digits", search(`{"query":"AB12"}`), nil, matrix)
+
+		// Words and values only match from their start
+		expectIDs(t, phase+" query atrix", search(`{"query":"atrix"}`), nil)
+		expectIDs(t, phase+" query matrix amelie", search(`{"query":"matrix amelie"}`), nil)
+		expectIDs(t, phase+" property genre omance", search(`{"property":"genre","propertyValue":"omance"}`), nil)
+		expectIDs(t, phase+" hash ID middle", search(`{"query":"12000000"}`), nil)
+
+		// An unindexed property is always scanned, with the same rule
+		expectIDs(t, phase+" property title the mat", search(`{"property":"title","propertyValue":"the mat"}`), nil, matrix)
+		expectIDs(t, phase+" property title matrix", search(`{"property":"title","propertyValue":"matrix"}`), nil)
+	}
+}
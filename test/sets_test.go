@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/embedded"
+	"github.com/metazla/meta-core/internal/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSetEncoding(t *testing.T) {
+	cases := []struct {
+		value    string
+		elements []string
+	}{
+		{"", nil},
+		{"Drama", []string{"Drama"}},
+		{"Drama|Comedy", []string{"Drama", "Comedy"}},
+		{`Rock\|Pop|Jazz`, []string{"Rock|Pop", "Jazz"}},
+		{`AC\\DC|Queen`, []string{`AC\DC`, "Queen"}},
+		// Other backslashes are literal, as in values written before escaping
+		{`C:\movies|D:\shows`, []string{`C:\movies`, `D:\shows`}},
+	}
+	for _, tc := range cases {
+		if got := storage.SplitSet(tc.value); !reflect.DeepEqual(got, tc.elements) {
+			t.Errorf("SplitSet(%q) = %q, want %q", tc.value, got, tc.elements)
+		}
+		if got := storage.SplitSet(storage.JoinSet(tc.elements)); !reflect.DeepEqual(got, tc.elements) {
+			t.Errorf("JoinSet(%q) does not round-trip, got %q", tc.elements, got)
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+	if _, err := client.RebuildIndexes(); err != nil {
+		t.Fatalf("RebuildIndexes failed: %v", err)
+	}
+
+	for _, value := range []string{"Rock|Pop", "Jazz", "Rock|Pop"} {
+		if _, err := client.AddToSet("a", "genre", value); err != nil {
+			t.Fatalf("AddToSet failed: %v", err)
+		}
+	}
+	genre, _ := client.GetProperty("a", "genre")
+	if elements := storage.SplitSet(genre); !reflect.DeepEqual(elements, []string{"Rock|Pop", "Jazz"}) {
+		t.Errorf("Expected elements [Rock|Pop Jazz], got %q (%q)", elements, genre)
+	}
+	ids, err := client.FindByProperty("genre", "rock|pop")
+	expectIDs(t, "FindByProperty", ids, err, "a")
+
+	removed, err := client.RemoveFromSet("a", "genre", "Rock|Pop")
+	if err != nil || !removed {
+		t.Fatalf("Expected RemoveFromSet to remove the element, got %v (%v)", removed, err)
+	}
+	if genre, _ := client.GetProperty("a", "genre"); genre != "Jazz" {
+		t.Errorf("Expected genre Jazz, got %q", genre)
+	}
+	if removed, _ := client.RemoveFromSet("a", "genre", "Rock"); removed {
+		t.Error("Expected removing a missing element to report false")
+	}
+}
+
+func TestMigrateSetEncoding(t *testing.T) {
+	server := startEmbedded(t, embedded.Options{})
+	defer server.Close()
+
+	client := connectIndexed(t, server)
+	defer client.Close()
+
+	// Written by a version without escaping: the elements are `C:\` and
+	// `D:\`. Only set properties (indexed and CID fields) are migrated.
+	raw := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer raw.Close()
+	ctx := context.Background()
+	for _, hashID := range []string{"a", "b", "c"} {
+		raw.HSet(ctx, "file:"+hashID, "subtitlesPath", `C:\|D:\`, "posterPath", `\\nas\poster.jpg`, "title", `AC\DC | Live`)
+		raw.SAdd(ctx, "file:__index__", hashID)
+	}
+
+	// A write before the migration reaches a file escapes its legacy values
+	// once, and the migration leaves it alone
+	if _, err := client.AddToSet("b", "subtitlesPath", `E:\`); err != nil {
+		t.Fatalf("AddToSet failed: %v", err)
+	}
+
+	// Two runs at once and a concurrent write, each migration writing at the
+	// revision it read
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := client.AddToSet("c", "subtitlesPath", `G:\`); err != nil {
+			t.Errorf("AddToSet failed: %v", err)
+		}
+	}()
+	results := make([]int, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		other := connectIndexed(t, server)
+		defer other.Close()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = other.MigrateSetEncoding()
+		}(i)
+	}
+	wg.Wait()
+	if errs[0] != nil || errs[1] != nil || results[0]+results[1] > 2 {
+		t.Fatalf("Expected at most 2 files migrated in all, got %v (%v)", results, errs)
+	}
+
+	expect := func(hashID string, elements ...string) {
+		t.Helper()
+		metadata, _ := client.GetMetadataFlat(hashID)
+		if got := storage.SplitSet(metadata["subtitlesPath"]); !reflect.DeepEqual(got, elements) {
+			t.Errorf("%s: expected elements %q, got %q (%q)", hashID, elements, got, metadata["subtitlesPath"])
+		}
+		if metadata["posterPath"] != `\\nas\poster.jpg` {
+			t.Errorf("%s: expected single values to be left alone, got %q", hashID, metadata["posterPath"])
+		}
+		if metadata["title"] != `AC\DC | Live` {
+			t.Errorf("%s: expected plain properties to be left alone, got %q", hashID, metadata["title"])
+		}
+	}
+	expect("a", `C:\`, `D:\`)
+	expect("b", `C:\`, `D:\`, `E:\`)
+	expect("c", `C:\`, `D:\`, `G:\`)
+
+	// A rerun after a failure to record completion skips migrated files
+	raw.Del(ctx, "meta:set-encoding")
+	raw.SAdd(ctx, "meta:set-encoding:migrated", "a", "b", "c")
+	if migrated, err := client.MigrateSetEncoding(); err != nil || migrated != 0 {
+		t.Errorf("Expected a rerun to rewrite nothing, got %d (%v)", migrated, err)
+	}
+	expect("a", `C:\`, `D:\`)
+
+	// The migration runs once
+	if err := client.SetProperty("d", "subtitlesPath", `E:\|F:\`); err != nil {
+		t.Fatalf("SetProperty failed: %v", err)
+	}
+	if migrated, err := client.MigrateSetEncoding(); err != nil || migrated != 0 {
+		t.Errorf("Expected the migration to do nothing once complete, got %d (%v)", migrated, err)
+	}
+	if exists, _ := raw.Exists(ctx, "meta:set-encoding:migrated").Result(); exists != 0 {
+		t.Error("Expected the migrated marks to be dropped once complete")
+	}
+}
@@ -0,0 +1,197 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/metazla/meta-core/internal/config"
+	"github.com/metazla/meta-core/internal/jobs"
+	"github.com/metazla/meta-core/internal/unixfs"
+)
+
+// buildDAG builds the UnixFS DAG of size bytes of zeros, returning the root
+// and the blocks by codec
+func buildDAG(t *testing.T, size int) (unixfs.CID, map[uint64]int) {
+	t.Helper()
+
+	blocks := make(map[uint64]int)
+	builder := unixfs.NewBuilder(func(block unixfs.Block) error {
+		if !bytes.Equal(unixfs.NewCID(block.CID.Codec(), block.Data), block.CID) {
+			t.Errorf("Block %s does not match its data", block.CID)
+		}
+		blocks[block.CID.Codec()]++
+		return nil
+	})
+	zeros := make([]byte, 100000)
+	for written := 0; written < size; {
+		n := min(len(zeros), size-written)
+		if _, err := builder.Write(zeros[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		written += n
+	}
+	root, err := builder.Finish()
+	if err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	return root, blocks
+}
+
+func TestUnixFSBuilder(t *testing.T) {
+	// Files of a single chunk are a raw leaf, as with `ipfs add --cid-version 1`
+	builder := unixfs.NewBuilder(nil)
+	builder.Write([]byte("hello world"))
+	if root, _ := builder.Finish(); root.String() != helloWorldCID {
+		t.Errorf("Expected %s, got %s", helloWorldCID, root)
+	}
+	if root, _ := unixfs.NewBuilder(nil).Finish(); root.String() != "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku" {
+		t.Errorf("Expected the empty raw block for an empty file, got %s", root)
+	}
+
+	root, blocks := buildDAG(t, unixfs.DefaultChunkSize)
+	if root.Codec() != unixfs.CodecRaw || blocks[unixfs.CodecRaw] != 1 {
+		t.Errorf("Expected a single leaf for a full chunk, got %s (%v)", root, blocks)
+	}
+
+	// One node joins up to 174 leaves, then a new level is added
+	root, blocks = buildDAG(t, 3*unixfs.DefaultChunkSize+1)
+	if root.Codec() != unixfs.CodecDagPB || blocks[unixfs.CodecRaw] != 4 || blocks[unixfs.CodecDagPB] != 1 {
+		t.Errorf("Expected 4 leaves under a dag-pb root, got %s (%v)", root, blocks)
+	}
+	root, blocks = buildDAG(t, (unixfs.DefaultMaxLinks+1)*unixfs.DefaultChunkSize)
+	if blocks[unixfs.CodecRaw] != unixfs.DefaultMaxLinks+1 || blocks[unixfs.CodecDagPB] != 3 {
+		t.Errorf("Expected %d leaves under 3 nodes, got %v", unixfs.DefaultMaxLinks+1, blocks)
+	}
+
+	// Known answers, computed outside Go (Python hashlib) from the dag-pb and
+	// UnixFS specs with the balanced layout, not by `ipfs add` itself: see
+	// TestUnixFSMatchesIPFS for that
+	vectors := []struct {
+		size int
+		want string
+	}{
+		{3*unixfs.DefaultChunkSize + 1, "bafybeibdgqquzp7t3wmuf7nj5zid2b5w5x7ixwqdjnf4it6wfzfc6m45km"},
+		{unixfs.DefaultMaxLinks*unixfs.DefaultChunkSize + 1, "bafybeib4y7ghw2rq7bracc4xwtxrbzo7cfvagdpte2tmrkgwl6dyard3cm"},
+	}
+	for _, vector := range vectors {
+		builder := unixfs.NewBuilder(nil)
+		builder.Write(patterned(vector.size))
+		if got, _ := builder.Finish(); got.String() != vector.want {
+			t.Errorf("%d bytes: expected %s, got %s", vector.size, vector.want, got)
+		}
+	}
+
+	parsed, err := unixfs.ParseCID(root.String())
+	if err != nil || !bytes.Equal(parsed, root) {
+		t.Errorf("ParseCID(%s) = %v (%v)", root, parsed, err)
+	}
+	if _, err := unixfs.ParseCID("Qmfoo"); !errors.Is(err, unixfs.ErrInvalidCID) {
+		t.Errorf("Expected ErrInvalidCID, got %v", err)
+	}
+}
+
+// TestUnixFSMatchesIPFS checks the builder against `ipfs add` itself, with
+// the settings meta-core mirrors (CIDv1, raw leaves, 256KiB chunks, balanced
+// layout), for one file per DAG shape
+func TestUnixFSMatchesIPFS(t *testing.T) {
+	if _, err := exec.LookPath("ipfs"); err != nil {
+		t.Skip("ipfs not found in PATH")
+	}
+
+	repo := t.TempDir()
+	ipfs := func(args ...string) (string, error) {
+		cmd := exec.Command("ipfs", args...)
+		cmd.Env = append(os.Environ(), "IPFS_PATH="+repo)
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	if _, err := ipfs("init", "--profile", "test"); err != nil {
+		t.Fatalf("ipfs init failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	sizes := map[string]int{
+		"single":    unixfs.DefaultChunkSize - 1,
+		"one-level": 3*unixfs.DefaultChunkSize + 1,
+		"two-level": unixfs.DefaultMaxLinks*unixfs.DefaultChunkSize + 1,
+	}
+	for name, size := range sizes {
+		data := patterned(size)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		want, err := ipfs("add", "--only-hash", "--quiet", "--cid-version", "1", "--chunker", "size-262144", path)
+		if err != nil {
+			t.Fatalf("ipfs add %s failed: %v", name, err)
+		}
+
+		builder := unixfs.NewBuilder(nil)
+		builder.Write(data)
+		if got, _ := builder.Finish(); got.String() != want {
+			t.Errorf("%s (%d bytes): ipfs add says %s, got %s", name, size, want, got)
+		}
+	}
+}
+
+func TestUnixFSCAR(t *testing.T) {
+	cfg := &config.Config{FilesPath: t.TempDir()}
+	data := bytes.Repeat([]byte("meta-core"), unixfs.DefaultChunkSize/3)
+	if err := os.WriteFile(filepath.Join(cfg.FilesPath, "movie.mkv"), data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	manager := jobs.NewManager(cfg)
+	manager.Start()
+	defer manager.Stop()
+
+	job, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movie.mkv", Layout: jobs.LayoutUnixFS})
+	if err != nil {
+		t.Fatalf("SubmitCID failed: %v", err)
+	}
+	job = waitForJob(t, manager, job.ID)
+	root, err := unixfs.ParseCID(job.Result.CID)
+	if err != nil || root.Codec() != unixfs.CodecDagPB {
+		t.Fatalf("Expected a dag-pb root, got %q (%v)", job.Result.CID, err)
+	}
+	if raw, _ := manager.ComputeCID(context.Background(), jobs.CIDJobRequest{Path: "movie.mkv"}); raw == nil || raw.CID == job.Result.CID {
+		t.Errorf("Expected the raw layout to give another CID, got %+v", raw)
+	}
+	if _, err := manager.SubmitCID(jobs.CIDJobRequest{Path: "movie.mkv", Layout: "trickle"}); !errors.Is(err, jobs.ErrUnsupportedLayout) {
+		t.Errorf("Expected ErrUnsupportedLayout, got %v", err)
+	}
+
+	var car bytes.Buffer
+	if err := unixfs.WriteCAR(&car, root, bytes.NewReader(data)); err != nil {
+		t.Fatalf("WriteCAR failed: %v", err)
+	}
+
+	// Header, then 4 sections: 3 leaves and the root
+	var sections [][]byte
+	for rest := car.Bytes(); len(rest) > 0; {
+		length, n := binary.Uvarint(rest)
+		if n <= 0 || uint64(len(rest)-n) < length {
+			t.Fatalf("Truncated CAR section")
+		}
+		sections = append(sections, rest[n:n+int(length)])
+		rest = rest[n+int(length):]
+	}
+	if len(sections) != 5 {
+		t.Fatalf("Expected a header and 4 blocks, got %d sections", len(sections))
+	}
+	if !bytes.Contains(sections[0], root) || !bytes.HasPrefix(sections[4], root) {
+		t.Error("Expected the root in the header and as the last block")
+	}
+
+	data[0] = 'M'
+	if err := unixfs.WriteCAR(&bytes.Buffer{}, root, bytes.NewReader(data)); !errors.Is(err, unixfs.ErrRootMismatch) {
+		t.Errorf("Expected ErrRootMismatch for changed data, got %v", err)
+	}
+}